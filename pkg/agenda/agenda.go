@@ -0,0 +1,520 @@
+// The agenda package builds org agenda views from the planning elements of
+// one or more documents, expanding repeating timestamps, date ranges and
+// diary sexps into the days of a window.
+package agenda
+
+import (
+	"iter"
+	"time"
+
+	"github.com/lcyvin/gorgeous/pkg/org"
+)
+
+// Agenda is a time based agenda view covering the days between Start and End.
+type Agenda struct {
+  Documents []*org.Document
+  // Midnight of the first day in the view.
+  Start     time.Time
+  // Midnight of the day following the last day in the view.
+  End       time.Time
+  Days      []*Day
+
+  // Sorting applied to the entries of each day. Defaults to DefaultSorting.
+  Sorting   []SortKey
+  // Location used to determine day boundaries, and in which entries' times
+  // are given. Timestamps of headings with a TIMEZONE property are converted
+  // into it. Defaults to the location of the start time passed to New.
+  Location  *time.Location
+  // The current day. When it falls within the view, overdue scheduled items
+  // and deadlines, along with warnings for upcoming deadlines, are shown on
+  // it. Defaults to time.Now().
+  Today     time.Time
+  // Days ahead of a deadline its warning is shown, when the deadline's
+  // timestamp holds no warning cookie. Mirrors org-deadline-warning-days and
+  // defaults to 14.
+  DeadlineWarningDays int
+  // Headings for which any of these return true are left out of the view.
+  Skip      []SkipFunc
+
+  order     int
+}
+
+// Day holds the entries shown for a single day of an agenda view.
+type Day struct {
+  Date    time.Time
+  Entries []*Entry
+}
+
+type AgendaOpt func(*Agenda)
+
+// Sets the sorting strategy applied to each day's entries.
+func WithSorting(keys... SortKey) AgendaOpt {
+  return func(a *Agenda) {
+    a.Sorting = keys
+  }
+}
+
+// Sets the location used to determine day boundaries.
+func WithLocation(loc *time.Location) AgendaOpt {
+  return func(a *Agenda) {
+    a.Location = loc
+  }
+}
+
+// Sets the day treated as today.
+func WithToday(t time.Time) AgendaOpt {
+  return func(a *Agenda) {
+    a.Today = t
+  }
+}
+
+// Sets the default number of days a deadline warning is shown ahead of the
+// deadline.
+func WithDeadlineWarningDays(days int) AgendaOpt {
+  return func(a *Agenda) {
+    a.DeadlineWarningDays = days
+  }
+}
+
+// Sets functions deciding which headings are left out of the view.
+func WithSkip(fns... SkipFunc) AgendaOpt {
+  return func(a *Agenda) {
+    a.Skip = fns
+  }
+}
+
+// New builds an agenda covering every day from the day holding start up to
+// and including the day holding end, unless end is exactly midnight, in which
+// case that day is excluded.
+func New(docs []*org.Document, start, end time.Time, opts... AgendaOpt) *Agenda {
+  a := &Agenda{
+    Documents: docs,
+    Sorting: DefaultSorting,
+    Location: start.Location(),
+    Today: time.Now(),
+    DeadlineWarningDays: 14,
+  }
+
+  for _, opt := range opts {
+    opt(a)
+  }
+
+  a.Today = midnight(a.Today.In(a.Location))
+  a.Start = midnight(start.In(a.Location))
+  a.End = midnight(end.In(a.Location))
+  if a.End.Before(end) || !a.End.After(a.Start) {
+    a.End = a.End.AddDate(0, 0, 1)
+  }
+
+  a.build()
+
+  return a
+}
+
+// DayView builds an agenda for the single day holding day.
+func DayView(docs []*org.Document, day time.Time, opts... AgendaOpt) *Agenda {
+  return New(docs, day, midnight(day).AddDate(0, 0, 1), opts...)
+}
+
+// WeekView builds an agenda for the week holding day, starting on Monday as
+// org does by default.
+func WeekView(docs []*org.Document, day time.Time, opts... AgendaOpt) *Agenda {
+  offset := (int(day.Weekday()) + 6) % 7
+  start := midnight(day).AddDate(0, 0, -offset)
+
+  return New(docs, start, start.AddDate(0, 0, 7), opts...)
+}
+
+// Returns every entry in the agenda, ordered by day.
+func (a *Agenda) Entries() []*Entry {
+  out := make([]*Entry, 0)
+  for _, d := range a.Days {
+    out = append(out, d.Entries...)
+  }
+
+  return out
+}
+
+func (a *Agenda) build() {
+  a.Days = make([]*Day, 0)
+  for d := a.Start; d.Before(a.End); d = d.AddDate(0, 0, 1) {
+    a.Days = append(a.Days, &Day{Date: d, Entries: make([]*Entry, 0)})
+  }
+
+  for _, doc := range a.Documents {
+    for n := range doc.Nodes() {
+      if n.Heading == nil || skipNode(n) || skipped(a.Skip, n) {
+        continue
+      }
+
+      for _, p := range n.Heading.Planning {
+        a.addPlanning(doc, n, p)
+      }
+
+      if n.Section != nil {
+        for _, e := range n.Section.Elements {
+          if ds, ok := e.(*org.DiarySexp); ok {
+            a.addDiarySexp(doc, n, ds)
+          }
+        }
+      }
+    }
+  }
+
+  for _, d := range a.Days {
+    SortEntries(d.Entries, a.Sorting)
+  }
+}
+
+func (a *Agenda) addPlanning(doc *org.Document, n *org.Node, p *org.Planning) {
+  kind, ok := entryKind(p.PlanningKind)
+  if !ok || p.TimestampRangeOrSexp == nil {
+    return
+  }
+
+  // timestamps of headings with an invalid TIMEZONE are left floating
+  tros, _ := n.ZonedTimestamp(p.TimestampRangeOrSexp)
+  switch ts := a.localizeDates(tros).(type) {
+  case *org.Timestamp:
+    if !ts.Active {
+      return
+    }
+
+    if rc, ok := recurrence(n, p, ts); ok {
+      a.addOccurrences(doc, n, p, kind, rc)
+      return
+    }
+
+    a.addTimestamp(doc, n, p, kind, ts, repeatConfig(ts))
+  case *org.RepeatStamp:
+    if ts.Active {
+      a.addTimestamp(doc, n, p, kind, &ts.Timestamp, ts.RepeatConfig)
+    }
+  case *org.TimestampRange:
+    if ts.StartDate == nil || ts.EndDate == nil || !ts.IsActive() {
+      return
+    }
+
+    a.addRange(doc, n, p, ts)
+  case *org.SexpTimestamp:
+    a.addOccurrences(doc, n, p, kind, ts)
+  case *org.Recurrence:
+    a.addOccurrences(doc, n, p, kind, ts)
+  }
+}
+
+// occurrer is implemented by timestamps whose dates are computed rather than
+// held, such as sexp timestamps and recurrences.
+type occurrer interface {
+  Occurrences(start, end time.Time) iter.Seq[*org.Timestamp]
+}
+
+// Adds an entry for each occurrence of a sexp timestamp or recurrence
+// starting within the view.
+func (a *Agenda) addOccurrences(doc *org.Document, n *org.Node, p *org.Planning, kind EntryKind, ts occurrer) {
+  for occ := range ts.Occurrences(a.Start, a.End) {
+    if occ.Start.Before(a.Start) {
+      continue
+    }
+
+    a.add(a.newEntry(doc, n, p, kind, occ), a.startOf(occ))
+  }
+}
+
+// Adds an entry for each day of the view a diary sexp line occurs on, titled
+// with the line's text, or the heading's when the line holds none.
+func (a *Agenda) addDiarySexp(doc *org.Document, n *org.Node, ds *org.DiarySexp) {
+  st := org.NewSexpTimestamp(ds.Sexp)
+  for occ := range st.Occurrences(a.Start, a.End) {
+    e := a.newEntry(doc, n, nil, ENTRY_SEXP, occ)
+    if ds.Text != "" {
+      e.Title = ds.Text
+    }
+
+    a.add(e, a.startOf(occ))
+  }
+}
+
+// Adds the entries for a single timestamp: one for each occurrence within the
+// view, plus, on today, an entry for an overdue scheduled item or deadline and
+// a warning for an upcoming deadline. Scheduled occurrences are shown once
+// their delay has passed. Done headings get neither overdue nor warning
+// entries.
+func (a *Agenda) addTimestamp(doc *org.Document, n *org.Node, p *org.Planning, kind EntryKind, ts *org.Timestamp, cfg org.RepeatConfig) {
+  planned := kind == ENTRY_SCHEDULED || kind == ENTRY_DEADLINE
+  active := planned && !n.Heading.IsDone() && a.day(a.Today) != nil
+
+  delay := func(occ *org.Timestamp) int {
+    if kind != ENTRY_SCHEDULED || occ.Delay == nil {
+      return 0
+    }
+
+    if occ.Delay.Kind == org.DELAY_KIND_FIRST && !occ.Start.Equal(ts.Start) {
+      return 0
+    }
+
+    return occ.Delay.Days(occ.Start)
+  }
+
+  // a delayed scheduled item only becomes overdue once its delay has passed
+  since := daysBetween(a.startOf(ts), a.Today)
+  overdue := active && since > 0 && since >= delay(ts)
+  if overdue {
+    a.add(a.newEntry(doc, n, p, kind, ts), a.Today)
+  }
+
+  from := a.Start
+  if kind == ENTRY_SCHEDULED && ts.Delay != nil {
+    from = from.AddDate(0, 0, -ts.Delay.Days(a.Start))
+  }
+
+  for _, occ := range occurrences(ts, cfg, from, a.End) {
+    shown := midnight(a.startOf(occ)).AddDate(0, 0, delay(occ))
+    if overdue && shown.Equal(a.Today) {
+      continue
+    }
+
+    a.add(a.newEntry(doc, n, p, kind, occ), shown)
+  }
+
+  if !active || kind != ENTRY_DEADLINE {
+    return
+  }
+
+  warn := a.DeadlineWarningDays
+  if ts.Delay != nil {
+    warn = ts.Delay.Days(ts.Start)
+  }
+
+  upcoming := occurrences(ts, cfg, a.Today.AddDate(0, 0, 1), a.Today.AddDate(0, 0, warn+1))
+  if len(upcoming) > 0 && !overdue {
+    a.add(a.newEntry(doc, n, p, kind, upcoming[0]), a.Today)
+  }
+}
+
+// Adds an entry for each day of a date range, repeating the range when its
+// start holds a repeat cookie.
+func (a *Agenda) addRange(doc *org.Document, n *org.Node, p *org.Planning, tr *org.TimestampRange) {
+  days := daysBetween(tr.StartDate.Start, tr.EndDate.Start) + 1
+  if days < 1 {
+    return
+  }
+
+  // widen the window so ranges starting before it are still expanded
+  from := a.Start.AddDate(0, 0, -days)
+  for _, occ := range occurrences(tr.StartDate, repeatConfig(tr.StartDate), from, a.End) {
+    for i := 0; i < days; i++ {
+      day := midnight(a.startOf(occ)).AddDate(0, 0, i)
+      if day.Before(a.Start) || !day.Before(a.End) {
+        continue
+      }
+
+      e := a.newEntry(doc, n, p, ENTRY_RANGE, occ)
+      e.RangeDay = i+1
+      e.RangeDays = days
+
+      // a date time range shows the time range on every day, while a plain
+      // date range only carries the times given at its ends
+      if !tr.IsRecurringRange() {
+        e.HasTime = (i == 0 && !tr.StartDate.DateOnly) || (i == days-1 && !tr.EndDate.DateOnly)
+        e.Start = day
+        e.End = time.Time{}
+        if i == 0 {
+          e.Start = a.startOf(occ)
+        }
+
+        if i == days-1 && i != 0 {
+          e.Start = a.startOf(tr.EndDate)
+        }
+      } else {
+        e.Start = atClock(day, occ.Start.In(a.Location))
+        e.End = atClock(day, occ.End.In(a.Location))
+      }
+
+      a.add(e, day)
+    }
+  }
+}
+
+func (a *Agenda) newEntry(doc *org.Document, n *org.Node, p *org.Planning, kind EntryKind, occ *org.Timestamp) *Entry {
+  var prio *org.HeadingPrioritySetting
+  if doc.BufferSettings != nil {
+    prio = doc.BufferSettings.Priorities
+  }
+
+  e := &Entry{
+    Kind: kind,
+    Node: n,
+    Document: doc,
+    Planning: p,
+    Start: a.startOf(occ),
+    HasTime: !occ.DateOnly,
+    Title: n.Heading.Text,
+    Category: n.Category(),
+    Todo: n.Heading.TodoKeyword,
+    Priority: n.Heading.Priority,
+    PriorityRank: prio.Rank(n.Heading.Priority),
+    Tags: n.EffectiveTags(tagInheritOpts(doc)),
+    DaysUntil: daysBetween(a.Today, a.startOf(occ)),
+  }
+
+  if !occ.End.IsZero() {
+    e.End = occ.End.In(a.Location)
+  }
+
+  return e
+}
+
+// Returns the start of the occurrence in the agenda's location, see startIn.
+func (a *Agenda) startOf(occ *org.Timestamp) time.Time {
+  return startIn(occ, a.Location)
+}
+
+// Returns the start of the timestamp in loc. Date only timestamps name a day
+// rather than an instant, so they keep their date.
+func startIn(ts *org.Timestamp, loc *time.Location) time.Time {
+  if ts.DateOnly {
+    y, m, d := ts.Start.Date()
+    return time.Date(y, m, d, 0, 0, 0, 0, loc)
+  }
+
+  return ts.Start.In(loc)
+}
+
+// Returns the timestamp with date only stamps localized to the agenda's
+// location, so their occurrences fall within the view on their own date
+// whatever zone they were read in.
+func (a *Agenda) localizeDates(tros org.TimestampRangeOrSexp) org.TimestampRangeOrSexp {
+  switch ts := tros.(type) {
+  case *org.Timestamp:
+    if ts.DateOnly {
+      return ts.Localize(a.Location)
+    }
+  case *org.RepeatStamp:
+    if ts.DateOnly {
+      return ts.Localize(a.Location)
+    }
+  case *org.TimestampRange:
+    if ts.StartDate != nil && ts.StartDate.DateOnly {
+      return ts.Localize(a.Location)
+    }
+  }
+
+  return tros
+}
+
+// Places the entry on the given day, dropping it if the day falls outside
+// the view.
+func (a *Agenda) add(e *Entry, day time.Time) {
+  d := a.day(day)
+  if d == nil {
+    return
+  }
+
+  e.Date = d.Date
+  e.setLabel(a.Today)
+
+  e.order = a.order
+  a.order++
+  d.Entries = append(d.Entries, e)
+}
+
+// Returns the day of the view holding t, or nil if t falls outside the view.
+func (a *Agenda) day(t time.Time) *Day {
+  i := daysBetween(a.Start, t.In(a.Location))
+  if i < 0 || i >= len(a.Days) {
+    return nil
+  }
+
+  return a.Days[i]
+}
+
+// Returns the timestamp's repetitions starting within [start, end), see
+// org.RepeatStamp.Occurrences.
+func occurrences(ts *org.Timestamp, cfg org.RepeatConfig, start, end time.Time) []*org.Timestamp {
+  out := make([]*org.Timestamp, 0)
+  for occ := range org.NewRepeatStampFromTimestamp(ts, cfg).Occurrences(start, end) {
+    if !occ.Start.Before(start) {
+      out = append(out, occ)
+    }
+  }
+
+  return out
+}
+
+// Returns the recurrence held by the node's RRULE property when the planning
+// element holds the timestamp it starts from, with ts, the planning's
+// timestamp in the node's zone, as its first occurrence.
+func recurrence(n *org.Node, p *org.Planning, ts *org.Timestamp) (*org.Recurrence, bool) {
+  rc, ok, err := n.Recurrence()
+  raw, isTs := p.TimestampRangeOrSexp.(*org.Timestamp)
+  if !ok || err != nil || !isTs || !rc.Start.Equal(raw.Start) {
+    return nil, false
+  }
+
+  rc.Start, rc.End = ts.Start, ts.End
+  return rc, true
+}
+
+func repeatConfig(ts *org.Timestamp) org.RepeatConfig {
+  cfg := org.DefaultRepeatConfig
+  cfg.Location = ts.Start.Location()
+
+  return cfg
+}
+
+func tagInheritOpts(doc *org.Document) org.TagInheritOpts {
+  if doc.BufferSettings != nil && doc.BufferSettings.TagInheritance != nil {
+    return *doc.BufferSettings.TagInheritance
+  }
+
+  return org.DefaultTagInheritOpts
+}
+
+// Returns true for nodes org excludes from agenda views: commented headings
+// and archived trees, along with their subtrees.
+func skipNode(n *org.Node) bool {
+  for cur := n; cur != nil; cur = cur.Parent() {
+    if cur.Heading == nil {
+      continue
+    }
+
+    if cur.Heading.IsComment {
+      return true
+    }
+
+    for _, t := range cur.Heading.Tags {
+      if t == "ARCHIVE" {
+        return true
+      }
+    }
+  }
+
+  return false
+}
+
+func midnight(t time.Time) time.Time {
+  y, m, d := t.Date()
+  return time.Date(y, m, d, 0, 0, 0, 0, t.Location())
+}
+
+// Returns t's time of day on the given day.
+func atClock(day, t time.Time) time.Time {
+  if t.IsZero() {
+    return time.Time{}
+  }
+
+  y, m, d := day.Date()
+  h, min, s := t.Clock()
+  return time.Date(y, m, d, h, min, s, 0, day.Location())
+}
+
+// Returns the number of calendar days from a to b, ignoring time of day.
+func daysBetween(a, b time.Time) int {
+  ay, am, ad := a.Date()
+  by, bm, bd := b.In(a.Location()).Date()
+  da := time.Date(ay, am, ad, 12, 0, 0, 0, time.UTC)
+  db := time.Date(by, bm, bd, 12, 0, 0, 0, time.UTC)
+
+  return int(db.Sub(da).Hours() / 24)
+}
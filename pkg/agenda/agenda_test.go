@@ -0,0 +1,265 @@
+package agenda
+
+import (
+	"testing"
+	"time"
+
+	"github.com/lcyvin/gorgeous/pkg/org"
+)
+
+func testingAgendaDocument() *org.Document {
+  loc := time.UTC
+  d := org.New()
+  d.BufferSettings.Category = "work"
+
+  d.AddHeading(1, "Standup", org.WithPriority(org.AlphaHeadingPriority("C")))
+  d.AddHeading(1, "Review", org.WithPriority(org.AlphaHeadingPriority("A")))
+  d.AddHeading(1, "Conference")
+  d.AddHeading(1, "Untimed")
+
+  standup := d.NodeTree.Subtree[0].Node.Heading
+  standup.TodoKeyword = "TODO"
+  standup.SetPlanning(&org.Planning{
+    PlanningKind: org.PLANNING_SCHEDULED,
+    TimestampRangeOrSexp: org.NewTimestamp(
+      time.Date(2050, 1, 3, 9, 0, 0, 0, loc),
+      org.WithEnd(time.Date(2050, 1, 3, 9, 15, 0, 0, loc)),
+      org.WithRepeat(&org.Repeat{
+        Kind: org.REPEAT_KIND_SHIFT,
+        IntervalAmount: 1,
+        Interval: org.REPEAT_INTERVAL_DAY,
+      })),
+  })
+
+  review := d.NodeTree.Subtree[1].Node.Heading
+  review.SetPlanning(&org.Planning{
+    PlanningKind: org.PLANNING_DEADLINE,
+    TimestampRangeOrSexp: org.NewTimestamp(time.Date(2050, 1, 5, 9, 0, 0, 0, loc)),
+  })
+
+  conf := d.NodeTree.Subtree[2].Node
+  conf.SetProperty("CATEGORY", "travel")
+  tr, _ := org.NewTimestampRange(
+    org.NewTimestamp(time.Date(2050, 1, 4, 0, 0, 0, 0, loc), org.WithDateOnly()),
+    org.NewTimestamp(time.Date(2050, 1, 6, 0, 0, 0, 0, loc), org.WithDateOnly()),
+  )
+  conf.Heading.SetPlanning(&org.Planning{
+    PlanningKind: org.PLANNING_EVENT,
+    TimestampRangeOrSexp: tr,
+  })
+
+  untimed := d.NodeTree.Subtree[3].Node.Heading
+  untimed.SetPlanning(&org.Planning{
+    PlanningKind: org.PLANNING_EVENT,
+    TimestampRangeOrSexp: org.NewTimestamp(time.Date(2050, 1, 5, 0, 0, 0, 0, loc), org.WithDateOnly()),
+  })
+
+  return d
+}
+
+func TestWeekView(t *testing.T) {
+  d := testingAgendaDocument()
+  a := WeekView([]*org.Document{d}, time.Date(2050, 1, 5, 12, 0, 0, 0, time.UTC))
+
+  if len(a.Days) != 7 || a.Days[0].Date.Weekday() != time.Monday {
+    t.Fatalf("WeekView() days = %d starting %v", len(a.Days), a.Days[0].Date.Weekday())
+  }
+
+  // Monday 2050-01-03 through Sunday 2050-01-09
+  counts := []int{1, 2, 4, 2, 1, 1, 1}
+  for i, day := range a.Days {
+    if len(day.Entries) != counts[i] {
+      t.Errorf("%s has %d entries, want %d", day.Date.Format(time.DateOnly), len(day.Entries), counts[i])
+    }
+  }
+
+  wed := a.Days[2].Entries
+  wantTitles := []string{"Review", "Standup", "Conference", "Untimed"}
+  for i, e := range wed {
+    if e.Title != wantTitles[i] {
+      t.Errorf("entry %d = %s, want %s", i, e.Title, wantTitles[i])
+    }
+  }
+
+  if wed[1].TimeString() != "09:00-09:15" || wed[2].RangeString() != "(2/3)" || wed[2].Category != "travel" {
+    t.Errorf("unexpected entry metadata: %q %q %q", wed[1].TimeString(), wed[2].RangeString(), wed[2].Category)
+  }
+}
+
+func TestDayViewWarningsAndDelays(t *testing.T) {
+  loc := time.UTC
+  today := time.Date(2050, 1, 10, 8, 0, 0, 0, loc)
+  d := org.New()
+
+  plan := func(title string, kind org.PlanningKind, ts *org.Timestamp) {
+    d.AddHeading(1, title)
+    h := d.NodeTree.Subtree[len(d.NodeTree.Subtree)-1].Node.Heading
+    h.TodoKeyword = "TODO"
+    h.SetPlanning(&org.Planning{PlanningKind: kind, TimestampRangeOrSexp: ts})
+  }
+
+  day := func(dd int) time.Time {
+    return time.Date(2050, 1, dd, 0, 0, 0, 0, loc)
+  }
+
+  warn, _ := org.ParseDelay("-3d")
+  delay, _ := org.ParseDelay("-2d")
+
+  plan("Late", org.PLANNING_SCHEDULED, org.NewTimestamp(day(5), org.WithDateOnly()))
+  plan("Soon", org.PLANNING_DEADLINE, org.NewTimestamp(day(13), org.WithDateOnly(), org.WithDelay(warn)))
+  plan("Far", org.PLANNING_DEADLINE, org.NewTimestamp(day(14), org.WithDateOnly(), org.WithDelay(warn)))
+  plan("Missed", org.PLANNING_DEADLINE, org.NewTimestamp(day(8), org.WithDateOnly()))
+  plan("Delayed", org.PLANNING_SCHEDULED, org.NewTimestamp(day(9), org.WithDateOnly(), org.WithDelay(delay)))
+  plan("Waiting", org.PLANNING_SCHEDULED, org.NewTimestamp(day(8), org.WithDateOnly(), org.WithDelay(delay)))
+
+  a := DayView([]*org.Document{d}, today, WithToday(today))
+  want := map[string]string{
+    "Late": "Sched. 5x:",
+    "Soon": "In 3 d.:",
+    "Missed": "2 d. ago:",
+    "Waiting": "Sched. 2x:",
+  }
+
+  got := a.Days[0].Entries
+  if len(got) != len(want) {
+    t.Fatalf("DayView() returned %d entries, want %d", len(got), len(want))
+  }
+
+  for _, e := range got {
+    if want[e.Title] != e.Label {
+      t.Errorf("%s label = %q, want %q", e.Title, e.Label, want[e.Title])
+    }
+  }
+
+  a = DayView([]*org.Document{d}, day(11), WithToday(today))
+  if len(a.Days[0].Entries) != 1 || a.Days[0].Entries[0].Title != "Delayed" {
+    t.Errorf("delayed item should show on 2050-01-11, got %v", a.Days[0].Entries)
+  }
+}
+
+func TestAgendaDiarySexps(t *testing.T) {
+  d := org.New()
+  d.AddHeading(1, "Team sync")
+  d.AddHeading(1, "Birthdays")
+
+  sync := d.NodeTree.Subtree[0].Node.Heading
+  ts, err := org.ParseTimestamp("<%%(diary-float t 4 2) 15:00-16:00>")
+  if err != nil {
+    t.Fatal(err)
+  }
+  sync.SetPlanning(&org.Planning{PlanningKind: org.PLANNING_EVENT, TimestampRangeOrSexp: ts})
+
+  ds, err := org.ParseDiarySexp("%%(diary-anniversary 1 14 2000) Ada turns 50", "")
+  if err != nil {
+    t.Fatal(err)
+  }
+  birthdays := d.NodeTree.Subtree[1].Node
+  birthdays.Section = &org.Section{Heading: birthdays.Heading, Elements: []org.Element{ds}}
+
+  a := WeekView([]*org.Document{d}, time.Date(2050, 1, 12, 0, 0, 0, 0, time.UTC))
+  got := a.Entries()
+  if len(got) != 2 {
+    t.Fatalf("WeekView() returned %d entries, want 2", len(got))
+  }
+
+  if got[0].Title != "Team sync" || got[0].Kind != ENTRY_TIMESTAMP || got[0].TimeString() != "15:00-16:00" || got[0].Date.Day() != 13 {
+    t.Errorf("sexp timestamp entry = %s %s %q on %v", got[0].Title, got[0].Kind, got[0].TimeString(), got[0].Date)
+  }
+
+  if got[1].Title != "Ada turns 50" || got[1].Kind != ENTRY_SEXP || got[1].Date.Day() != 14 || got[1].Planning != nil {
+    t.Errorf("diary sexp entry = %s %s on %v", got[1].Title, got[1].Kind, got[1].Date)
+  }
+}
+
+func TestAgendaTimeZones(t *testing.T) {
+  ny, err := time.LoadLocation("America/New_York")
+  if err != nil {
+    t.Skip(err)
+  }
+
+  d := org.New()
+  d.AddHeading(1, "Call with New York")
+  n := d.NodeTree.Subtree[0].Node
+  n.SetTimeZone(ny)
+
+  ts, _ := org.ParseTimestamp("<2050-03-10 Thu 20:00-21:00 +1w>", org.WithParseLocation(time.UTC))
+  n.Heading.SetPlanning(&org.Planning{PlanningKind: org.PLANNING_EVENT, TimestampRangeOrSexp: ts})
+
+  // 20:00 in New York falls on the following day in UTC, an hour earlier
+  // once daylight saving time starts there
+  a := New([]*org.Document{d}, time.Date(2050, 3, 7, 0, 0, 0, 0, time.UTC), time.Date(2050, 3, 21, 0, 0, 0, 0, time.UTC))
+  got := a.Entries()
+  if len(got) != 2 {
+    t.Fatalf("New() returned %d entries, want 2", len(got))
+  }
+
+  want := []string{"2050-03-11 01:00-02:00", "2050-03-18 00:00-01:00"}
+  for i, e := range got {
+    if s := e.Date.Format(time.DateOnly) + " " + e.TimeString(); s != want[i] {
+      t.Errorf("entry %d = %s, want %s", i, s, want[i])
+    }
+  }
+}
+
+// Date only timestamps name a day, so they stay on it whatever zone they were
+// read in.
+func TestAgendaDateOnlyTimeZones(t *testing.T) {
+  ny, err := time.LoadLocation("America/New_York")
+  if err != nil {
+    t.Skip(err)
+  }
+
+  tokyo, err := time.LoadLocation("Asia/Tokyo")
+  if err != nil {
+    t.Skip(err)
+  }
+
+  d := org.New()
+  d.AddHeading(1, "Tokyo holiday")
+  d.AddHeading(1, "Dentist")
+  holiday := d.NodeTree.Subtree[0].Node
+  holiday.SetTimeZone(tokyo)
+  dentist := d.NodeTree.Subtree[1].Node
+
+  for _, n := range []*org.Node{holiday, dentist} {
+    ts, _ := org.ParseTimestamp("<2050-01-06 Thu>", org.WithParseLocation(time.UTC))
+    n.Heading.SetPlanning(&org.Planning{PlanningKind: org.PLANNING_EVENT, TimestampRangeOrSexp: ts})
+  }
+
+  day := DayView([]*org.Document{d}, time.Date(2050, 1, 6, 0, 0, 0, 0, ny), WithLocation(ny))
+  if got := day.Entries(); len(got) != 2 {
+    t.Errorf("DayView() returned %d entries, want 2", len(got))
+  }
+
+  week := WeekView([]*org.Document{d}, time.Date(2050, 1, 6, 0, 0, 0, 0, ny), WithLocation(ny))
+  for _, e := range week.Entries() {
+    if e.Date.Format(time.DateOnly) != "2050-01-06" {
+      t.Errorf("%s is on %v, want 2050-01-06", e.Title, e.Date)
+    }
+  }
+}
+
+func TestAgendaRRule(t *testing.T) {
+  d := org.New()
+  d.AddHeading(1, "Standup")
+  n := d.NodeTree.Subtree[0].Node
+
+  rule, _ := org.ParseRRule("FREQ=WEEKLY;BYDAY=MO,WE,FR", time.UTC)
+  start := time.Date(2050, 1, 3, 9, 0, 0, 0, time.UTC)
+  rc := org.NewRecurrence(start, rule)
+  rc.ExDates = []time.Time{start.AddDate(0, 0, 7)}
+  n.SetRecurrence(org.PLANNING_SCHEDULED, rc)
+
+  a := New([]*org.Document{d}, time.Date(2050, 1, 5, 0, 0, 0, 0, time.UTC), time.Date(2050, 1, 15, 0, 0, 0, 0, time.UTC))
+  got := a.Entries()
+  want := []string{"2050-01-05", "2050-01-07", "2050-01-12", "2050-01-14"}
+  if len(got) != len(want) {
+    t.Fatalf("New() returned %d entries, want %d", len(got), len(want))
+  }
+
+  for i, e := range got {
+    if s := e.Date.Format(time.DateOnly); s != want[i] || e.TimeString() != "09:00" {
+      t.Errorf("entry %d = %s %s, want %s 09:00", i, s, e.TimeString(), want[i])
+    }
+  }
+}
@@ -0,0 +1,433 @@
+package agenda
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lcyvin/gorgeous/pkg/org"
+)
+
+// Command is a named composite agenda view, mirroring an entry of
+// org-agenda-custom-commands. Commands are plain data so they can be loaded
+// from a file with LoadCommands, E.G.:
+//
+//     [{
+//       "key": "w",
+//       "name": "Work overview",
+//       "settings": {"skip": ["done"]},
+//       "blocks": [
+//         {"type": "agenda", "span": 1},
+//         {"type": "tags-todo", "match": "work-someday", "title": "Work"},
+//         {"type": "todo", "match": "WAIT", "settings": {"sorting": ["category-up"]}}
+//       ]
+//     }]
+type Command struct {
+  // The key selecting the command, as in org's agenda dispatcher.
+  Key       string    `json:"key"`
+  Name      string    `json:"name"`
+  Blocks    []*Block  `json:"blocks"`
+  // Settings applied to every block, unless overridden by the block.
+  Settings  *Settings `json:"settings,omitempty"`
+}
+
+// Block is a single view within a Command.
+type Block struct {
+  Kind      BlockKind `json:"type"`
+  // Shown in place of the block's default header, mirroring
+  // org-agenda-overriding-header.
+  Title     string    `json:"title,omitempty"`
+  // For tags and tags-todo blocks, the match string. For todo blocks, the
+  // keywords listed separated by "|", E.G., "TODO|WAIT". Empty lists every
+  // open todo.
+  Match     string    `json:"match,omitempty"`
+  // For agenda blocks, the number of days shown starting today. Zero shows
+  // the current week, and negative spans are rejected.
+  Span      int       `json:"span,omitempty"`
+  Settings  *Settings `json:"settings,omitempty"`
+}
+
+type BlockKind string
+
+const (
+  BLOCK_AGENDA    BlockKind = "agenda"
+  BLOCK_TODO      BlockKind = "todo"
+  BLOCK_TAGS      BlockKind = "tags"
+  BLOCK_TAGS_TODO BlockKind = "tags-todo"
+)
+
+// Settings overrides the defaults of the view built for a block. Unset fields
+// leave the default, or the command's setting, in place.
+type Settings struct {
+  Sorting             []SortKey     `json:"sorting,omitempty"`
+  // Names of skip functions, see RegisterSkipFunc.
+  Skip                []string      `json:"skip,omitempty"`
+  DeadlineWarningDays *int          `json:"deadline_warning_days,omitempty"`
+  SkipScheduled       ScheduledSkip `json:"skip_scheduled,omitempty"`
+  // Skips headings with a deadline within this many days, see
+  // TodoList.SkipDeadlines.
+  SkipDeadlines       *int          `json:"skip_deadlines,omitempty"`
+  GroupBy             GroupKey      `json:"group_by,omitempty"`
+}
+
+// View is the result of running a Command, holding one view per block.
+type View struct {
+  Command *Command
+  Blocks  []*BlockView
+}
+
+// BlockView holds the view built for a single block. Agenda is set for
+// agenda blocks, List for every other kind.
+type BlockView struct {
+  Block   *Block
+  Title   string
+  Agenda  *Agenda
+  List    *TodoList
+}
+
+// SkipFunc returns true for headings to be left out of a view, mirroring
+// org-agenda-skip-function.
+type SkipFunc func(n *org.Node) bool
+
+var (
+  skipFuncsMu sync.RWMutex
+  skipFuncs = map[string]SkipFunc{
+    "scheduled": func(n *org.Node) bool {
+      return n.Heading.GetPlanning(org.PLANNING_SCHEDULED) != nil
+    },
+    "not-scheduled": func(n *org.Node) bool {
+      return n.Heading.GetPlanning(org.PLANNING_SCHEDULED) == nil
+    },
+    "deadline": func(n *org.Node) bool {
+      return n.Heading.GetPlanning(org.PLANNING_DEADLINE) != nil
+    },
+    "not-deadline": func(n *org.Node) bool {
+      return n.Heading.GetPlanning(org.PLANNING_DEADLINE) == nil
+    },
+    "todo": func(n *org.Node) bool {
+      return n.Heading.TodoKeyword != "" && !n.Heading.IsDone()
+    },
+    "not-todo": func(n *org.Node) bool {
+      return n.Heading.TodoKeyword == ""
+    },
+    "done": func(n *org.Node) bool {
+      return n.Heading.IsDone()
+    },
+  }
+)
+
+// RegisterSkipFunc makes a skip function available to commands under the
+// given name, replacing any function already registered with it. The
+// conditions of org-agenda-skip-entry-if are registered by default as
+// "scheduled", "not-scheduled", "deadline", "not-deadline", "todo",
+// "not-todo" and "done".
+func RegisterSkipFunc(name string, fn SkipFunc) {
+  skipFuncsMu.Lock()
+  defer skipFuncsMu.Unlock()
+
+  skipFuncs[name] = fn
+}
+
+// Returns the skip function registered with the given name.
+func LookupSkipFunc(name string) (SkipFunc, bool) {
+  skipFuncsMu.RLock()
+  defer skipFuncsMu.RUnlock()
+
+  fn, ok := skipFuncs[name]
+  return fn, ok
+}
+
+func skipped(fns []SkipFunc, n *org.Node) bool {
+  for _, fn := range fns {
+    if fn(n) {
+      return true
+    }
+  }
+
+  return false
+}
+
+// LoadCommands decodes a JSON array of commands from r, validating each.
+func LoadCommands(r io.Reader) ([]*Command, error) {
+  cmds := make([]*Command, 0)
+
+  dec := json.NewDecoder(r)
+  dec.DisallowUnknownFields()
+  if err := dec.Decode(&cmds); err != nil {
+    return nil, err
+  }
+
+  for _, c := range cmds {
+    if err := c.Validate(); err != nil {
+      return nil, err
+    }
+  }
+
+  return cmds, nil
+}
+
+// LoadCommandsFile loads commands from the JSON file at path.
+func LoadCommandsFile(path string) ([]*Command, error) {
+  f, err := os.Open(path)
+  if err != nil {
+    return nil, err
+  }
+  defer f.Close()
+
+  return LoadCommands(f)
+}
+
+// Returns the command with the given key, or nil if there is none.
+func FindCommand(cmds []*Command, key string) *Command {
+  for _, c := range cmds {
+    if c.Key == key {
+      return c
+    }
+  }
+
+  return nil
+}
+
+// Validate checks the command's block kinds, match strings and skip function
+// names.
+func (c *Command) Validate() error {
+  if err := c.Settings.validate(c); err != nil {
+    return err
+  }
+
+  for _, b := range c.Blocks {
+    switch b.Kind {
+    case BLOCK_AGENDA, BLOCK_TODO:
+    case BLOCK_TAGS, BLOCK_TAGS_TODO:
+      if _, err := org.ParseMatch(b.Match); err != nil {
+        return err
+      }
+    default:
+      return NewInvalidBlockKindError(c, b.Kind)
+    }
+
+    if b.Span < 0 {
+      return NewInvalidSettingError(c, "span", strconv.Itoa(b.Span))
+    }
+
+    if err := b.Settings.validate(c); err != nil {
+      return err
+    }
+  }
+
+  return nil
+}
+
+func (s *Settings) validate(c *Command) error {
+  if s == nil {
+    return nil
+  }
+
+  for _, name := range s.Skip {
+    if _, ok := LookupSkipFunc(name); !ok {
+      return NewUnknownSkipFuncError(c, name)
+    }
+  }
+
+  for _, k := range s.Sorting {
+    if !slices.Contains(sortKeys, k) {
+      return NewInvalidSettingError(c, "sorting", string(k))
+    }
+  }
+
+  if !slices.Contains(groupKeys, s.GroupBy) {
+    return NewInvalidSettingError(c, "group_by", string(s.GroupBy))
+  }
+
+  if !slices.Contains(scheduledSkips, s.SkipScheduled) {
+    return NewInvalidSettingError(c, "skip_scheduled", string(s.SkipScheduled))
+  }
+
+  return nil
+}
+
+var (
+  sortKeys = []SortKey{
+    SORT_TIME_UP, SORT_TIME_DOWN, SORT_PRIORITY_UP, SORT_PRIORITY_DOWN,
+    SORT_CATEGORY_KEEP, SORT_CATEGORY_UP, SORT_CATEGORY_DOWN,
+    SORT_ALPHA_UP, SORT_ALPHA_DOWN, SORT_TODO_STATE_UP, SORT_TODO_STATE_DOWN,
+  }
+  groupKeys = []GroupKey{GROUP_NONE, GROUP_CATEGORY, GROUP_TODO, GROUP_PRIORITY, GROUP_TAG}
+  scheduledSkips = []ScheduledSkip{
+    SKIP_SCHEDULED_NONE, SKIP_SCHEDULED_ALL, SKIP_SCHEDULED_FUTURE, SKIP_SCHEDULED_PAST,
+  }
+)
+
+// Run builds the view of each of the command's blocks over docs, with today
+// as the current day.
+func (c *Command) Run(docs []*org.Document, today time.Time) (*View, error) {
+  if err := c.Validate(); err != nil {
+    return nil, err
+  }
+
+  v := &View{Command: c, Blocks: make([]*BlockView, 0)}
+  for _, b := range c.Blocks {
+    s := c.Settings.merge(b.Settings)
+    bv := &BlockView{Block: b, Title: b.Title}
+
+    switch b.Kind {
+    case BLOCK_AGENDA:
+      bv.Agenda = b.agenda(docs, today, s)
+    case BLOCK_TODO:
+      opts := s.listOpts(today)
+      if b.Match != "" {
+        opts = append(opts, WithListKeywords(strings.Split(b.Match, "|")...))
+      }
+
+      bv.List = TodoView(docs, opts...)
+    case BLOCK_TAGS, BLOCK_TAGS_TODO:
+      tl, err := TagsView(docs, b.Match, b.Kind == BLOCK_TAGS_TODO, s.listOpts(today)...)
+      if err != nil {
+        return nil, err
+      }
+
+      bv.List = tl
+    }
+
+    v.Blocks = append(v.Blocks, bv)
+  }
+
+  return v, nil
+}
+
+func (b *Block) agenda(docs []*org.Document, today time.Time, s *Settings) *Agenda {
+  opts := []AgendaOpt{WithToday(today)}
+  if s.Sorting != nil {
+    opts = append(opts, WithSorting(s.Sorting...))
+  }
+
+  if s.DeadlineWarningDays != nil {
+    opts = append(opts, WithDeadlineWarningDays(*s.DeadlineWarningDays))
+  }
+
+  opts = append(opts, WithSkip(s.skipFuncs()...))
+
+  switch b.Span {
+  case 0:
+    return WeekView(docs, today, opts...)
+  case 1:
+    return DayView(docs, today, opts...)
+  }
+
+  start := midnight(today)
+  return New(docs, start, start.AddDate(0, 0, b.Span), opts...)
+}
+
+func (s *Settings) listOpts(today time.Time) []TodoListOpt {
+  opts := []TodoListOpt{
+    WithListToday(today),
+    WithListLocation(today.Location()),
+    WithListSkipScheduled(s.SkipScheduled),
+    WithListGrouping(s.GroupBy),
+    WithListSkip(s.skipFuncs()...),
+  }
+
+  if s.Sorting != nil {
+    opts = append(opts, WithListSorting(s.Sorting...))
+  }
+
+  if s.SkipDeadlines != nil {
+    opts = append(opts, WithListSkipDeadlines(*s.SkipDeadlines))
+  }
+
+  return opts
+}
+
+func (s *Settings) skipFuncs() []SkipFunc {
+  out := make([]SkipFunc, 0)
+  for _, name := range s.Skip {
+    if fn, ok := LookupSkipFunc(name); ok {
+      out = append(out, fn)
+    }
+  }
+
+  return out
+}
+
+// Returns the settings resulting from applying over on top of s. Either may
+// be nil.
+func (s *Settings) merge(over *Settings) *Settings {
+  out := &Settings{}
+  for _, v := range []*Settings{s, over} {
+    if v == nil {
+      continue
+    }
+
+    if v.Sorting != nil {
+      out.Sorting = v.Sorting
+    }
+
+    if v.Skip != nil {
+      out.Skip = v.Skip
+    }
+
+    if v.DeadlineWarningDays != nil {
+      out.DeadlineWarningDays = v.DeadlineWarningDays
+    }
+
+    if v.SkipScheduled != SKIP_SCHEDULED_NONE {
+      out.SkipScheduled = v.SkipScheduled
+    }
+
+    if v.SkipDeadlines != nil {
+      out.SkipDeadlines = v.SkipDeadlines
+    }
+
+    if v.GroupBy != GROUP_NONE {
+      out.GroupBy = v.GroupBy
+    }
+  }
+
+  return out
+}
+
+type InvalidBlockKindError struct {
+  Command string
+  Kind    BlockKind
+}
+
+func (ibke InvalidBlockKindError) Error() string {
+  return fmt.Sprintf("Agenda command %q holds a block of unknown type %q", ibke.Command, ibke.Kind)
+}
+
+func NewInvalidBlockKindError(c *Command, k BlockKind) *InvalidBlockKindError {
+  return &InvalidBlockKindError{Command: c.Key, Kind: k}
+}
+
+type UnknownSkipFuncError struct {
+  Command string
+  Name    string
+}
+
+func (usfe UnknownSkipFuncError) Error() string {
+  return fmt.Sprintf("Agenda command %q refers to unregistered skip function %q", usfe.Command, usfe.Name)
+}
+
+func NewUnknownSkipFuncError(c *Command, name string) *UnknownSkipFuncError {
+  return &UnknownSkipFuncError{Command: c.Key, Name: name}
+}
+
+type InvalidSettingError struct {
+  Command string
+  Key     string
+  Value   string
+}
+
+func (ise InvalidSettingError) Error() string {
+  return fmt.Sprintf("Agenda command %q sets %s to unknown value %q", ise.Command, ise.Key, ise.Value)
+}
+
+func NewInvalidSettingError(c *Command, key, value string) *InvalidSettingError {
+  return &InvalidSettingError{Command: c.Key, Key: key, Value: value}
+}
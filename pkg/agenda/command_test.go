@@ -0,0 +1,96 @@
+package agenda
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lcyvin/gorgeous/pkg/org"
+)
+
+const testingCommands = `[{
+  "key": "h",
+  "name": "Home",
+  "settings": {"skip": ["scheduled"]},
+  "blocks": [
+    {"type": "agenda", "span": 1},
+    {"type": "tags-todo", "match": "chore", "title": "Chores"},
+    {"type": "todo", "match": "NEXT|WAIT", "settings": {"skip": ["no-effort"]}},
+    {"type": "tags", "match": "Effort>0", "settings": {"skip": [], "sorting": ["alpha-up"]}}
+  ]
+}]`
+
+func TestCommandRun(t *testing.T) {
+  RegisterSkipFunc("no-effort", func(n *org.Node) bool {
+    _, ok := n.Property("Effort")
+    return !ok
+  })
+
+  cmds, err := LoadCommands(strings.NewReader(testingCommands))
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  cmd := FindCommand(cmds, "h")
+  if cmd == nil {
+    t.Fatal("FindCommand(h) = nil")
+  }
+
+  d := testingTodoListDocument(t)
+  v, err := cmd.Run([]*org.Document{d}, time.Date(2050, 1, 3, 12, 0, 0, 0, time.UTC))
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  if len(v.Blocks) != 4 || v.Blocks[0].Agenda == nil || v.Blocks[1].Title != "Chores" {
+    t.Fatalf("Run() produced unexpected blocks")
+  }
+
+  if got := v.Blocks[0].Agenda.Entries(); len(got) != 1 || got[0].Title != "Dentist" {
+    t.Errorf("agenda block = %v, want [Dentist]", todoListTitles(got))
+  }
+
+  want := [][]string{
+    {"Laundry"},
+    {"Taxes", "Groceries"},
+    {"Groceries", "Taxes"},
+  }
+
+  for i, w := range want {
+    got := todoListTitles(v.Blocks[i+1].List.Entries)
+    if strings.Join(got, ",") != strings.Join(w, ",") {
+      t.Errorf("block %d = %v, want %v", i+1, got, w)
+    }
+  }
+}
+
+func TestLoadCommandsInvalid(t *testing.T) {
+  tests := []string{
+    `[{"key": "x", "blocks": [{"type": "calendar"}]}]`,
+    `[{"key": "x", "blocks": [{"type": "tags", "match": "{unterminated"}]}]`,
+    `[{"key": "x", "settings": {"skip": ["missing"]}, "blocks": []}]`,
+    `[{"key": "x", "blocks": [], "unknown": true}]`,
+    `[{"key": "x", "settings": {"sorting": ["time-upp"]}, "blocks": []}]`,
+    `[{"key": "x", "blocks": [{"type": "todo", "settings": {"group_by": "categroy"}}]}]`,
+    `[{"key": "x", "settings": {"skip_scheduled": "futur"}, "blocks": []}]`,
+    `[{"key": "x", "blocks": [{"type": "agenda", "span": -3}]}]`,
+  }
+
+  for _, tt := range tests {
+    if _, err := LoadCommands(strings.NewReader(tt)); err == nil {
+      t.Errorf("LoadCommands(%s) did not fail", tt)
+    }
+  }
+
+  _, err := LoadCommands(strings.NewReader(`[{"key": "x", "settings": {"group_by": "categroy"}, "blocks": []}]`))
+  var ise *InvalidSettingError
+  if !errors.As(err, &ise) || ise.Key != "group_by" || ise.Value != "categroy" {
+    t.Errorf("LoadCommands() error = %v, want an InvalidSettingError for group_by", err)
+  }
+
+  _, err = LoadCommands(strings.NewReader(`[{"key": "x", "blocks": [{"type": "agenda", "span": -3}]}]`))
+  if !errors.As(err, &ise) || ise.Key != "span" || ise.Value != "-3" {
+    t.Errorf("LoadCommands() error = %v, want an InvalidSettingError for span", err)
+  }
+}
@@ -0,0 +1,138 @@
+package agenda
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/lcyvin/gorgeous/pkg/org"
+)
+
+// Entry is a single line of an agenda view, referring to the node it was
+// generated from along with the occurrence that placed it on its day.
+type Entry struct {
+  Kind      EntryKind
+  Node      *org.Node
+  Document  *org.Document
+  // The planning element the entry was generated from, nil for entries
+  // generated from diary sexp lines.
+  Planning  *org.Planning
+
+  // The day the entry is shown on, at midnight in the agenda's location.
+  Date      time.Time
+  // The start and (if defined) end of the occurrence shown. For repeating
+  // timestamps these hold the expanded repetition rather than the base
+  // timestamp.
+  Start     time.Time
+  End       time.Time
+  // False for date-only timestamps, in which case Start holds midnight.
+  HasTime   bool
+
+  Title     string
+  Category  string
+  Todo      string
+  // Sortable rank of Todo, its position across the document's todo
+  // sequences. Only set for todo and tags list entries.
+  TodoRank  int
+  Priority  org.HeadingPriority
+  // Sortable rank of Priority, lower values are more significant. See
+  // org.HeadingPrioritySetting.Rank.
+  PriorityRank int
+  Tags      []org.EffectiveTag
+
+  // The number of days from the agenda's today to the occurrence, negative
+  // for occurrences in the past. For overdue and warning entries, which are
+  // shown on today rather than their own day, this is how overdue or how far
+  // ahead the occurrence is.
+  DaysUntil int
+  // The leader org shows before scheduled and deadline entries, E.G.,
+  // "Scheduled:", "Sched. 5x:", "Deadline:", "In 3 d.:" or "2 d. ago:".
+  // Empty for other entries.
+  Label     string
+
+  // For entries generated from a date range, the 1-based day of the range
+  // being shown and the total number of days in the range. Zero otherwise.
+  RangeDay  int
+  RangeDays int
+
+  // the order in which the entry was generated, used for stable sorting
+  order     int
+}
+
+// Returns the entry's time of day as shown in an agenda, E.G., "10:00" or
+// "10:00-11:30", or an empty string for entries without a time.
+func (e *Entry) TimeString() string {
+  if !e.HasTime {
+    return ""
+  }
+
+  out := fmt.Sprintf("%02d:%02d", e.Start.Hour(), e.Start.Minute())
+  if !e.End.IsZero() && e.End.After(e.Start) {
+    out += fmt.Sprintf("-%02d:%02d", e.End.Hour(), e.End.Minute())
+  }
+
+  return out
+}
+
+// Returns the "(2/3)" style marker org shows for entries of a date range, or
+// an empty string for other entries.
+func (e *Entry) RangeString() string {
+  if e.RangeDays == 0 {
+    return ""
+  }
+
+  return fmt.Sprintf("(%d/%d)", e.RangeDay, e.RangeDays)
+}
+
+// Sets the entry's label based on its kind and how far its occurrence is from
+// the day it is shown on.
+func (e *Entry) setLabel(today time.Time) {
+  shownToday := e.Date.Equal(today)
+
+  switch e.Kind {
+  case ENTRY_SCHEDULED:
+    e.Label = "Scheduled:"
+    if shownToday && e.DaysUntil < 0 {
+      e.Label = fmt.Sprintf("Sched. %dx:", -e.DaysUntil)
+    }
+  case ENTRY_DEADLINE:
+    e.Label = "Deadline:"
+    if shownToday && e.DaysUntil > 0 {
+      e.Label = fmt.Sprintf("In %d d.:", e.DaysUntil)
+    }
+
+    if shownToday && e.DaysUntil < 0 {
+      e.Label = fmt.Sprintf("%d d. ago:", -e.DaysUntil)
+    }
+  }
+}
+
+type EntryKind string
+
+const (
+  ENTRY_SCHEDULED EntryKind = "scheduled"
+  ENTRY_DEADLINE  EntryKind = "deadline"
+  // a plain active timestamp, held by an event planning element
+  ENTRY_TIMESTAMP EntryKind = "timestamp"
+  // a day within a date range, E.G., <2050-01-01 Sat>--<2050-01-03 Mon>
+  ENTRY_RANGE     EntryKind = "block"
+  // a day matched by a diary sexp line in a heading's section, E.G.,
+  // %%(diary-anniversary 10 31 1948) Arthur's birthday
+  ENTRY_SEXP      EntryKind = "sexp"
+  // a heading listed by a global todo list
+  ENTRY_TODO      EntryKind = "todo"
+  // a heading listed by a tags view
+  ENTRY_TAGS      EntryKind = "tags"
+)
+
+func entryKind(pk org.PlanningKind) (EntryKind, bool) {
+  switch pk {
+  case org.PLANNING_SCHEDULED:
+    return ENTRY_SCHEDULED, true
+  case org.PLANNING_DEADLINE:
+    return ENTRY_DEADLINE, true
+  case org.PLANNING_EVENT:
+    return ENTRY_TIMESTAMP, true
+  }
+
+  return "", false
+}
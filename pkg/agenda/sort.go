@@ -0,0 +1,104 @@
+package agenda
+
+import (
+	"sort"
+	"strings"
+)
+
+// SortKey mirrors a single entry of org-agenda-sorting-strategy.
+type SortKey string
+
+const (
+  // entries with a time of day first, earliest first
+  SORT_TIME_UP        SortKey = "time-up"
+  // entries with a time of day first, latest first
+  SORT_TIME_DOWN      SortKey = "time-down"
+  SORT_PRIORITY_UP    SortKey = "priority-up"
+  SORT_PRIORITY_DOWN  SortKey = "priority-down"
+  // keep categories in the order their documents were given
+  SORT_CATEGORY_KEEP  SortKey = "category-keep"
+  SORT_CATEGORY_UP    SortKey = "category-up"
+  SORT_CATEGORY_DOWN  SortKey = "category-down"
+  SORT_ALPHA_UP       SortKey = "alpha-up"
+  SORT_ALPHA_DOWN     SortKey = "alpha-down"
+  // entries ordered by the position of their keyword in the todo sequences
+  SORT_TODO_STATE_UP    SortKey = "todo-state-up"
+  SORT_TODO_STATE_DOWN  SortKey = "todo-state-down"
+)
+
+// DefaultSorting matches org's default sorting strategy for agenda views.
+var DefaultSorting []SortKey = []SortKey{
+  SORT_TIME_UP,
+  SORT_PRIORITY_DOWN,
+  SORT_CATEGORY_KEEP,
+}
+
+// SortEntries sorts entries in place, comparing by each key in turn. Entries
+// which compare equal under every key keep the order they were generated in.
+func SortEntries(entries []*Entry, keys []SortKey) {
+  sort.SliceStable(entries, func(i, j int) bool {
+    for _, k := range keys {
+      if c := compareEntries(k, entries[i], entries[j]); c != 0 {
+        return c < 0
+      }
+    }
+
+    return entries[i].order < entries[j].order
+  })
+}
+
+func compareEntries(k SortKey, a, b *Entry) int {
+  switch k {
+  case SORT_TIME_UP, SORT_TIME_DOWN:
+    if a.HasTime != b.HasTime {
+      if a.HasTime {
+        return -1
+      }
+      return 1
+    }
+
+    if !a.HasTime {
+      return 0
+    }
+
+    c := compareInts(clockSeconds(a), clockSeconds(b))
+    if k == SORT_TIME_DOWN {
+      return -c
+    }
+    return c
+  case SORT_PRIORITY_DOWN:
+    return compareInts(a.PriorityRank, b.PriorityRank)
+  case SORT_PRIORITY_UP:
+    return compareInts(b.PriorityRank, a.PriorityRank)
+  case SORT_CATEGORY_UP:
+    return strings.Compare(a.Category, b.Category)
+  case SORT_CATEGORY_DOWN:
+    return strings.Compare(b.Category, a.Category)
+  case SORT_ALPHA_UP:
+    return strings.Compare(a.Title, b.Title)
+  case SORT_ALPHA_DOWN:
+    return strings.Compare(b.Title, a.Title)
+  case SORT_TODO_STATE_UP:
+    return compareInts(a.TodoRank, b.TodoRank)
+  case SORT_TODO_STATE_DOWN:
+    return compareInts(b.TodoRank, a.TodoRank)
+  }
+
+  return 0
+}
+
+func clockSeconds(e *Entry) int {
+  h, m, s := e.Start.Clock()
+  return h*3600 + m*60 + s
+}
+
+func compareInts(a, b int) int {
+  switch {
+  case a < b:
+    return -1
+  case a > b:
+    return 1
+  }
+
+  return 0
+}
@@ -0,0 +1,394 @@
+package agenda
+
+import (
+	"time"
+
+	"github.com/lcyvin/gorgeous/pkg/org"
+)
+
+// TodoList is a global list of headings across documents, mirroring org's
+// `todo`, `tags` and `tags-todo` agenda views. Unlike an Agenda, entries are
+// not tied to days: every heading satisfying the list's conditions is listed
+// once.
+type TodoList struct {
+  Documents []*org.Document
+  // Every entry of the list, sorted by Sorting.
+  Entries   []*Entry
+  // Entries grouped by GroupBy, in the order each group first appears in the
+  // sorted entries. Holds a single group with an empty key when GroupBy is
+  // GROUP_NONE.
+  Groups    []*Group
+
+  // Todo keywords to list. When empty, every heading in a non-done todo
+  // state is listed.
+  Keywords  []string
+  // When set, only headings satisfying the match are listed.
+  Match     *org.Match
+  // When false, headings without a todo keyword are listed as well, as in
+  // org's `tags` view. Keywords is ignored in that case.
+  TodoOnly  bool
+
+  // Skips headings by their scheduled timestamp, mirroring
+  // org-agenda-todo-ignore-scheduled.
+  SkipScheduled ScheduledSkip
+  // When true, headings with a deadline within SkipDeadlineDays of today are
+  // skipped, mirroring org-agenda-todo-ignore-deadlines. Deadlines in the
+  // past are always within range.
+  SkipDeadlines    bool
+  SkipDeadlineDays int
+  // Headings for which any of these return true are left out of the list.
+  Skip      []SkipFunc
+
+  // Sorting applied to the entries. Defaults to DefaultTodoSorting.
+  Sorting   []SortKey
+  GroupBy   GroupKey
+  // Location used to determine day boundaries when evaluating skip
+  // conditions. Defaults to time.Local.
+  Location  *time.Location
+  // The day skip conditions are evaluated against. Defaults to time.Now().
+  Today     time.Time
+
+  order     int
+}
+
+// Group holds the entries of a TodoList sharing the same grouping key.
+type Group struct {
+  Key     string
+  Entries []*Entry
+}
+
+// ScheduledSkip mirrors the values of org-agenda-todo-ignore-scheduled.
+type ScheduledSkip string
+
+const (
+  SKIP_SCHEDULED_NONE   ScheduledSkip = ""
+  // skip every scheduled heading
+  SKIP_SCHEDULED_ALL    ScheduledSkip = "all"
+  // skip headings scheduled after today
+  SKIP_SCHEDULED_FUTURE ScheduledSkip = "future"
+  // skip headings scheduled today or earlier
+  SKIP_SCHEDULED_PAST   ScheduledSkip = "past"
+)
+
+// GroupKey selects how the entries of a TodoList are grouped.
+type GroupKey string
+
+const (
+  GROUP_NONE      GroupKey = ""
+  GROUP_CATEGORY  GroupKey = "category"
+  GROUP_TODO      GroupKey = "todo"
+  GROUP_PRIORITY  GroupKey = "priority"
+  // groups by effective tag. Entries holding several tags appear in each of
+  // their groups, entries without tags in a group with an empty key.
+  GROUP_TAG       GroupKey = "tag"
+)
+
+// DefaultTodoSorting matches org's default sorting strategy for todo and tags
+// views.
+var DefaultTodoSorting []SortKey = []SortKey{
+  SORT_PRIORITY_DOWN,
+  SORT_CATEGORY_KEEP,
+}
+
+type TodoListOpt func(*TodoList)
+
+// Sets the todo keywords listed.
+func WithListKeywords(keywords... string) TodoListOpt {
+  return func(tl *TodoList) {
+    tl.Keywords = keywords
+  }
+}
+
+// Sets the match headings must satisfy to be listed.
+func WithListMatch(m *org.Match) TodoListOpt {
+  return func(tl *TodoList) {
+    tl.Match = m
+  }
+}
+
+// Skips headings by their scheduled timestamp.
+func WithListSkipScheduled(skip ScheduledSkip) TodoListOpt {
+  return func(tl *TodoList) {
+    tl.SkipScheduled = skip
+  }
+}
+
+// Skips headings with a deadline within the given number of days of today.
+func WithListSkipDeadlines(days int) TodoListOpt {
+  return func(tl *TodoList) {
+    tl.SkipDeadlines = true
+    tl.SkipDeadlineDays = days
+  }
+}
+
+// Sets functions deciding which headings are left out of the list.
+func WithListSkip(fns... SkipFunc) TodoListOpt {
+  return func(tl *TodoList) {
+    tl.Skip = fns
+  }
+}
+
+// Sets the sorting strategy applied to the list's entries.
+func WithListSorting(keys... SortKey) TodoListOpt {
+  return func(tl *TodoList) {
+    tl.Sorting = keys
+  }
+}
+
+// Sets how the list's entries are grouped.
+func WithListGrouping(key GroupKey) TodoListOpt {
+  return func(tl *TodoList) {
+    tl.GroupBy = key
+  }
+}
+
+// Sets the location used to determine day boundaries.
+func WithListLocation(loc *time.Location) TodoListOpt {
+  return func(tl *TodoList) {
+    tl.Location = loc
+  }
+}
+
+// Sets the day treated as today.
+func WithListToday(t time.Time) TodoListOpt {
+  return func(tl *TodoList) {
+    tl.Today = t
+  }
+}
+
+// TodoView builds org's global todo list: every heading in a non-done todo
+// state, or in one of the keywords given with WithListKeywords.
+func TodoView(docs []*org.Document, opts... TodoListOpt) *TodoList {
+  return newTodoList(docs, true, opts...)
+}
+
+// TagsView builds a list of the headings satisfying the given match string.
+// When todoOnly is true, only headings in a non-done todo state are listed,
+// as in org's `tags-todo` view; otherwise every matching heading is, as in
+// org's `tags` view.
+func TagsView(docs []*org.Document, match string, todoOnly bool, opts... TodoListOpt) (*TodoList, error) {
+  m, err := org.ParseMatch(match)
+  if err != nil {
+    return nil, err
+  }
+
+  opts = append([]TodoListOpt{WithListMatch(m)}, opts...)
+  return newTodoList(docs, todoOnly, opts...), nil
+}
+
+func newTodoList(docs []*org.Document, todoOnly bool, opts... TodoListOpt) *TodoList {
+  tl := &TodoList{
+    Documents: docs,
+    TodoOnly: todoOnly,
+    Sorting: DefaultTodoSorting,
+    Location: time.Local,
+    Today: time.Now(),
+  }
+
+  for _, opt := range opts {
+    opt(tl)
+  }
+
+  tl.Today = midnight(tl.Today.In(tl.Location))
+  tl.build()
+
+  return tl
+}
+
+func (tl *TodoList) build() {
+  tl.Entries = make([]*Entry, 0)
+
+  for _, doc := range tl.Documents {
+    for n := range doc.Nodes() {
+      if n.Heading == nil || skipNode(n) || skipped(tl.Skip, n) || !tl.includes(n) {
+        continue
+      }
+
+      e := tl.newEntry(doc, n)
+      e.order = tl.order
+      tl.order++
+      tl.Entries = append(tl.Entries, e)
+    }
+  }
+
+  SortEntries(tl.Entries, tl.Sorting)
+  tl.Groups = groupEntries(tl.Entries, tl.GroupBy)
+}
+
+// Returns true if the node satisfies the list's keyword, match and skip
+// conditions.
+func (tl *TodoList) includes(n *org.Node) bool {
+  kw := n.Heading.TodoKeyword
+  if tl.TodoOnly {
+    switch {
+    case kw == "":
+      return false
+    case len(tl.Keywords) == 0 && n.Heading.IsDone():
+      return false
+    case len(tl.Keywords) > 0 && !containsString(tl.Keywords, kw):
+      return false
+    }
+  }
+
+  if tl.Match != nil && !n.Matches(tl.Match) {
+    return false
+  }
+
+  return !tl.skipScheduled(n) && !tl.skipDeadline(n)
+}
+
+func (tl *TodoList) skipScheduled(n *org.Node) bool {
+  if tl.SkipScheduled == SKIP_SCHEDULED_NONE {
+    return false
+  }
+
+  start, ok := planningStart(n.Heading.GetPlanning(org.PLANNING_SCHEDULED))
+  if !ok {
+    return false
+  }
+
+  days := daysBetween(tl.Today, startIn(start, tl.Location))
+  switch tl.SkipScheduled {
+  case SKIP_SCHEDULED_ALL:
+    return true
+  case SKIP_SCHEDULED_FUTURE:
+    return days > 0
+  case SKIP_SCHEDULED_PAST:
+    return days <= 0
+  }
+
+  return false
+}
+
+func (tl *TodoList) skipDeadline(n *org.Node) bool {
+  if !tl.SkipDeadlines {
+    return false
+  }
+
+  start, ok := planningStart(n.Heading.GetPlanning(org.PLANNING_DEADLINE))
+  if !ok {
+    return false
+  }
+
+  return daysBetween(tl.Today, startIn(start, tl.Location)) <= tl.SkipDeadlineDays
+}
+
+func (tl *TodoList) newEntry(doc *org.Document, n *org.Node) *Entry {
+  var prio *org.HeadingPrioritySetting
+  var todo *org.TodoSettings
+  if doc.BufferSettings != nil {
+    prio = doc.BufferSettings.Priorities
+    todo = doc.BufferSettings.TodoSettings
+  }
+
+  kind := ENTRY_TODO
+  if tl.Match != nil {
+    kind = ENTRY_TAGS
+  }
+
+  e := &Entry{
+    Kind: kind,
+    Node: n,
+    Document: doc,
+    Title: n.Heading.Text,
+    Category: n.Category(),
+    Todo: n.Heading.TodoKeyword,
+    TodoRank: todoRank(todo, n.Heading.TodoKeyword),
+    Priority: n.Heading.Priority,
+    PriorityRank: prio.Rank(n.Heading.Priority),
+    Tags: n.EffectiveTags(tagInheritOpts(doc)),
+  }
+
+  return e
+}
+
+// Groups entries by key, keeping the order of the entries within each group.
+func groupEntries(entries []*Entry, key GroupKey) []*Group {
+  groups := make([]*Group, 0)
+  index := make(map[string]*Group)
+
+  add := func(k string, e *Entry) {
+    g, ok := index[k]
+    if !ok {
+      g = &Group{Key: k, Entries: make([]*Entry, 0)}
+      index[k] = g
+      groups = append(groups, g)
+    }
+
+    g.Entries = append(g.Entries, e)
+  }
+
+  for _, e := range entries {
+    switch key {
+    case GROUP_CATEGORY:
+      add(e.Category, e)
+    case GROUP_TODO:
+      add(e.Todo, e)
+    case GROUP_PRIORITY:
+      add(e.Node.Heading.GetPriority().String(), e)
+    case GROUP_TAG:
+      if len(e.Tags) == 0 {
+        add("", e)
+      }
+
+      for _, t := range org.EffectiveTagNames(e.Tags) {
+        add(t, e)
+      }
+    default:
+      add("", e)
+    }
+  }
+
+  return groups
+}
+
+// Returns the position of the keyword across the document's todo sequences,
+// in definition order. Headings without a keyword, or with an unknown one,
+// rank after every defined keyword.
+func todoRank(ts *org.TodoSettings, kw string) int {
+  if ts == nil || kw == "" {
+    return int(^uint(0) >> 1)
+  }
+
+  i := 0
+  for _, seq := range ts.Sequences {
+    for _, k := range append(append([]string{}, seq.ProcessKeywords...), seq.DoneKeywords...) {
+      if k == kw {
+        return i
+      }
+      i++
+    }
+  }
+
+  return int(^uint(0) >> 1)
+}
+
+// Returns the timestamp the planning element starts at, if it holds one.
+func planningStart(p *org.Planning) (*org.Timestamp, bool) {
+  if p == nil || p.TimestampRangeOrSexp == nil {
+    return nil, false
+  }
+
+  switch ts := p.TimestampRangeOrSexp.(type) {
+  case *org.Timestamp:
+    return ts, true
+  case *org.RepeatStamp:
+    return &ts.Timestamp, true
+  case *org.TimestampRange:
+    if ts.StartDate != nil {
+      return ts.StartDate, true
+    }
+  }
+
+  return nil, false
+}
+
+func containsString(list []string, s string) bool {
+  for _, v := range list {
+    if v == s {
+      return true
+    }
+  }
+
+  return false
+}
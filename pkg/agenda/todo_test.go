@@ -0,0 +1,170 @@
+package agenda
+
+import (
+	"testing"
+	"time"
+
+	"github.com/lcyvin/gorgeous/pkg/org"
+)
+
+func testingTodoListDocument(t *testing.T) *org.Document {
+  d := org.New()
+  d.BufferSettings.Category = "home"
+  if _, err := d.BufferSettings.TodoSettings.AddDefinition(org.TODO_SEQUENCE_STATE, "NEXT WAIT | CANCELLED"); err != nil {
+    t.Fatal(err)
+  }
+
+  d.AddHeading(1, "Laundry", org.WithTags([]string{"chore"}))
+  d.AddHeading(1, "Taxes", org.WithPriority(org.AlphaHeadingPriority("A")), org.WithTags([]string{"money"}))
+  d.AddHeading(1, "Groceries", org.WithTags([]string{"chore", "errand"}))
+  d.AddHeading(1, "Dentist")
+  d.AddHeading(1, "Notes", org.WithTags([]string{"chore"}))
+  d.AddHeading(1, "Painting", org.WithTags([]string{"chore"}))
+
+  todos := []string{"TODO", "NEXT", "WAIT", "TODO", "", "DONE"}
+  for i, kw := range todos {
+    d.NodeTree.Subtree[i].Node.Heading.TodoKeyword = kw
+  }
+
+  d.NodeTree.Subtree[1].Node.SetProperty("Effort", "3")
+  d.NodeTree.Subtree[2].Node.SetProperty("Effort", "1")
+
+  d.NodeTree.Subtree[2].Node.Heading.SetPlanning(&org.Planning{
+    PlanningKind: org.PLANNING_SCHEDULED,
+    TimestampRangeOrSexp: org.NewTimestamp(time.Date(2050, 1, 10, 0, 0, 0, 0, time.UTC), org.WithDateOnly()),
+  })
+  d.NodeTree.Subtree[3].Node.Heading.SetPlanning(&org.Planning{
+    PlanningKind: org.PLANNING_DEADLINE,
+    TimestampRangeOrSexp: org.NewTimestamp(time.Date(2050, 1, 3, 0, 0, 0, 0, time.UTC), org.WithDateOnly()),
+  })
+
+  return d
+}
+
+func todoListTitles(entries []*Entry) []string {
+  out := make([]string, 0)
+  for _, e := range entries {
+    out = append(out, e.Title)
+  }
+
+  return out
+}
+
+func TestTodoView(t *testing.T) {
+  d := testingTodoListDocument(t)
+  docs := []*org.Document{d}
+  today := WithListToday(time.Date(2050, 1, 1, 12, 0, 0, 0, time.UTC))
+  utc := WithListLocation(time.UTC)
+
+  tests := []struct {
+    name string
+    opts []TodoListOpt
+    want []string
+  }{
+    {"open", nil, []string{"Taxes", "Laundry", "Groceries", "Dentist"}},
+    {"keywords", []TodoListOpt{WithListKeywords("WAIT", "DONE")}, []string{"Groceries", "Painting"}},
+    {"skip future scheduled", []TodoListOpt{WithListSkipScheduled(SKIP_SCHEDULED_FUTURE)}, []string{"Taxes", "Laundry", "Dentist"}},
+    {"skip near deadlines", []TodoListOpt{WithListSkipDeadlines(3)}, []string{"Taxes", "Laundry", "Groceries"}},
+    {"todo state", []TodoListOpt{WithListSorting(SORT_TODO_STATE_UP)}, []string{"Laundry", "Dentist", "Taxes", "Groceries"}},
+  }
+
+  for _, tt := range tests {
+    tl := TodoView(docs, append([]TodoListOpt{today, utc}, tt.opts...)...)
+    got := todoListTitles(tl.Entries)
+    if len(got) != len(tt.want) {
+      t.Errorf("%s: TodoView() = %v, want %v", tt.name, got, tt.want)
+      continue
+    }
+
+    for i := range got {
+      if got[i] != tt.want[i] {
+        t.Errorf("%s: TodoView() = %v, want %v", tt.name, got, tt.want)
+        break
+      }
+    }
+  }
+
+  tl := TodoView(docs, WithListGrouping(GROUP_TAG))
+  keys := make([]string, 0)
+  for _, g := range tl.Groups {
+    keys = append(keys, g.Key)
+  }
+
+  if len(keys) != 4 || keys[0] != "money" || keys[1] != "chore" || keys[2] != "errand" || keys[3] != "" {
+    t.Errorf("groups = %q, want [money chore errand \"\"]", keys)
+  }
+}
+
+// Date only scheduled and deadline dates are counted in the list's location
+// as the days they name, whatever zone they were read in.
+func TestTodoViewDateOnlySkips(t *testing.T) {
+  ny, err := time.LoadLocation("America/New_York")
+  if err != nil {
+    t.Skip(err)
+  }
+
+  d := org.New()
+  d.AddHeading(1, "Tomorrow")
+  d.AddHeading(1, "Due in three days")
+  plan := func(n *org.Node, kind org.PlanningKind, s string) {
+    n.Heading.TodoKeyword = "TODO"
+    ts, _ := org.ParseTimestamp(s, org.WithParseLocation(time.UTC))
+    n.Heading.SetPlanning(&org.Planning{PlanningKind: kind, TimestampRangeOrSexp: ts})
+  }
+  plan(d.NodeTree.Subtree[0].Node, org.PLANNING_SCHEDULED, "<2050-01-06 Thu>")
+  plan(d.NodeTree.Subtree[1].Node, org.PLANNING_DEADLINE, "<2050-01-08 Sat>")
+
+  opts := []TodoListOpt{WithListLocation(ny), WithListToday(time.Date(2050, 1, 5, 12, 0, 0, 0, ny))}
+  tl := TodoView([]*org.Document{d}, append(opts, WithListSkipScheduled(SKIP_SCHEDULED_FUTURE))...)
+  if got := todoListTitles(tl.Entries); len(got) != 1 || got[0] != "Due in three days" {
+    t.Errorf("skip future scheduled = %v, want [Due in three days]", got)
+  }
+
+  tl = TodoView([]*org.Document{d}, append(opts, WithListSkipDeadlines(2))...)
+  if got := todoListTitles(tl.Entries); len(got) != 2 {
+    t.Errorf("skip deadlines within 2 days = %v, want both", got)
+  }
+}
+
+func TestTagsView(t *testing.T) {
+  d := testingTodoListDocument(t)
+  docs := []*org.Document{d}
+
+  tests := []struct {
+    match    string
+    todoOnly bool
+    want     []string
+  }{
+    {"chore", false, []string{"Laundry", "Groceries", "Notes", "Painting"}},
+    {"chore", true, []string{"Laundry", "Groceries"}},
+    {"chore/!", false, []string{"Laundry", "Groceries"}},
+    {"chore-errand/TODO|DONE", false, []string{"Laundry", "Painting"}},
+    {"Effort>2|errand", false, []string{"Taxes", "Groceries"}},
+    {"TODO=\"WAIT\"", false, []string{"Groceries"}},
+    {"ITEM={^[LT]}", false, []string{"Taxes", "Laundry"}},
+  }
+
+  for _, tt := range tests {
+    tl, err := TagsView(docs, tt.match, tt.todoOnly)
+    if err != nil {
+      t.Fatal(err)
+    }
+
+    got := todoListTitles(tl.Entries)
+    if len(got) != len(tt.want) {
+      t.Errorf("TagsView(%q) = %v, want %v", tt.match, got, tt.want)
+      continue
+    }
+
+    for i := range got {
+      if got[i] != tt.want[i] {
+        t.Errorf("TagsView(%q) = %v, want %v", tt.match, got, tt.want)
+        break
+      }
+    }
+  }
+
+  if _, err := TagsView(docs, "Effort>", false); err == nil {
+    t.Error("TagsView() with a malformed comparison did not fail")
+  }
+}
@@ -159,10 +159,10 @@ func (ep *EventParser) newNodes(ce gocal.Event) ([]*org.Node, error) {
     e := base
     hdg := baseHdg
     hdg.Node = &e
-    hdg.Planning = &org.Planning{
-      Kind: org.PLANNING_EVENT,
+    hdg.SetPlanning(&org.Planning{
+      PlanningKind: org.PLANNING_EVENT,
       TimestampRangeOrSexp: timestamps[0],
-    }
+    })
     e.Heading = &hdg
 
     return append(n, &e), nil
@@ -172,7 +172,7 @@ func (ep *EventParser) newNodes(ce gocal.Event) ([]*org.Node, error) {
     e := base
     hdg := baseHdg
     hdg.Node = &e
-    if ep.Config.AddDateCounter {
+    if ep.Config != nil && ep.Config.AddDateCounter {
       switch ep.Config.DateCounterFmt {
       case PREPEND:
         hdg.Text = fmt.Sprintf("(%d/%d) ", idx+1, days) + hdg.Text
@@ -181,10 +181,10 @@ func (ep *EventParser) newNodes(ce gocal.Event) ([]*org.Node, error) {
       }
     }
 
-    hdg.Planning = &org.Planning{
-      Kind: org.PLANNING_EVENT,
+    hdg.SetPlanning(&org.Planning{
+      PlanningKind: org.PLANNING_EVENT,
       TimestampRangeOrSexp: t,
-    }
+    })
 
     e.Heading = &hdg
     n = append(n, &e)
@@ -0,0 +1,713 @@
+package cal
+
+import (
+	"crypto/rand"
+	"crypto/sha1"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lcyvin/gorgeous/pkg/org"
+)
+
+// ExportUse mirrors the symbols of org-icalendar-use-scheduled and
+// org-icalendar-use-deadline, which decide how SCHEDULED and DEADLINE
+// timestamps are exported.
+type ExportUse string
+
+const (
+  // Exports the timestamp as an event when the heading has no todo keyword.
+  USE_EVENT_IF_NOT_TODO      ExportUse = "event-if-not-todo"
+  // Exports the timestamp as an event when the heading has a todo keyword.
+  USE_EVENT_IF_TODO          ExportUse = "event-if-todo"
+  // Exports the timestamp as an event when the heading has a todo keyword
+  // which is not done.
+  USE_EVENT_IF_TODO_NOT_DONE ExportUse = "event-if-todo-not-done"
+  // Scheduled timestamps only, sets the todo's DTSTART.
+  USE_TODO_START             ExportUse = "todo-start"
+  // Deadlines only, sets the todo's DUE.
+  USE_TODO_DUE               ExportUse = "todo-due"
+)
+
+// IncludeTodo mirrors org-icalendar-include-todo, choosing which headings
+// with a todo keyword are exported as VTODOs.
+type IncludeTodo int
+
+const (
+  INCLUDE_TODO_NONE IncludeTodo = iota
+  INCLUDE_TODO_UNDONE
+  INCLUDE_TODO_ALL
+)
+
+// ExportConfig controls which agenda items an Exporter writes, and how.
+type ExportConfig struct {
+  // Defaults to USE_TODO_START, as org does.
+  UseScheduled []ExportUse
+  // Defaults to USE_EVENT_IF_NOT_TODO and USE_TODO_DUE, as org does.
+  UseDeadline  []ExportUse
+  // Defaults to INCLUDE_TODO_UNDONE.
+  IncludeTodo  IncludeTodo
+  // Zone of timestamps on headings without a TIMEZONE property, mirroring
+  // org-icalendar-timezone. When nil they are written as floating times.
+  Location     *time.Location
+  // Diary sexps are expanded into an event for each of their occurrences
+  // within the window. They are left out when it is nil.
+  Window       *Window
+  // Mirrors org-icalendar-store-UID: headings without an ID property are
+  // given a new one, which is used for their UID. Otherwise their UID is
+  // derived from the document path and outline path of the heading.
+  StoreUID     bool
+  // Calendar name written as X-WR-CALNAME. Defaults to the title of the
+  // first document.
+  Name         string
+  ProdID       string
+  // Written as the DTSTAMP of every component. Defaults to time.Now().
+  Stamp        time.Time
+}
+
+var DefaultExportConfig = ExportConfig{
+  UseScheduled: []ExportUse{USE_TODO_START},
+  UseDeadline: []ExportUse{USE_EVENT_IF_NOT_TODO, USE_TODO_DUE},
+  IncludeTodo: INCLUDE_TODO_UNDONE,
+  ProdID: "-//lcyvin//gorgeous//EN",
+}
+
+// Exporter writes the agenda items of org documents as an RFC 5545
+// calendar: active timestamps, scheduled items and deadlines as VEVENTs,
+// headings with a todo keyword as VTODOs, and repeaters and RRULE properties
+// as RRULEs.
+type Exporter struct {
+  Documents []*org.Document
+  Config    *ExportConfig
+}
+
+type ExportOpt func(*Exporter)
+
+// Sets how SCHEDULED timestamps are exported.
+func WithUseScheduled(uses... ExportUse) ExportOpt {
+  return func(e *Exporter) {
+    e.Config.UseScheduled = uses
+  }
+}
+
+// Sets how DEADLINE timestamps are exported.
+func WithUseDeadline(uses... ExportUse) ExportOpt {
+  return func(e *Exporter) {
+    e.Config.UseDeadline = uses
+  }
+}
+
+// Sets which headings with a todo keyword are exported as VTODOs.
+func WithIncludeTodo(it IncludeTodo) ExportOpt {
+  return func(e *Exporter) {
+    e.Config.IncludeTodo = it
+  }
+}
+
+// Sets the zone of timestamps on headings without a TIMEZONE property.
+func WithExportLocation(loc *time.Location) ExportOpt {
+  return func(e *Exporter) {
+    e.Config.Location = loc
+  }
+}
+
+// Sets the window diary sexps are expanded within.
+func WithExportWindow(start, end time.Time) ExportOpt {
+  return func(e *Exporter) {
+    e.Config.Window = &Window{Start: start, End: end}
+  }
+}
+
+// Stores a new ID property on exported headings lacking one.
+func WithStoreUID() ExportOpt {
+  return func(e *Exporter) {
+    e.Config.StoreUID = true
+  }
+}
+
+// Sets the calendar name.
+func WithCalendarName(name string) ExportOpt {
+  return func(e *Exporter) {
+    e.Config.Name = name
+  }
+}
+
+// Sets the DTSTAMP written on every component.
+func WithStamp(t time.Time) ExportOpt {
+  return func(e *Exporter) {
+    e.Config.Stamp = t
+  }
+}
+
+func NewExporter(docs []*org.Document, opts... ExportOpt) *Exporter {
+  cfg := DefaultExportConfig
+  cfg.Stamp = time.Now()
+  e := &Exporter{Documents: docs, Config: &cfg}
+
+  for _, opt := range opts {
+    opt(e)
+  }
+
+  if e.Config.Name == "" && len(docs) > 0 {
+    e.Config.Name = docs[0].Title
+  }
+
+  return e
+}
+
+// Writes the calendar to w.
+func (e *Exporter) Export(w io.Writer) error {
+  _, err := io.WriteString(w, e.Calendar().String())
+  return err
+}
+
+// Writes the calendar to the file at p, creating or truncating it.
+func (e *Exporter) ExportFile(p string) error {
+  f, err := os.Create(p)
+  if err != nil {
+    return err
+  }
+
+  if err := e.Export(f); err != nil {
+    f.Close()
+    return err
+  }
+
+  return f.Close()
+}
+
+// Returns the VCALENDAR holding the exported components of every document.
+func (e *Exporter) Calendar() *Component {
+  c := NewComponent("VCALENDAR").
+    Add("VERSION", "2.0").
+    AddText("PRODID", e.Config.ProdID).
+    Add("CALSCALE", "GREGORIAN")
+
+  if e.Config.Name != "" {
+    c.AddText("X-WR-CALNAME", e.Config.Name)
+  }
+
+  for _, doc := range e.Documents {
+    for n := range doc.Nodes() {
+      if n.Heading == nil || skipNode(n) {
+        continue
+      }
+
+      c.Components = append(c.Components, e.nodeComponents(doc, n)...)
+    }
+  }
+
+  c.Components = append(timezones(c.Components), c.Components...)
+  return c
+}
+
+// Returns a VTIMEZONE for each TZID used by the components, covering the
+// times written in it.
+func timezones(comps []*Component) []*Component {
+  names := make([]string, 0)
+  spans := make(map[string][2]time.Time)
+  for _, c := range comps {
+    for _, p := range c.Props {
+      for _, param := range p.Params {
+        name, ok := strings.CutPrefix(param, "TZID=")
+        if !ok {
+          continue
+        }
+
+        t, err := time.Parse("20060102T150405", p.Value)
+        if err != nil {
+          continue
+        }
+
+        span, seen := spans[name]
+        switch {
+        case !seen:
+          names = append(names, name)
+          span = [2]time.Time{t, t}
+        case t.Before(span[0]):
+          span[0] = t
+        case t.After(span[1]):
+          span[1] = t
+        }
+        spans[name] = span
+      }
+    }
+  }
+
+  out := make([]*Component, 0, len(names))
+  for _, name := range names {
+    loc, err := time.LoadLocation(name)
+    if err != nil {
+      continue
+    }
+
+    out = append(out, Timezone(loc, spans[name][0], spans[name][1]))
+  }
+
+  return out
+}
+
+// Returns the VEVENTs and VTODO exported for a single heading.
+func (e *Exporter) nodeComponents(doc *org.Document, n *org.Node) []*Component {
+  out := make([]*Component, 0)
+  isTodo := n.Heading.TodoKeyword != ""
+  done := n.Heading.IsDone()
+
+  var todo *Component
+  if isTodo && (e.Config.IncludeTodo == INCLUDE_TODO_ALL || e.Config.IncludeTodo == INCLUDE_TODO_UNDONE && !done) {
+    todo = e.todo(doc, n)
+  }
+
+  plain := 0
+  for _, p := range n.Heading.Planning {
+    switch p.PlanningKind {
+    case org.PLANNING_EVENT:
+      prefix := "TS"
+      if plain > 0 {
+        prefix = fmt.Sprintf("TS%d", plain+1)
+      }
+      plain++
+
+      out = append(out, e.events(n, p, prefix)...)
+    case org.PLANNING_SCHEDULED:
+      if useAsEvent(e.Config.UseScheduled, isTodo, done) {
+        out = append(out, e.events(n, p, "SC")...)
+      }
+
+      if todo != nil && slices.Contains(e.Config.UseScheduled, USE_TODO_START) {
+        e.setTime(todo, "DTSTART", n, p, true)
+      }
+    case org.PLANNING_DEADLINE:
+      if useAsEvent(e.Config.UseDeadline, isTodo, done) {
+        out = append(out, e.events(n, p, "DL")...)
+      }
+
+      if todo != nil && slices.Contains(e.Config.UseDeadline, USE_TODO_DUE) {
+        e.setTime(todo, "DUE", n, p, false)
+      }
+    }
+  }
+
+  if n.Section != nil && e.Config.Window != nil {
+    for _, el := range n.Section.Elements {
+      if ds, ok := el.(*org.DiarySexp); ok {
+        st := org.NewSexpTimestamp(ds.Sexp)
+        for _, c := range e.sexpEvents(n, st, "SX") {
+          if ds.Text != "" {
+            c.Set("SUMMARY", EscapeText(ds.Text))
+          }
+          out = append(out, c)
+        }
+      }
+    }
+  }
+
+  if todo != nil {
+    out = append(out, todo)
+  }
+
+  return out
+}
+
+// Returns true if a scheduled or deadline timestamp is exported as an event
+// under the given uses.
+func useAsEvent(uses []ExportUse, isTodo, done bool) bool {
+  if !isTodo {
+    return slices.Contains(uses, USE_EVENT_IF_NOT_TODO)
+  }
+
+  return slices.Contains(uses, USE_EVENT_IF_TODO) ||
+    !done && slices.Contains(uses, USE_EVENT_IF_TODO_NOT_DONE)
+}
+
+// Returns the VEVENTs for a planning element's timestamp. Sexp timestamps
+// give one event per occurrence within the export window, every other active
+// timestamp a single, possibly repeating, event.
+func (e *Exporter) events(n *org.Node, p *org.Planning, prefix string) []*Component {
+  if st, ok := p.TimestampRangeOrSexp.(*org.SexpTimestamp); ok {
+    return e.sexpEvents(n, st, prefix)
+  }
+
+  start, ok := startOf(p.TimestampRangeOrSexp)
+  if !ok || !start.Active {
+    return []*Component{}
+  }
+
+  c := e.component("VEVENT", n, prefix)
+  e.setTimes(c, n, p.TimestampRangeOrSexp)
+  e.setRule(c, n, p)
+
+  return []*Component{c}
+}
+
+// Returns a VEVENT for each occurrence of a sexp timestamp within the
+// export window, their UIDs suffixed with the date of the occurrence.
+func (e *Exporter) sexpEvents(n *org.Node, st *org.SexpTimestamp, prefix string) []*Component {
+  out := make([]*Component, 0)
+  if e.Config.Window == nil {
+    return out
+  }
+
+  loc := e.location(n)
+  for occ := range st.Occurrences(e.Config.Window.Start, e.Config.Window.End) {
+    c := e.component("VEVENT", n, prefix)
+    uid, _ := c.Prop("UID")
+    uid.Value += "-" + occ.Start.Format("20060102")
+
+    occ = occ.Localize(orLocal(loc))
+    e.addTime(c, "DTSTART", occ.Start, occ.DateOnly, loc)
+    e.addEnd(c, occ.Start, occ.End, occ.DateOnly, loc)
+    out = append(out, c)
+  }
+
+  return out
+}
+
+// Returns the VTODO for a heading, with its status and priority.
+func (e *Exporter) todo(doc *org.Document, n *org.Node) *Component {
+  c := e.component("VTODO", n, "TODO")
+  c.Add("PRIORITY", strconv.Itoa(todoPriority(doc, n.Heading.Priority)))
+  c.Add("STATUS", todoStatus(doc, n.Heading))
+
+  if !n.Heading.IsDone() {
+    return c
+  }
+
+  if p := n.Heading.GetPlanning(org.PLANNING_CLOSED); p != nil {
+    if ts, ok := startOf(p.TimestampRangeOrSexp); ok {
+      closed := ts.Localize(orLocal(e.location(n)))
+      c.Add("COMPLETED", org.FormatICalTime(closed.Start, false))
+    }
+  }
+
+  return c
+}
+
+// Returns a component holding the properties shared by events and todos.
+func (e *Exporter) component(name string, n *org.Node, prefix string) *Component {
+  c := NewComponent(name).
+    Add("UID", e.uid(n, prefix)).
+    Add("DTSTAMP", org.FormatICalTime(e.Config.Stamp, false)).
+    AddText("SUMMARY", n.Heading.Text)
+
+  if desc := description(n); desc != "" {
+    c.AddText("DESCRIPTION", desc)
+  }
+
+  if v, ok := n.Property("LOCATION"); ok && strings.TrimSpace(v) != "" {
+    c.AddText("LOCATION", strings.TrimSpace(v))
+  }
+
+  cats := make([]string, 0)
+  for _, cat := range append(slices.Clone(n.Heading.Tags), n.Category()) {
+    if cat != "" && !slices.Contains(cats, cat) {
+      cats = append(cats, cat)
+    }
+  }
+
+  if len(cats) > 0 {
+    for i := range cats {
+      cats[i] = EscapeText(cats[i])
+    }
+    c.Add("CATEGORIES", strings.Join(cats, ","))
+  }
+
+  return c
+}
+
+// Returns the UID of a heading's component: the prefix and the heading's ID
+// property, storing a new ID first when configured to.
+func (e *Exporter) uid(n *org.Node, prefix string) string {
+  id, ok := n.Property("ID")
+  if id = strings.TrimSpace(id); !ok || id == "" {
+    if e.Config.StoreUID {
+      id = newUUID()
+      n.SetProperty("ID", id)
+    } else {
+      path := ""
+      if n.Document != nil {
+        path = n.Document.Path
+      }
+
+      sum := sha1.Sum([]byte(path + "\x00" + strings.Join(n.OutlinePath(), "\x00")))
+      id = fmt.Sprintf("%x", sum[:16])
+    }
+  }
+
+  return prefix + "-" + id
+}
+
+// Sets DTSTART and, when the timestamp holds one, DTEND.
+func (e *Exporter) setTimes(c *Component, n *org.Node, tros org.TimestampRangeOrSexp) {
+  loc := e.location(n)
+  tros = e.zoned(n, tros)
+
+  switch ts := tros.(type) {
+  case *org.TimestampRange:
+    e.addTime(c, "DTSTART", ts.StartDate.Start, ts.StartDate.DateOnly, loc)
+    if ts.EndDate == nil {
+      e.addEnd(c, ts.StartDate.Start, ts.StartDate.End, ts.StartDate.DateOnly, loc)
+      return
+    }
+
+    end := ts.EndDate.Start
+    if !ts.EndDate.End.IsZero() {
+      end = ts.EndDate.End
+    }
+    e.addEnd(c, ts.StartDate.Start, end, ts.EndDate.DateOnly, loc)
+  default:
+    if start, ok := startOf(tros); ok {
+      e.addTime(c, "DTSTART", start.Start, start.DateOnly, loc)
+      e.addEnd(c, start.Start, start.End, start.DateOnly, loc)
+    }
+  }
+}
+
+// Sets a todo's DTSTART or DUE from a planning element, along with its RRULE
+// when rule is set.
+func (e *Exporter) setTime(c *Component, name string, n *org.Node, p *org.Planning, rule bool) {
+  ts, ok := startOf(e.zoned(n, p.TimestampRangeOrSexp))
+  if !ok {
+    return
+  }
+
+  e.addTime(c, name, ts.Start, ts.DateOnly, e.location(n))
+  if rule {
+    e.setRule(c, n, p)
+  }
+}
+
+// Adds an RRULE for the planning element's repeater, or for the heading's
+// RRULE property when the planning element holds the timestamp it starts
+// from, along with any EXDATEs.
+func (e *Exporter) setRule(c *Component, n *org.Node, p *org.Planning) {
+  ts, ok := startOf(p.TimestampRangeOrSexp)
+  if !ok {
+    return
+  }
+
+  rc, isRc := p.TimestampRangeOrSexp.(*org.Recurrence)
+  if !isRc {
+    var found bool
+    var err error
+    rc, found, err = n.Recurrence()
+    isRc = found && err == nil && rc.Start.Equal(ts.Start)
+  }
+
+  if isRc {
+    c.Add("RRULE", rc.Rule.String())
+    loc := e.location(n)
+    for _, ex := range rc.ExDates {
+      e.addTime(c, "EXDATE", localize(ex.In(ts.Start.Location()), orLocal(loc)), rc.DateOnly, loc)
+    }
+    return
+  }
+
+  if rule, ok := repeatRule(ts.Repeat); ok {
+    c.Add("RRULE", rule.String())
+  }
+}
+
+// Adds a DTEND for the timestamp's end. Date only timestamps end on the day
+// following their last day, as DTEND is exclusive, while timestamps without
+// an end time get none.
+func (e *Exporter) addEnd(c *Component, start, end time.Time, date bool, loc *time.Location) {
+  if date {
+    last := start
+    if !end.IsZero() {
+      last = end
+    }
+
+    e.addTime(c, "DTEND", last.AddDate(0, 0, 1), true, loc)
+    return
+  }
+
+  if !end.IsZero() {
+    e.addTime(c, "DTEND", end, false, loc)
+  }
+}
+
+// Adds a DATE or DATE-TIME property. Times in UTC are written with a Z, in
+// any other zone with a TZID parameter whose VTIMEZONE Calendar adds, and
+// floating when loc is nil.
+func (e *Exporter) addTime(c *Component, name string, t time.Time, date bool, loc *time.Location) {
+  switch {
+  case date:
+    c.Add(name, org.FormatICalTime(t, true), "VALUE=DATE")
+  case loc == nil:
+    c.Add(name, t.Format("20060102T150405"))
+  case loc == time.UTC:
+    c.Add(name, org.FormatICalTime(t, false))
+  default:
+    c.Add(name, t.Format("20060102T150405"), "TZID=" + loc.String())
+  }
+}
+
+// Returns the zone of the heading's timestamps: its TIMEZONE property, or the
+// configured location.
+func (e *Exporter) location(n *org.Node) *time.Location {
+  if loc, ok, err := n.TimeZone(); ok && err == nil {
+    return loc
+  }
+
+  return e.Config.Location
+}
+
+// Returns the timestamp localized to the heading's zone.
+func (e *Exporter) zoned(n *org.Node, tros org.TimestampRangeOrSexp) org.TimestampRangeOrSexp {
+  if loc := e.location(n); loc != nil {
+    return org.LocalizeTimestamp(tros, loc)
+  }
+
+  return tros
+}
+
+// Returns the timestamp holding the start of any kind of timestamp other than
+// a sexp.
+func startOf(tros org.TimestampRangeOrSexp) (*org.Timestamp, bool) {
+  switch ts := tros.(type) {
+  case *org.Timestamp:
+    return ts, true
+  case *org.RepeatStamp:
+    return &ts.Timestamp, true
+  case *org.TimestampRange:
+    return ts.StartDate, ts.StartDate != nil
+  case *org.Recurrence:
+    return &org.Timestamp{Start: ts.Start, End: ts.End, DateOnly: ts.DateOnly, Active: true}, true
+  }
+
+  return nil, false
+}
+
+// Returns the RRULE equivalent to an org repeater.
+func repeatRule(r *org.Repeat) (*org.RRule, bool) {
+  if r == nil || r.IntervalAmount < 1 {
+    return nil, false
+  }
+
+  rule := &org.RRule{Interval: r.IntervalAmount, WeekStart: time.Monday}
+  switch r.Interval {
+  case org.REPEAT_INTERVAL_HOUR:
+    rule.Freq = org.RRULE_FREQ_HOURLY
+  case org.REPEAT_INTERVAL_DAY:
+    rule.Freq = org.RRULE_FREQ_DAILY
+  case org.REPEAT_INTERVAL_WEEK:
+    rule.Freq = org.RRULE_FREQ_WEEKLY
+  case org.REPEAT_INTERVAL_MONTH:
+    rule.Freq = org.RRULE_FREQ_MONTHLY
+  case org.REPEAT_INTERVAL_YEAR:
+    rule.Freq = org.RRULE_FREQ_YEARLY
+  default:
+    return nil, false
+  }
+
+  return rule, true
+}
+
+// Maps a heading's priority onto the 1 to 9 scale of the PRIORITY property
+// as org does, the highest priority giving 1 and the lowest 9.
+func todoPriority(doc *org.Document, p org.HeadingPriority) int {
+  var prio *org.HeadingPrioritySetting
+  if doc.BufferSettings != nil {
+    prio = doc.BufferSettings.Priorities
+  }
+
+  highest, lowest := 0, 2
+  if prio != nil && prio.Highest != nil && prio.Lowest != nil {
+    highest, lowest = prio.Rank(prio.Highest), prio.Rank(prio.Lowest)
+  }
+
+  if highest == lowest {
+    return 5
+  }
+
+  rank := prio.Rank(p)
+  return int(math.Floor(9 - 8*float64(lowest-rank)/float64(lowest-highest)))
+}
+
+// Maps a heading's todo keyword onto a VTODO STATUS as org does: done
+// keywords are COMPLETED, the first keyword of a sequence NEEDS-ACTION, and
+// any other IN-PROCESS.
+func todoStatus(doc *org.Document, h *org.Heading) string {
+  if h.IsDone() {
+    return "COMPLETED"
+  }
+
+  if doc.BufferSettings != nil && doc.BufferSettings.TodoSettings != nil {
+    seq := doc.BufferSettings.TodoSettings.SequenceFor(h.TodoKeyword)
+    if seq != nil && len(seq.ProcessKeywords) > 0 && seq.ProcessKeywords[0] != h.TodoKeyword {
+      return "IN-PROCESS"
+    }
+  }
+
+  return "NEEDS-ACTION"
+}
+
+// Returns the text of the paragraphs in the heading's section.
+func description(n *org.Node) string {
+  if n.Section == nil {
+    return ""
+  }
+
+  paras := make([]string, 0)
+  for _, el := range n.Section.Elements {
+    if p, ok := el.(*org.Paragraph); ok {
+      if s := strings.TrimSpace(p.String()); s != "" {
+        paras = append(paras, s)
+      }
+    }
+  }
+
+  return strings.Join(paras, "\n\n")
+}
+
+// Returns true for headings org leaves out of exports: commented headings,
+// archived trees and trees tagged noexport, along with their subtrees.
+func skipNode(n *org.Node) bool {
+  for cur := n; cur != nil; cur = cur.Parent() {
+    if cur.Heading == nil {
+      continue
+    }
+
+    if cur.Heading.IsComment {
+      return true
+    }
+
+    for _, t := range cur.Heading.Tags {
+      if t == "ARCHIVE" || t == "noexport" {
+        return true
+      }
+    }
+  }
+
+  return false
+}
+
+func localize(t time.Time, loc *time.Location) time.Time {
+  y, m, d := t.Date()
+  h, min, s := t.Clock()
+  return time.Date(y, m, d, h, min, s, t.Nanosecond(), loc)
+}
+
+func orLocal(loc *time.Location) *time.Location {
+  if loc == nil {
+    return time.Local
+  }
+
+  return loc
+}
+
+// Returns a random version 4 UUID.
+func newUUID() string {
+  var b [16]byte
+  rand.Read(b[:])
+  b[6] = b[6]&0x0f | 0x40
+  b[8] = b[8]&0x3f | 0x80
+
+  return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
@@ -0,0 +1,213 @@
+package cal
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lcyvin/gorgeous/pkg/org"
+)
+
+func exportHeading(t *testing.T, d *org.Document, text, todo string, stamps map[org.PlanningKind]string) *org.Node {
+  t.Helper()
+  d.AddHeading(1, text)
+  n := d.NodeTree.Subtree[len(d.NodeTree.Subtree)-1].Node
+  n.Heading.TodoKeyword = todo
+
+  for kind, s := range stamps {
+    ts, err := org.ParseTimestamp(s, org.WithParseLocation(time.UTC))
+    if err != nil {
+      t.Fatal(err)
+    }
+    n.Heading.SetPlanning(&org.Planning{PlanningKind: kind, TimestampRangeOrSexp: ts})
+  }
+
+  return n
+}
+
+// Returns the content lines of the exported component with the given UID.
+func exported(cal *Component, uid string) []string {
+  for _, c := range cal.Components {
+    if p, ok := c.Prop("UID"); ok && p.Value == uid {
+      return c.Lines()
+    }
+  }
+
+  return nil
+}
+
+func TestExport(t *testing.T) {
+  berlin, err := time.LoadLocation("Europe/Berlin")
+  if err != nil {
+    t.Skip(err)
+  }
+
+  d := org.New()
+  d.Title = "Work"
+
+  meeting := exportHeading(t, d, "Team meeting, weekly", "", map[org.PlanningKind]string{
+    org.PLANNING_EVENT: "<2050-01-03 Mon 10:00-11:00 +1w>",
+  })
+  meeting.SetProperty("ID", "meeting")
+  meeting.SetTimeZone(berlin)
+
+  report := exportHeading(t, d, "Write report", "TODO", map[org.PlanningKind]string{
+    org.PLANNING_SCHEDULED: "<2050-01-04 Tue>",
+    org.PLANNING_DEADLINE: "<2050-01-07 Fri 17:00>",
+  })
+  report.SetProperty("ID", "report")
+  report.Heading.Priority = org.AlphaHeadingPriority("A")
+
+  holiday := exportHeading(t, d, "Holiday", "", map[org.PlanningKind]string{
+    org.PLANNING_EVENT: "<2050-02-01 Tue>--<2050-02-03 Thu>",
+  })
+  holiday.SetProperty("ID", "holiday")
+
+  shipped := exportHeading(t, d, "Ship release", "DONE", map[org.PlanningKind]string{
+    org.PLANNING_CLOSED: "[2050-01-02 Sun 12:30]",
+  })
+  shipped.SetProperty("ID", "shipped")
+
+  standup := exportHeading(t, d, "Standup", "", nil)
+  standup.SetProperty("ID", "standup")
+  rule, _ := org.ParseRRule("FREQ=WEEKLY;BYDAY=MO,WE,FR", time.UTC)
+  rc := org.NewRecurrence(time.Date(2050, 1, 3, 9, 0, 0, 0, time.UTC), rule)
+  rc.ExDates = []time.Time{time.Date(2050, 1, 5, 9, 0, 0, 0, time.UTC)}
+  standup.SetRecurrence(org.PLANNING_EVENT, rc)
+
+  archived := exportHeading(t, d, "Old", "", map[org.PlanningKind]string{
+    org.PLANNING_EVENT: "<2050-01-03 Mon>",
+  })
+  archived.Heading.Tags = []string{"ARCHIVE"}
+
+  stamp := time.Date(2049, 12, 1, 8, 0, 0, 0, time.UTC)
+  cal := NewExporter([]*org.Document{d}, WithExportLocation(time.UTC), WithStamp(stamp)).Calendar()
+
+  if len(cal.Components) != 5 {
+    t.Errorf("exported %d components, want 4 and a VTIMEZONE", len(cal.Components))
+  }
+
+  // zoned times are defined by a VTIMEZONE, whose daylight saving time rules
+  // also hold for later occurrences of the weekly meeting
+  tz := cal.Components[0].Lines()
+  for _, line := range []string{"BEGIN:VTIMEZONE", "TZID:Europe/Berlin", "TZOFFSETTO:+0200", "RRULE:FREQ=YEARLY;BYMONTH=3;BYDAY=-1SU", "RRULE:FREQ=YEARLY;BYMONTH=10;BYDAY=-1SU"} {
+    if !slices.Contains(tz, line) {
+      t.Errorf("VTIMEZONE is missing %q:\n%s", line, strings.Join(tz, "\n"))
+    }
+  }
+
+  // Sao Paulo dropped daylight saving time in 2019, so its transitions are
+  // written one by one
+  if sp, err := time.LoadLocation("America/Sao_Paulo"); err == nil {
+    tz = Timezone(sp, time.Date(2018, 1, 1, 0, 0, 0, 0, sp), time.Date(2050, 1, 1, 0, 0, 0, 0, sp)).Lines()
+    if slices.ContainsFunc(tz, func(l string) bool { return strings.HasPrefix(l, "RRULE") }) || !slices.Contains(tz, "DTSTART:20190217T000000") {
+      t.Errorf("Sao Paulo VTIMEZONE =\n%s", strings.Join(tz, "\n"))
+    }
+  }
+
+  tests := []struct {
+    uid  string
+    want []string
+  }{
+    {"TS-meeting", []string{
+      "BEGIN:VEVENT",
+      "DTSTAMP:20491201T080000Z",
+      `SUMMARY:Team meeting\, weekly`,
+      "DTSTART;TZID=Europe/Berlin:20500103T100000",
+      "DTEND;TZID=Europe/Berlin:20500103T110000",
+      "RRULE:FREQ=WEEKLY",
+    }},
+    {"TODO-report", []string{
+      "BEGIN:VTODO",
+      "PRIORITY:1",
+      "STATUS:NEEDS-ACTION",
+      "DTSTART;VALUE=DATE:20500104",
+      "DUE:20500107T170000Z",
+    }},
+    {"TS-holiday", []string{"DTSTART;VALUE=DATE:20500201", "DTEND;VALUE=DATE:20500204"}},
+    {"TS-standup", []string{"DTSTART:20500103T090000Z", "RRULE:FREQ=WEEKLY;BYDAY=MO,WE,FR", "EXDATE:20500105T090000Z"}},
+  }
+
+  for _, tt := range tests {
+    got := exported(cal, tt.uid)
+    if got == nil {
+      t.Errorf("no component with UID %s", tt.uid)
+      continue
+    }
+
+    for _, line := range tt.want {
+      if !slices.Contains(got, line) {
+        t.Errorf("%s is missing %q:\n%s", tt.uid, line, strings.Join(got, "\n"))
+      }
+    }
+  }
+
+  if exported(cal, "DL-report") != nil || exported(cal, "TODO-shipped") != nil {
+    t.Errorf("todo deadlines and done todos should not be exported by default")
+  }
+
+  cal = NewExporter([]*org.Document{d},
+    WithExportLocation(time.UTC),
+    WithUseDeadline(USE_EVENT_IF_TODO),
+    WithIncludeTodo(INCLUDE_TODO_ALL),
+  ).Calendar()
+
+  if got := exported(cal, "DL-report"); !slices.Contains(got, "DTSTART:20500107T170000Z") {
+    t.Errorf("DL-report = %v", got)
+  }
+
+  if got := exported(cal, "TODO-report"); slices.Contains(got, "DUE:20500107T170000Z") {
+    t.Errorf("DUE should only be set with USE_TODO_DUE")
+  }
+
+  if got := exported(cal, "TODO-shipped"); !slices.Contains(got, "STATUS:COMPLETED") || !slices.Contains(got, "COMPLETED:20500102T123000Z") {
+    t.Errorf("TODO-shipped = %v", got)
+  }
+}
+
+func TestExportUIDs(t *testing.T) {
+  d := org.New()
+  d.Path = "/notes/work.org"
+  n := exportHeading(t, d, "Review", "", map[org.PlanningKind]string{
+    org.PLANNING_EVENT: "<2050-01-03 Mon>",
+  })
+
+  uid := func() string {
+    p, _ := NewExporter([]*org.Document{d}).Calendar().Components[0].Prop("UID")
+    return p.Value
+  }
+
+  first := uid()
+  if first != uid() || !strings.HasPrefix(first, "TS-") {
+    t.Errorf("UID %s is not stable", first)
+  }
+
+  NewExporter([]*org.Document{d}, WithStoreUID()).Calendar()
+  id, ok := n.Property("ID")
+  if !ok || uid() != "TS-" + id {
+    t.Errorf("stored ID %q, UID %s", id, uid())
+  }
+}
+
+func TestComponentFolding(t *testing.T) {
+  summary := strings.Repeat("é", 60) + "; done"
+  c := NewComponent("VEVENT").AddText("SUMMARY", summary)
+  lines := c.Lines()
+
+  unfolded := ""
+  for _, l := range lines[1:len(lines)-1] {
+    if len(l) > 75 {
+      t.Errorf("line of %d octets: %q", len(l), l)
+    }
+    unfolded += strings.TrimPrefix(l, " ")
+  }
+
+  if unfolded != "SUMMARY:" + strings.Repeat("é", 60) + `\; done` {
+    t.Errorf("unfolded = %q", unfolded)
+  }
+
+  if !strings.HasSuffix(c.String(), "END:VEVENT\r\n") {
+    t.Errorf("String() should end lines with CRLF")
+  }
+}
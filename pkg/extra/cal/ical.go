@@ -0,0 +1,275 @@
+package cal
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Component is an iCalendar component such as a VCALENDAR, VEVENT or VTODO,
+// holding its properties and any nested components in the order they are
+// written.
+type Component struct {
+  Name       string
+  Props      []*Prop
+  Components []*Component
+}
+
+// Prop is a single iCalendar content line, E.G., DTSTART;VALUE=DATE:20500101.
+// Value is written as-is, text values should be escaped with EscapeText.
+type Prop struct {
+  Name   string
+  Params []string
+  Value  string
+}
+
+func NewComponent(name string) *Component {
+  return &Component{Name: name}
+}
+
+// Adds a property holding value, which is written unescaped.
+func (c *Component) Add(name, value string, params... string) *Component {
+  c.Props = append(c.Props, &Prop{Name: name, Params: params, Value: value})
+  return c
+}
+
+// Adds a property holding the escaped form of text.
+func (c *Component) AddText(name, text string) *Component {
+  return c.Add(name, EscapeText(text))
+}
+
+// Replaces the value of the named property, adding it if it is not present.
+func (c *Component) Set(name, value string, params... string) *Component {
+  if p, ok := c.Prop(name); ok {
+    p.Params = params
+    p.Value = value
+    return c
+  }
+
+  return c.Add(name, value, params...)
+}
+
+// Returns the first property with the given name.
+func (c *Component) Prop(name string) (*Prop, bool) {
+  for _, p := range c.Props {
+    if strings.EqualFold(p.Name, name) {
+      return p, true
+    }
+  }
+
+  return nil, false
+}
+
+// Returns the content lines of the component, folded to 75 octets.
+func (c *Component) Lines() []string {
+  out := []string{"BEGIN:" + c.Name}
+  for _, p := range c.Props {
+    out = append(out, fold(p.String())...)
+  }
+
+  for _, sub := range c.Components {
+    out = append(out, sub.Lines()...)
+  }
+
+  return append(out, "END:" + c.Name)
+}
+
+// Returns the component as written to an .ics file, with CRLF line endings.
+func (c *Component) String() string {
+  return strings.Join(c.Lines(), "\r\n") + "\r\n"
+}
+
+func (p *Prop) String() string {
+  var sb strings.Builder
+  sb.WriteString(p.Name)
+  for _, param := range p.Params {
+    sb.WriteString(";" + param)
+  }
+
+  sb.WriteString(":" + p.Value)
+  return sb.String()
+}
+
+var textEscaper = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`)
+
+// EscapeText escapes s for use as an iCalendar TEXT value.
+func EscapeText(s string) string {
+  return textEscaper.Replace(s)
+}
+
+// Splits a content line into lines of at most 75 octets, continuation lines
+// starting with a space, without splitting multi-byte characters.
+func fold(line string) []string {
+  out := make([]string, 0, 1)
+  for len(line) > 75 {
+    i := 75
+    for i > 0 && !utf8.RuneStart(line[i]) {
+      i--
+    }
+
+    out = append(out, line[:i])
+    line = " " + line[i:]
+  }
+
+  return append(out, line)
+}
+
+// Timezone returns the VTIMEZONE defining loc for the times from through to,
+// whose TZID is the name of loc. Daylight saving time rules holding for the
+// whole span are written once with an RRULE, so they also apply to later
+// occurrences of recurring events, otherwise each transition within the span
+// is written on its own.
+func Timezone(loc *time.Location, from, to time.Time) *Component {
+  c := NewComponent("VTIMEZONE").Add("TZID", loc.String())
+  start := time.Date(from.Year()-1, 1, 1, 0, 0, 0, 0, time.UTC)
+  end := time.Date(to.Year()+2, 1, 1, 0, 0, 0, 0, time.UTC)
+  trans := tzTransitions(loc, start, end)
+
+  first := make([]tzTransition, 0)
+  for _, tr := range trans {
+    if tr.at.Before(start.AddDate(1, 0, 0)) {
+      first = append(first, tr)
+    }
+  }
+
+  rules := len(first) > 0
+  for _, tr := range first {
+    rules = rules && tr.yearly(loc, end.Year()-1)
+  }
+
+  if rules {
+    for _, tr := range first {
+      c.Components = append(c.Components, tr.observance(loc).Add("RRULE", tr.rule()))
+    }
+    return c
+  }
+
+  // the offset in effect before the first transition, if any
+  name, offset := start.In(loc).Zone()
+  c.Components = append(c.Components, tzTransition{at: start, from: offset, to: offset, name: name, dst: start.In(loc).IsDST()}.
+    observance(loc).Set("DTSTART", "19700101T000000"))
+  for _, tr := range trans {
+    c.Components = append(c.Components, tr.observance(loc))
+  }
+
+  return c
+}
+
+// A change of a zone's offset, at the instant the new offset takes effect.
+type tzTransition struct {
+  at   time.Time
+  from int
+  to   int
+  name string
+  dst  bool
+}
+
+// Returns the changes of loc's offset within [start, end), found to the
+// second. Changes less than a day apart are not told apart.
+func tzTransitions(loc *time.Location, start, end time.Time) []tzTransition {
+  out := make([]tzTransition, 0)
+  _, offset := start.In(loc).Zone()
+  for t := start; t.Before(end); t = t.Add(24*time.Hour) {
+    next := t.Add(24*time.Hour)
+    if _, o := next.In(loc).Zone(); o == offset {
+      continue
+    }
+
+    lo, hi := t, next
+    for hi.Sub(lo) > time.Second {
+      mid := lo.Add(hi.Sub(lo)/2)
+      if _, o := mid.In(loc).Zone(); o == offset {
+        lo = mid
+      } else {
+        hi = mid
+      }
+    }
+
+    name, o := hi.In(loc).Zone()
+    out = append(out, tzTransition{at: hi, from: offset, to: o, name: name, dst: hi.In(loc).IsDST()})
+    offset = o
+  }
+
+  return out
+}
+
+// Returns the wall clock time the transition happens at, in the offset it
+// ends, as DTSTART of an observance is written.
+func (tr tzTransition) local() time.Time {
+  return tr.at.In(time.FixedZone("", tr.from))
+}
+
+// Returns the weekday ordinal of the transition within its month, counting
+// back from the end of the month when it falls in the last week.
+func (tr tzTransition) ordinal() int {
+  lt := tr.local()
+  last := time.Date(lt.Year(), lt.Month()+1, 0, 0, 0, 0, 0, time.UTC).Day()
+  if lt.Day()+7 > last {
+    return -1
+  }
+
+  return (lt.Day()-1)/7+1
+}
+
+// Returns the yearly RRULE repeating the transition on the same weekday of
+// its month, E.G., FREQ=YEARLY;BYMONTH=3;BYDAY=-1SU.
+func (tr tzTransition) rule() string {
+  lt := tr.local()
+  return fmt.Sprintf("FREQ=YEARLY;BYMONTH=%d;BYDAY=%d%s", int(lt.Month()), tr.ordinal(), strings.ToUpper(lt.Weekday().String()[:2]))
+}
+
+// Returns true if loc changes offset as the transition's rule predicts in
+// every year after it, through the given year.
+func (tr tzTransition) yearly(loc *time.Location, through int) bool {
+  lt := tr.local()
+  n := tr.ordinal()
+  for y := lt.Year()+1; y <= through; y++ {
+    day := 1 + (int(lt.Weekday()-time.Date(y, lt.Month(), 1, 0, 0, 0, 0, time.UTC).Weekday())+7)%7
+    if n > 0 {
+      day += (n-1)*7
+    } else {
+      last := time.Date(y, lt.Month()+1, 0, 0, 0, 0, 0, time.UTC).Day()
+      day += (last-day)/7*7
+    }
+
+    at := time.Date(y, lt.Month(), day, lt.Hour(), lt.Minute(), lt.Second(), 0, time.FixedZone("", tr.from))
+    _, before := at.Add(-time.Second).In(loc).Zone()
+    _, after := at.In(loc).Zone()
+    if before != tr.from || after != tr.to {
+      return false
+    }
+  }
+
+  return true
+}
+
+// Returns the STANDARD or DAYLIGHT component of the transition.
+func (tr tzTransition) observance(loc *time.Location) *Component {
+  name := "STANDARD"
+  if tr.dst {
+    name = "DAYLIGHT"
+  }
+
+  return NewComponent(name).
+    Add("DTSTART", tr.local().Format("20060102T150405")).
+    Add("TZOFFSETFROM", utcOffset(tr.from)).
+    Add("TZOFFSETTO", utcOffset(tr.to)).
+    AddText("TZNAME", tr.name)
+}
+
+// Writes an offset in seconds east of UTC as a UTC-OFFSET, E.G., +0100.
+func utcOffset(seconds int) string {
+  sign := "+"
+  if seconds < 0 {
+    sign = "-"
+    seconds = -seconds
+  }
+
+  out := fmt.Sprintf("%s%02d%02d", sign, seconds/3600, seconds%3600/60)
+  if seconds%60 != 0 {
+    out += fmt.Sprintf("%02d", seconds%60)
+  }
+
+  return out
+}
@@ -0,0 +1,218 @@
+package habit
+
+import (
+	"time"
+
+	"github.com/lcyvin/gorgeous/pkg/org"
+)
+
+// Day is a single day of a habit's consistency graph.
+type Day struct {
+  Date    time.Time
+  Status  Status
+  // The color org-habit draws the day in.
+  Face    Face
+  Today   bool
+}
+
+// Status summarizes what a day of the graph means for the habit.
+type Status string
+
+const (
+  // the habit was completed on the day
+  HABIT_DONE    Status = "done"
+  // the habit could have been completed on the day, and was not yet overdue
+  HABIT_DUE     Status = "due"
+  // the habit was past its maximum interval on the day
+  HABIT_OVERDUE Status = "overdue"
+  // the day is after today
+  HABIT_FUTURE  Status = "future"
+  // the habit was not yet due on the day, as its minimum interval had not
+  // passed
+  HABIT_CLEAR   Status = "clear"
+)
+
+// Face mirrors the faces org-habit colors its graph with.
+type Face string
+
+const (
+  // blue, the habit is not yet due
+  FACE_CLEAR   Face = "clear"
+  // green, the habit is due
+  FACE_READY   Face = "ready"
+  // yellow, the last day before the habit becomes overdue
+  FACE_ALERT   Face = "alert"
+  // red, the habit is overdue
+  FACE_OVERDUE Face = "overdue"
+)
+
+// The number of days before and after today org-habit shows by default,
+// mirroring org-habit-preceding-days and org-habit-following-days.
+const (
+  DEFAULT_PRECEDING_DAYS = 21
+  DEFAULT_FOLLOWING_DAYS = 7
+)
+
+// Graph computes the consistency graph for every day from the day holding
+// start up to but excluding the day holding end, as org-habit-build-graph
+// does. Past days are evaluated against the schedule in effect at the time,
+// derived from the completion preceding them.
+func (h *Habit) Graph(start, end, today time.Time) []*Day {
+  today = midnight(today)
+  from := daysBetween(today, start)
+  to := daysBetween(today, end)
+  sched := daysBetween(today, h.Scheduled)
+
+  done := make([]int, 0, len(h.Done))
+  for _, d := range h.Done {
+    done = append(done, daysBetween(today, d))
+  }
+
+  first, hasFirst := 0, len(done) > 0
+  if hasFirst {
+    first = done[0]
+  }
+
+  // split the completions into the last one before the graph and the ones
+  // within or after it
+  last, hasLast := 0, false
+  for len(done) > 0 && done[0] < from {
+    last, hasLast = done[0], true
+    done = done[1:]
+  }
+
+  out := make([]*Day, 0)
+  for d := from; d < to; d++ {
+    past := d < 0
+    donep := len(done) > 0 && done[0] == d
+
+    var face Face
+    if past && !hasLast && sched >= 0 {
+      face = FACE_CLEAR
+      if hasFirst && first == d {
+        face = FACE_READY
+      }
+    } else {
+      s := sched
+      if past && hasLast && len(done) > 0 {
+        s = h.scheduledAfter(last, sched, len(done))
+      }
+
+      face = h.face(d, s, donep)
+    }
+
+    if donep {
+      for len(done) > 0 && done[0] == d {
+        done = done[1:]
+      }
+
+      last, hasLast = d, true
+    }
+
+    day := &Day{
+      Date: today.AddDate(0, 0, d),
+      Face: face,
+      Today: d == 0,
+    }
+
+    switch {
+    case donep:
+      day.Status = HABIT_DONE
+    case d > 0:
+      day.Status = HABIT_FUTURE
+    case face == FACE_CLEAR:
+      day.Status = HABIT_CLEAR
+    case face == FACE_OVERDUE:
+      day.Status = HABIT_OVERDUE
+    default:
+      day.Status = HABIT_DUE
+    }
+
+    out = append(out, day)
+  }
+
+  return out
+}
+
+// DefaultGraph computes the consistency graph over org-habit's default
+// window around today.
+func (h *Habit) DefaultGraph(today time.Time) []*Day {
+  today = midnight(today)
+  return h.Graph(
+    today.AddDate(0, 0, -DEFAULT_PRECEDING_DAYS),
+    today.AddDate(0, 0, DEFAULT_FOLLOWING_DAYS),
+    today,
+  )
+}
+
+// Returns the day the habit was scheduled for following the completion on
+// day last, given the current scheduled day and the number of completions
+// made since.
+func (h *Habit) scheduledAfter(last, sched, since int) int {
+  switch h.Kind {
+  case org.REPEAT_KIND_SHIFT_FUTURE_RELATIVE:
+    return last + h.MinInterval
+  case org.REPEAT_KIND_SHIFT:
+    // each completion since shifted the scheduled day by one interval
+    return sched - since*h.MinInterval
+  }
+
+  // the first day after last which is a whole number of intervals from the
+  // current scheduled day
+  m := (sched - last) % h.MinInterval
+  if m < 0 {
+    m += h.MinInterval
+  }
+
+  return last + h.MinInterval - m
+}
+
+func (h *Habit) face(day, sched int, donep bool) Face {
+  deadline := sched + h.MaxInterval - h.MinInterval
+  switch {
+  case day < sched:
+    return FACE_CLEAR
+  case day < deadline:
+    return FACE_READY
+  case day == deadline && donep:
+    return FACE_READY
+  case day == deadline:
+    return FACE_ALERT
+  }
+
+  return FACE_OVERDUE
+}
+
+// Stats summarizes a habit's completion history.
+type Stats struct {
+  Completions   int
+  // The number of consecutive completions, up to the most recent one, each
+  // made within the maximum interval of the one before. Zero when the habit
+  // is currently overdue.
+  CurrentStreak int
+  LongestStreak int
+  LastDone      time.Time
+}
+
+// Stats computes streak statistics for the habit as of today.
+func (h *Habit) Stats(today time.Time) Stats {
+  st := Stats{Completions: len(h.Done), LastDone: h.LastDone()}
+
+  streak := 0
+  for i, d := range h.Done {
+    if i == 0 || daysBetween(h.Done[i-1], d) > h.MaxInterval {
+      streak = 0
+    }
+
+    streak++
+    if streak > st.LongestStreak {
+      st.LongestStreak = streak
+    }
+  }
+
+  if len(h.Done) > 0 && daysBetween(h.LastDone(), today) <= h.MaxInterval {
+    st.CurrentStreak = streak
+  }
+
+  return st
+}
@@ -0,0 +1,203 @@
+// The habit package reads org habits, headings with a STYLE property of
+// "habit" and a repeating SCHEDULED timestamp, and computes the consistency
+// graph org-habit shows for them in the agenda.
+package habit
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/lcyvin/gorgeous/pkg/org"
+)
+
+// Habit is a habit heading along with its repeater and completion history.
+type Habit struct {
+  Node        *org.Node
+  Title       string
+  // The date the habit is next scheduled for, at midnight.
+  Scheduled   time.Time
+  Kind        org.RepeatKind
+  // The minimum and maximum number of days between completions, E.G., 1 and
+  // 3 for .+1d/3d. MaxInterval equals MinInterval when the repeater holds no
+  // maximum.
+  MinInterval int
+  MaxInterval int
+  // The dates the habit was completed, at midnight and oldest first.
+  Done        []time.Time
+}
+
+// IsHabit returns true if the node's STYLE property is "habit".
+func IsHabit(n *org.Node) bool {
+  if n == nil || n.Heading == nil {
+    return false
+  }
+
+  style, _ := n.Property("STYLE")
+  return strings.EqualFold(style, "habit")
+}
+
+// Habits returns every habit found in docs. Habit headings whose SCHEDULED
+// timestamp is missing or does not repeat are skipped.
+func Habits(docs... *org.Document) []*Habit {
+  out := make([]*Habit, 0)
+  for _, doc := range docs {
+    for n := range doc.Nodes() {
+      if !IsHabit(n) {
+        continue
+      }
+
+      if h, err := New(n); err == nil {
+        out = append(out, h)
+      }
+    }
+  }
+
+  return out
+}
+
+// New reads the habit held by the node. Completion dates are read from the
+// node's log: every state change into a done keyword counts as a completion.
+func New(n *org.Node) (*Habit, error) {
+  if !IsHabit(n) {
+    return nil, NewNotAHabitError(n, "missing STYLE habit property")
+  }
+
+  ts, ok := scheduled(n)
+  if !ok || ts.Repeat == nil || ts.Repeat.IntervalAmount <= 0 {
+    return nil, NewNotAHabitError(n, "missing repeating SCHEDULED timestamp")
+  }
+
+  min, ok := intervalDays(ts.Repeat.IntervalAmount, ts.Repeat.Interval)
+  if !ok {
+    return nil, NewNotAHabitError(n, fmt.Sprintf("unsupported repeat interval %q", ts.Repeat.String()))
+  }
+
+  max := min
+  if ts.Repeat.MaxIntervalAmount > 0 {
+    max, ok = intervalDays(ts.Repeat.MaxIntervalAmount, ts.Repeat.MaxInterval)
+    if !ok || max < min {
+      return nil, NewNotAHabitError(n, fmt.Sprintf("invalid maximum interval in %q", ts.Repeat.String()))
+    }
+  }
+
+  h := &Habit{
+    Node: n,
+    Title: n.Heading.Text,
+    Scheduled: midnight(ts.Start),
+    Kind: ts.Repeat.Kind,
+    MinInterval: min,
+    MaxInterval: max,
+    Done: make([]time.Time, 0),
+  }
+
+  seen := make(map[time.Time]bool)
+  for _, le := range n.LogEntries() {
+    if le.EntryKind != org.LOG_ENTRY_STATE || le.Time == nil || !isDoneKeyword(n, le.State) {
+      continue
+    }
+
+    day := midnight(le.Time.Start)
+    if !seen[day] {
+      seen[day] = true
+      h.Done = append(h.Done, day)
+    }
+  }
+
+  sort.Slice(h.Done, func(i, j int) bool {
+    return h.Done[i].Before(h.Done[j])
+  })
+
+  return h, nil
+}
+
+// Returns the date the habit becomes overdue, following its current
+// scheduled date.
+func (h *Habit) Deadline() time.Time {
+  return h.Scheduled.AddDate(0, 0, h.MaxInterval-h.MinInterval)
+}
+
+// Returns the date the habit was last completed, or the zero time if it was
+// never completed.
+func (h *Habit) LastDone() time.Time {
+  if len(h.Done) == 0 {
+    return time.Time{}
+  }
+
+  return h.Done[len(h.Done)-1]
+}
+
+func scheduled(n *org.Node) (*org.Timestamp, bool) {
+  p := n.Heading.GetPlanning(org.PLANNING_SCHEDULED)
+  if p == nil {
+    return nil, false
+  }
+
+  switch ts := p.TimestampRangeOrSexp.(type) {
+  case *org.Timestamp:
+    return ts, true
+  case *org.RepeatStamp:
+    return &ts.Timestamp, true
+  }
+
+  return nil, false
+}
+
+func isDoneKeyword(n *org.Node, kw string) bool {
+  if n.Document == nil || n.Document.BufferSettings == nil || n.Document.BufferSettings.TodoSettings == nil {
+    return kw == "DONE"
+  }
+
+  return n.Document.BufferSettings.TodoSettings.GetKeywordKind(kw) == org.TODO_KEYWORD_KIND_DONE
+}
+
+// Converts a repeat interval to days as org-habit does, treating months as
+// 30 days and years as 365.
+func intervalDays(amount int, interval org.RepeatIntervalKind) (int, bool) {
+  switch interval {
+  case org.REPEAT_INTERVAL_DAY:
+    return amount, true
+  case org.REPEAT_INTERVAL_WEEK:
+    return amount*7, true
+  case org.REPEAT_INTERVAL_MONTH:
+    return amount*30, true
+  case org.REPEAT_INTERVAL_YEAR:
+    return amount*365, true
+  }
+
+  return 0, false
+}
+
+func midnight(t time.Time) time.Time {
+  y, m, d := t.Date()
+  return time.Date(y, m, d, 0, 0, 0, 0, t.Location())
+}
+
+// Returns the number of calendar days from a to b, ignoring time of day.
+func daysBetween(a, b time.Time) int {
+  ay, am, ad := a.Date()
+  by, bm, bd := b.In(a.Location()).Date()
+  da := time.Date(ay, am, ad, 12, 0, 0, 0, time.UTC)
+  db := time.Date(by, bm, bd, 12, 0, 0, 0, time.UTC)
+
+  return int(db.Sub(da).Hours() / 24)
+}
+
+type NotAHabitError struct {
+  Heading string
+  Reason  string
+}
+
+func (nahe NotAHabitError) Error() string {
+  return fmt.Sprintf("Heading %q is not a valid habit: %s", nahe.Heading, nahe.Reason)
+}
+
+func NewNotAHabitError(n *org.Node, reason string) *NotAHabitError {
+  e := &NotAHabitError{Reason: reason}
+  if n != nil && n.Heading != nil {
+    e.Heading = n.Heading.Text
+  }
+
+  return e
+}
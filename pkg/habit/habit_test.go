@@ -0,0 +1,111 @@
+package habit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/lcyvin/gorgeous/pkg/org"
+)
+
+func testingHabitDocument(t *testing.T) *org.Document {
+  d := org.New()
+  d.AddHeading(1, "Exercise")
+  d.AddHeading(1, "Reading")
+
+  n := d.NodeTree.Subtree[0].Node
+  n.SetProperty("STYLE", "habit")
+  n.Heading.TodoKeyword = "TODO"
+  n.Heading.SetPlanning(&org.Planning{
+    PlanningKind: org.PLANNING_SCHEDULED,
+    TimestampRangeOrSexp: org.NewTimestamp(
+      time.Date(2050, 1, 1, 0, 0, 0, 0, time.UTC),
+      org.WithDateOnly(),
+      org.WithRepeat(&org.Repeat{
+        Kind: org.REPEAT_KIND_SHIFT_FUTURE_RELATIVE,
+        IntervalAmount: 1,
+        Interval: org.REPEAT_INTERVAL_DAY,
+        MaxIntervalAmount: 3,
+        MaxInterval: org.REPEAT_INTERVAL_DAY,
+      })),
+  })
+
+  for _, day := range []int{1, 2, 3, 7, 9} {
+    at := time.Date(2050, 1, day, 18, 0, 0, 0, time.UTC)
+    if _, err := n.Heading.SetTodo("DONE", org.WithChangeTime(at)); err != nil {
+      t.Fatal(err)
+    }
+  }
+
+  return d
+}
+
+func TestHabitGraph(t *testing.T) {
+  d := testingHabitDocument(t)
+  habits := Habits(d)
+  if len(habits) != 1 {
+    t.Fatalf("Habits() found %d habits, want 1", len(habits))
+  }
+
+  h := habits[0]
+  if h.MinInterval != 1 || h.MaxInterval != 3 || len(h.Done) != 5 {
+    t.Fatalf("habit = %d/%d with %d completions", h.MinInterval, h.MaxInterval, len(h.Done))
+  }
+
+  today := time.Date(2050, 1, 10, 9, 0, 0, 0, time.UTC)
+  graph := h.Graph(time.Date(2050, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(2050, 1, 13, 0, 0, 0, 0, time.UTC), today)
+
+  want := []struct {
+    status Status
+    face   Face
+  }{
+    {HABIT_DONE, FACE_READY},
+    {HABIT_DONE, FACE_READY},
+    {HABIT_DONE, FACE_READY},
+    {HABIT_DUE, FACE_READY},
+    {HABIT_DUE, FACE_READY},
+    {HABIT_DUE, FACE_ALERT},
+    {HABIT_DONE, FACE_OVERDUE},
+    {HABIT_DUE, FACE_READY},
+    {HABIT_DONE, FACE_READY},
+    {HABIT_DUE, FACE_READY},
+    {HABIT_FUTURE, FACE_READY},
+    {HABIT_FUTURE, FACE_ALERT},
+  }
+
+  if len(graph) != len(want) {
+    t.Fatalf("Graph() returned %d days, want %d", len(graph), len(want))
+  }
+
+  for i, w := range want {
+    if graph[i].Status != w.status || graph[i].Face != w.face {
+      t.Errorf("%s = %s/%s, want %s/%s", graph[i].Date.Format(time.DateOnly), graph[i].Status, graph[i].Face, w.status, w.face)
+    }
+  }
+
+  if !graph[9].Today {
+    t.Error("2050-01-10 is not marked as today")
+  }
+
+  st := h.Stats(today)
+  if st.Completions != 5 || st.LongestStreak != 3 || st.CurrentStreak != 2 {
+    t.Errorf("Stats() = %+v", st)
+  }
+
+  if st := h.Stats(today.AddDate(0, 0, 5)); st.CurrentStreak != 0 {
+    t.Errorf("Stats() after lapse has a current streak of %d", st.CurrentStreak)
+  }
+}
+
+func TestNewNotAHabit(t *testing.T) {
+  d := testingHabitDocument(t)
+  reading := d.NodeTree.Subtree[1].Node
+
+  if _, err := New(reading); err == nil {
+    t.Error("New() accepted a heading without a STYLE property")
+  }
+
+  reading.SetProperty("STYLE", "habit")
+  if _, err := New(reading); err == nil {
+    t.Error("New() accepted a habit without a repeating SCHEDULED timestamp")
+  }
+}
@@ -1 +1,329 @@
 package org
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DynamicBlock is a block whose contents are generated by Go code registered
+// under the block's name, E.G.:
+//
+//     #+BEGIN: clocktable :maxlevel 2 :scope file
+//     ...
+//     #+END:
+//
+// See RegisterDynamicBlock and Document.UpdateDynamicBlocks.
+type DynamicBlock struct {
+  Name   string
+  Params BlockParams
+  // The block's current contents, excluding the #+BEGIN and #+END lines.
+  Lines  []string
+}
+
+func (db DynamicBlock) Kind() ElementKind {
+  return ELEMENT_DYNAMIC_BLOCK
+}
+
+func (db DynamicBlock) IsGreaterElement() bool {
+  return true
+}
+
+func (db *DynamicBlock) String() string {
+  return strings.Join(db.Strings(), "\n")
+}
+
+func (db *DynamicBlock) Strings() []string {
+  out := []string{strings.TrimSpace("#+BEGIN: " + db.Name + " " + db.Params.String())}
+  out = append(out, db.Lines...)
+  return append(out, "#+END:")
+}
+
+// NewDynamicBlock creates an empty dynamic block with the given name and
+// parameter list, E.G., NewDynamicBlock("clocktable", ":maxlevel 2").
+func NewDynamicBlock(name, params string) *DynamicBlock {
+  return &DynamicBlock{Name: name, Params: ParseBlockParams(params), Lines: make([]string, 0)}
+}
+
+var dynamicBlockBeginRegexp = regexp.MustCompile(`(?i)^\s*#\+BEGIN:\s+(\S+)(.*)$`)
+var dynamicBlockEndRegexp = regexp.MustCompile(`(?i)^\s*#\+END:?\s*$`)
+
+// ParseDynamicBlock parses a dynamic block from its #+BEGIN line through its
+// #+END line.
+func ParseDynamicBlock(lines []string) (*DynamicBlock, error) {
+  if len(lines) < 2 {
+    return nil, NewInvalidDynamicBlockError("block must hold a #+BEGIN and #+END line")
+  }
+
+  m := dynamicBlockBeginRegexp.FindStringSubmatch(lines[0])
+  if m == nil {
+    return nil, NewInvalidDynamicBlockError(fmt.Sprintf("malformed #+BEGIN line %q", lines[0]))
+  }
+
+  if !dynamicBlockEndRegexp.MatchString(lines[len(lines)-1]) {
+    return nil, NewInvalidDynamicBlockError(fmt.Sprintf("block %q is not terminated by #+END:", m[1]))
+  }
+
+  db := NewDynamicBlock(m[1], m[2])
+  db.Lines = append(db.Lines, lines[1:len(lines)-1]...)
+  return db, nil
+}
+
+// DynamicBlockWriter generates the contents of a dynamic block, excluding its
+// #+BEGIN and #+END lines.
+type DynamicBlockWriter func(ctx *DynamicBlockContext) ([]string, error)
+
+// DynamicBlockContext describes the block being written.
+type DynamicBlockContext struct {
+  Document *Document
+  // The node whose section holds the block. For blocks before the first
+  // heading, this is the document's zero-th node, which has no heading.
+  Node     *Node
+  Block    *DynamicBlock
+  // The time of the update, used by writers reporting relative periods.
+  Now      time.Time
+}
+
+var (
+  dynamicBlocksMu sync.RWMutex
+  dynamicBlocks = map[string]DynamicBlockWriter{}
+)
+
+func init() {
+  RegisterDynamicBlock("clocktable", func(ctx *DynamicBlockContext) ([]string, error) {
+    return ClockTable(ctx.Document, ctx.Node, ctx.Block.Params, ctx.Now)
+  })
+}
+
+// RegisterDynamicBlock sets the writer used for blocks with the given name,
+// replacing any writer already registered with it. Names are compared
+// case-insensitively. Packages providing their own blocks typically register
+// them from an init function.
+func RegisterDynamicBlock(name string, w DynamicBlockWriter) {
+  dynamicBlocksMu.Lock()
+  defer dynamicBlocksMu.Unlock()
+
+  dynamicBlocks[strings.ToLower(name)] = w
+}
+
+// Returns the writer registered for blocks with the given name.
+func LookupDynamicBlock(name string) (DynamicBlockWriter, bool) {
+  dynamicBlocksMu.RLock()
+  defer dynamicBlocksMu.RUnlock()
+
+  w, ok := dynamicBlocks[strings.ToLower(name)]
+  return w, ok
+}
+
+// Returns every dynamic block in the document along with the node holding
+// it, including blocks nested in drawers.
+func (d *Document) DynamicBlocks() []*DynamicBlockContext {
+  out := make([]*DynamicBlockContext, 0)
+
+  var collect func(n *Node, elements []Element)
+  collect = func(n *Node, elements []Element) {
+    for _, e := range elements {
+      switch v := e.(type) {
+      case *DynamicBlock:
+        out = append(out, &DynamicBlockContext{Document: d, Node: n, Block: v})
+      case *Drawer:
+        collect(n, v.Elements)
+      }
+    }
+  }
+
+  for n := range d.Nodes() {
+    if n.Section != nil {
+      collect(n, n.Section.Elements)
+    }
+  }
+
+  return out
+}
+
+// UpdateDynamicBlocks regenerates the contents of every dynamic block with a
+// registered writer, as org-update-all-dynamic-blocks does, returning the
+// blocks which were updated. Blocks without a registered writer are left
+// untouched. A block whose writer fails keeps its previous contents, and the
+// update carries on with the remaining blocks; the failures are returned
+// joined into a single error.
+func (d *Document) UpdateDynamicBlocks(now time.Time) ([]*DynamicBlock, error) {
+  out := make([]*DynamicBlock, 0)
+  errs := make([]error, 0)
+
+  for _, ctx := range d.DynamicBlocks() {
+    w, ok := LookupDynamicBlock(ctx.Block.Name)
+    if !ok {
+      continue
+    }
+
+    ctx.Now = now
+    lines, err := w(ctx)
+    if err != nil {
+      errs = append(errs, NewDynamicBlockUpdateError(ctx, err))
+      continue
+    }
+
+    ctx.Block.Lines = lines
+    out = append(out, ctx.Block)
+  }
+
+  return out, errors.Join(errs...)
+}
+
+// BlockParam is a single ":key value" pair given on the #+BEGIN line of a
+// dynamic block.
+type BlockParam struct {
+  Key   string
+  Value string
+}
+
+// BlockParams holds the parameters of a dynamic block in the order they were
+// written, E.G., `:maxlevel 2 :scope file`. Keys are stored without their
+// leading colon.
+type BlockParams []BlockParam
+
+// ParseBlockParams parses a dynamic block parameter list. Values may be
+// quoted or parenthesized to include spaces; a key without a value holds an
+// empty string.
+func ParseBlockParams(s string) BlockParams {
+  out := make(BlockParams, 0)
+  toks := tokenizeBlockParams(s)
+
+  for i := 0; i < len(toks); i++ {
+    if !strings.HasPrefix(toks[i], ":") {
+      continue
+    }
+
+    p := BlockParam{Key: strings.ToLower(toks[i][1:])}
+    if i+1 < len(toks) && !strings.HasPrefix(toks[i+1], ":") {
+      p.Value = strings.Trim(toks[i+1], `"`)
+      i++
+    }
+
+    out = append(out, p)
+  }
+
+  return out
+}
+
+// Splits a parameter list on whitespace outside of quotes and parentheses.
+func tokenizeBlockParams(s string) []string {
+  out := make([]string, 0)
+  depth := 0
+  quoted := false
+  cur := strings.Builder{}
+
+  for _, c := range s {
+    switch {
+    case c == '"':
+      quoted = !quoted
+    case quoted:
+    case c == '(':
+      depth++
+    case c == ')':
+      depth--
+    case (c == ' ' || c == '\t') && depth == 0:
+      if cur.Len() > 0 {
+        out = append(out, cur.String())
+        cur.Reset()
+      }
+      continue
+    }
+
+    cur.WriteRune(c)
+  }
+
+  if cur.Len() > 0 {
+    out = append(out, cur.String())
+  }
+
+  return out
+}
+
+// Returns the value of the parameter with the given key.
+func (bp BlockParams) Get(key string) (string, bool) {
+  key = strings.ToLower(strings.TrimPrefix(key, ":"))
+  for _, p := range bp {
+    if p.Key == key {
+      return p.Value, true
+    }
+  }
+
+  return "", false
+}
+
+// Returns the parameters as written on a #+BEGIN line.
+func (bp BlockParams) String() string {
+  out := make([]string, 0, len(bp))
+  for _, p := range bp {
+    out = append(out, ":"+p.Key)
+    if p.Value == "" {
+      continue
+    }
+
+    if strings.ContainsAny(p.Value, " \t") && !strings.HasPrefix(p.Value, "(") {
+      out = append(out, `"`+p.Value+`"`)
+    } else {
+      out = append(out, p.Value)
+    }
+  }
+
+  return strings.Join(out, " ")
+}
+
+type InvalidBlockParamError struct {
+  Block string
+  Key   string
+  Value string
+}
+
+func (ibpe InvalidBlockParamError) Error() string {
+  return fmt.Sprintf("Invalid value %q for parameter :%s of %s block", ibpe.Value, ibpe.Key, ibpe.Block)
+}
+
+func NewInvalidBlockParamError(block, key, value string) *InvalidBlockParamError {
+  return &InvalidBlockParamError{Block: block, Key: key, Value: value}
+}
+
+type InvalidDynamicBlockError struct {
+  Reason string
+}
+
+func (idbe InvalidDynamicBlockError) Error() string {
+  return fmt.Sprintf("Invalid dynamic block: %s", idbe.Reason)
+}
+
+func NewInvalidDynamicBlockError(reason string) *InvalidDynamicBlockError {
+  return &InvalidDynamicBlockError{Reason: reason}
+}
+
+type DynamicBlockUpdateError struct {
+  Block   string
+  Heading string
+  Err     error
+}
+
+func (dbue DynamicBlockUpdateError) Error() string {
+  if dbue.Heading == "" {
+    return fmt.Sprintf("Updating %s block failed: %s", dbue.Block, dbue.Err)
+  }
+
+  return fmt.Sprintf("Updating %s block under %q failed: %s", dbue.Block, dbue.Heading, dbue.Err)
+}
+
+func (dbue DynamicBlockUpdateError) Unwrap() error {
+  return dbue.Err
+}
+
+func NewDynamicBlockUpdateError(ctx *DynamicBlockContext, err error) *DynamicBlockUpdateError {
+  e := &DynamicBlockUpdateError{Block: ctx.Block.Name, Err: err}
+  if ctx.Node != nil && ctx.Node.Heading != nil {
+    e.Heading = ctx.Node.Heading.Text
+  }
+
+  return e
+}
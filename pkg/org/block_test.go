@@ -0,0 +1,88 @@
+package org
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseDynamicBlock(t *testing.T) {
+  db, err := ParseDynamicBlock([]string{
+    `#+BEGIN: report :title "Weekly summary" :cols (a b)`,
+    "stale",
+    "#+END:",
+  })
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  title, _ := db.Params.Get("title")
+  cols, _ := db.Params.Get("cols")
+  if db.Name != "report" || title != "Weekly summary" || cols != "(a b)" || len(db.Lines) != 1 {
+    t.Errorf("ParseDynamicBlock() = %q %q %q %v", db.Name, title, cols, db.Lines)
+  }
+
+  if got := db.Strings()[0]; got != `#+BEGIN: report :title "Weekly summary" :cols (a b)` {
+    t.Errorf("Strings()[0] = %q", got)
+  }
+
+  if _, err := ParseDynamicBlock([]string{"#+BEGIN: report", "no end"}); err == nil {
+    t.Error("ParseDynamicBlock() of an unterminated block did not fail")
+  }
+}
+
+func TestUpdateDynamicBlocks(t *testing.T) {
+  d := testingClockDocument(t)
+
+  RegisterDynamicBlock("headings", func(ctx *DynamicBlockContext) ([]string, error) {
+    out := make([]string, 0)
+    for _, st := range ctx.Document.NodeTree.Subtree {
+      out = append(out, "- "+st.Node.Heading.Text)
+    }
+    return out, nil
+  })
+
+  failure := errors.New("no data")
+  RegisterDynamicBlock("failing", func(ctx *DynamicBlockContext) ([]string, error) {
+    return nil, failure
+  })
+
+  clock := NewDynamicBlock("clocktable", ":maxlevel 1")
+  headings := NewDynamicBlock("HEADINGS", "")
+  failing := NewDynamicBlock("failing", "")
+  failing.Lines = []string{"kept"}
+  unknown := NewDynamicBlock("unregistered", "")
+  unknown.Lines = []string{"kept"}
+
+  d.NodeTree.Node.Section = &Section{Elements: []Element{clock, headings}}
+  personal := d.NodeTree.Subtree[1].Node
+  personal.Logbook(false).AddElement(failing)
+  personal.Section.Elements = append(personal.Section.Elements, unknown)
+
+  if got := len(d.DynamicBlocks()); got != 4 {
+    t.Fatalf("DynamicBlocks() found %d blocks, want 4", got)
+  }
+
+  updated, err := d.UpdateDynamicBlocks(time.Date(2050, 1, 10, 0, 0, 0, 0, time.UTC))
+  if len(updated) != 2 {
+    t.Errorf("UpdateDynamicBlocks() updated %d blocks, want 2", len(updated))
+  }
+
+  var dbue *DynamicBlockUpdateError
+  if !errors.As(err, &dbue) || !errors.Is(err, failure) || dbue.Heading != "Personal" {
+    t.Errorf("UpdateDynamicBlocks() error = %v", err)
+  }
+
+  if !strings.Contains(clock.String(), "*6:15*") {
+    t.Errorf("clocktable block =\n%s", clock.String())
+  }
+
+  if strings.Join(headings.Lines, ",") != "- Project,- Personal" {
+    t.Errorf("headings block = %v", headings.Lines)
+  }
+
+  if failing.Lines[0] != "kept" || unknown.Lines[0] != "kept" {
+    t.Error("blocks which were not updated lost their contents")
+  }
+}
@@ -1,5 +1,10 @@
 package org
 
+import (
+	"regexp"
+	"strings"
+)
+
 // BufferSettings define various metadata and client behaviors, largely to
 // handle how certain special keywords are handled or to override default
 // values for parts of an element, primarily headings.
@@ -7,6 +12,12 @@ type BufferSettings struct {
   // Tags set by the FILETAGS property, to be inherited by all
   // headilnes within the document.
   FileTags      []string
+  // Tags holds the tags, fast-select keys, and tag groups defined with the
+  // #+TAGS keyword. See TagRegistry.Add for parsing keyword values.
+  Tags          *TagRegistry
+  // TagInheritance controls which tags are inherited from parent headings
+  // and FILETAGS. When nil, DefaultTagInheritOpts is used.
+  TagInheritance *TagInheritOpts
   // Properties set within a property drawer at the top of a file
   // or with the #+PROPERTY keyword can be inherited by all nodes
   // within the document tree if org-use-property-inheritance is
@@ -16,6 +27,12 @@ type BufferSettings struct {
   // are always inherited, and apply restrictions to the allowed values
   // for the corresponding property sans-suffix.
   Properties    []*Property
+  // PropertyInheritance mirrors the org-use-property-inheritance variable,
+  // controlling which property keys are looked up on parent nodes and the
+  // document when a node does not define them itself. A nil value behaves as
+  // the org default, where no properties are inherited. Value restrictions
+  // ("_All" suffixed keys) are inherited regardless of this setting.
+  PropertyInheritance *PropertyInheritance
   // The archive location (file name and optional mark) for any tree or
   // subtree within this document. This property is inherited by all nodes
   // within the document tree.
@@ -23,7 +40,7 @@ type BufferSettings struct {
   // Sets the category of the file, and is applied to all nodes within the
   // document. Used for agenda mode sorting and filtering.
   Category      string
-  // Defines the formatting for column view
+  // Defines the formatting for column view, see ParseColumns
   Columns       string
   // Defines constants that table forumlas can make use of
   Constants     map[string]string
@@ -80,6 +97,13 @@ type BufferSettings struct {
   //
   // It is recommended to use tags in favor of types where relevant.
   TodoSettings  *TodoSettings
+  // Startup holds the behavioral options set with the #+STARTUP keyword,
+  // such as logdone. When nil, org's defaults are used.
+  Startup       *StartupSettings
+  // TodoDependencies mirrors org-enforce-todo-dependencies, controlling
+  // whether headings blocked by undone children, ORDERED siblings, or BLOCKER
+  // ids may be marked done.
+  TodoDependencies TodoDependencyPolicy
 }
 
 type HeadingPrioritySetting struct {
@@ -88,3 +112,71 @@ type HeadingPrioritySetting struct {
   Lowest    HeadingPriority
   Default   HeadingPriority
 }
+
+// PropertyInheritance describes the value held by org-use-property-inheritance,
+// which may be `t` (inherit everything), a list of property keys, or a regular
+// expression matched against the key.
+type PropertyInheritance struct {
+  Kind    PropertyInheritanceKind
+  // Keys holds the inheritable property keys when Kind is
+  // PROPERTY_INHERITANCE_LIST. Keys are compared case-insensitively.
+  Keys    []string
+  // Pattern is matched against property keys when Kind is
+  // PROPERTY_INHERITANCE_REGEXP.
+  Pattern *regexp.Regexp
+}
+
+// Returns true if a property with the given key should be looked up on parent
+// nodes when not defined on a node itself.
+func (pi *PropertyInheritance) Inherits(key string) bool {
+  switch pi.Kind {
+  case PROPERTY_INHERITANCE_ALL:
+    return true
+  case PROPERTY_INHERITANCE_LIST:
+    for _, k := range pi.Keys {
+      if strings.EqualFold(k, key) {
+        return true
+      }
+    }
+  case PROPERTY_INHERITANCE_REGEXP:
+    if pi.Pattern != nil {
+      return pi.Pattern.MatchString(key)
+    }
+  }
+
+  return false
+}
+
+type PropertyInheritanceKind int
+
+const (
+  PROPERTY_INHERITANCE_NONE PropertyInheritanceKind = iota
+  PROPERTY_INHERITANCE_ALL
+  PROPERTY_INHERITANCE_LIST
+  PROPERTY_INHERITANCE_REGEXP
+)
+
+// Rank returns a sortable value for the priority p, where lower values are of
+// higher significance. A nil priority ranks as the setting's default. Alpha
+// priorities rank by their position in the alphabet, and integer priorities
+// by their value.
+func (hps *HeadingPrioritySetting) Rank(p HeadingPriority) int {
+  if p == nil && hps != nil {
+    p = hps.Default
+  }
+
+  if p == nil {
+    p = PriorityExtrema(PRIORITY_DEFAULT)
+  }
+
+  if ihp, ok := p.(IntHeadingPriority); ok {
+    return int(ihp)
+  }
+
+  s := strings.ToUpper(p.String())
+  if s == "" {
+    return 0
+  }
+
+  return int(s[0] - 'A')
+}
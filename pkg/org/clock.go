@@ -1,11 +1,49 @@
 package org
 
 import (
+  "fmt"
+  "regexp"
+  "strconv"
   "time"
 )
 
+// ClockEntry is a CLOCK line recording time spent on a heading, E.G.:
+//
+//     CLOCK: [2050-01-01 Sat 10:00]--[2050-01-01 Sat 11:30] =>  1:30
+//
+// A clock which is still running holds only its start:
+//
+//     CLOCK: [2050-01-01 Sat 10:00]
+//
+// Org writes these into the LOGBOOK drawer by default, newest first.
 type ClockEntry struct {
+  // Start and End of the clocked time. End is zero while the clock runs.
   TimeRange Timestamp
+  // The duration written after "=>". This is normally the duration of the
+  // range, but may differ when either end was edited by hand, see Recompute.
+  Recorded  time.Duration
+}
+
+func (ce ClockEntry) Kind() ElementKind {
+  return ELEMENT_CLOCK
+}
+
+func (ce ClockEntry) IsGreaterElement() bool {
+  return false
+}
+
+func (ce *ClockEntry) String() string {
+  out := "CLOCK: " + formatClockTime(ce.TimeRange.Start)
+  if !ce.IsRunning() {
+    out += "--" + formatClockTime(ce.TimeRange.End)
+    out += " => " + FormatClockDuration(ce.Recorded)
+  }
+
+  return out
+}
+
+func (ce *ClockEntry) Strings() []string {
+  return []string{ce.String()}
 }
 
 func (ce *ClockEntry) Duration() time.Duration {
@@ -14,3 +52,293 @@ func (ce *ClockEntry) Duration() time.Duration {
   }
   return ce.TimeRange.End.Sub(ce.TimeRange.Start)
 }
+
+// Returns true if the clock has not been closed.
+func (ce *ClockEntry) IsRunning() bool {
+  return ce.TimeRange.End.IsZero()
+}
+
+// Close stops a running clock at t.
+func (ce *ClockEntry) Close(t time.Time) (*ClockEntry, error) {
+  if !ce.IsRunning() {
+    return nil, NewClockNotRunningError(ce)
+  }
+
+  if t.Before(ce.TimeRange.Start) {
+    return nil, NewStartTimeAfterEndTimeError(ce.TimeRange.Start, t)
+  }
+
+  ce.TimeRange.End = t
+  ce.TimeRange.IsRange = true
+  ce.Recompute()
+
+  return ce, nil
+}
+
+// Recompute sets the recorded duration to the duration of the clock's range,
+// returning true if it changed.
+func (ce *ClockEntry) Recompute() bool {
+  d := ce.Duration().Truncate(time.Minute)
+  changed := d != ce.Recorded
+  ce.Recorded = d
+
+  return changed
+}
+
+// Formats a duration as org does after the "=>" of a CLOCK line, E.G.,
+// " 1:30" or "12:05".
+func FormatClockDuration(d time.Duration) string {
+  mins := int(d / time.Minute)
+  return fmt.Sprintf("%2d:%02d", mins/60, mins%60)
+}
+
+var clockLineRegexp = regexp.MustCompile(
+  `^\s*CLOCK:\s*\[([^\]]+)\](?:--\[([^\]]+)\](?:\s*=>\s*(\d+):(\d{2}))?)?\s*$`)
+
+// ParseClockEntry parses a single CLOCK line, interpreting its timestamps in
+// loc.
+func ParseClockEntry(s string, loc *time.Location) (*ClockEntry, error) {
+  m := clockLineRegexp.FindStringSubmatch(s)
+  if m == nil {
+    return nil, NewInvalidClockLineError(s, "not a CLOCK line")
+  }
+
+  start, err := parseClockTime(m[1], loc)
+  if err != nil {
+    return nil, NewInvalidClockLineError(s, err.Error())
+  }
+
+  ce := &ClockEntry{TimeRange: *NewTimestamp(start, WithInactive())}
+  if m[2] == "" {
+    return ce, nil
+  }
+
+  end, err := parseClockTime(m[2], loc)
+  if err != nil {
+    return nil, NewInvalidClockLineError(s, err.Error())
+  }
+
+  if end.Before(start) {
+    return nil, NewInvalidClockLineError(s, "clock ends before it starts")
+  }
+
+  ce.TimeRange.End = end
+  ce.TimeRange.IsRange = true
+  if m[3] == "" {
+    ce.Recompute()
+    return ce, nil
+  }
+
+  h, _ := strconv.Atoi(m[3])
+  min, _ := strconv.Atoi(m[4])
+  ce.Recorded = time.Duration(h)*time.Hour + time.Duration(min)*time.Minute
+
+  return ce, nil
+}
+
+// Formats a clock timestamp as org writes it, E.G., "[2050-01-01 Sat 10:00]".
+func formatClockTime(t time.Time) string {
+  return t.Format("[2006-01-02 Mon 15:04]")
+}
+
+// Parses the inside of a clock timestamp, E.G., "2050-01-01 Sat 10:00".
+func parseClockTime(s string, loc *time.Location) (time.Time, error) {
+  ts, err := ParseTimestamp("["+s+"]", WithParseLocation(loc))
+  if err != nil {
+    return time.Time{}, err
+  }
+
+  t, ok := ts.(*Timestamp)
+  if !ok || t.DateOnly {
+    return time.Time{}, fmt.Errorf("expected a timestamp with a time of day")
+  }
+
+  return t.Start, nil
+}
+
+// Returns the name of the drawer clock lines are written to, as set by the
+// inherited CLOCK_INTO_DRAWER property, falling back to the log drawer (see
+// LogDrawerName) when unset or "t". Returns false if clock lines are written
+// directly into the section.
+func (n *Node) ClockDrawerName() (string, bool) {
+  v, ok := n.InheritedProperty("CLOCK_INTO_DRAWER")
+  switch {
+  case !ok, v == "", v == "t":
+    if name, ok := n.LogDrawerName(); ok {
+      return name, true
+    }
+    return "LOGBOOK", true
+  case v == "nil":
+    return "", false
+  }
+
+  return v, true
+}
+
+// Returns every clock entry held by the node's clock drawer, or its section
+// when not clocking into a drawer, newest first.
+func (n *Node) Clocks() []*ClockEntry {
+  out := make([]*ClockEntry, 0)
+
+  var elements []Element
+  if name, ok := n.ClockDrawerName(); ok {
+    if d := n.Drawer(name, false); d != nil {
+      elements = d.Elements
+    }
+  } else if n.Section != nil {
+    elements = n.Section.Elements
+  }
+
+  for _, e := range elements {
+    if ce, ok := e.(*ClockEntry); ok {
+      out = append(out, ce)
+    }
+  }
+
+  return out
+}
+
+// Returns the node's running clock, if any.
+func (n *Node) RunningClock() (*ClockEntry, bool) {
+  for _, ce := range n.Clocks() {
+    if ce.IsRunning() {
+      return ce, true
+    }
+  }
+
+  return nil, false
+}
+
+// ClockIn starts a clock on the node at t, adding it to the top of the
+// node's clock drawer.
+func (n *Node) ClockIn(t time.Time) (*ClockEntry, error) {
+  if ce, ok := n.RunningClock(); ok {
+    return nil, NewClockRunningError(n, ce)
+  }
+
+  ce := &ClockEntry{TimeRange: *NewTimestamp(t, WithInactive())}
+
+  if name, ok := n.ClockDrawerName(); ok {
+    d := n.Drawer(name, true)
+    d.Elements = append([]Element{ce}, d.Elements...)
+    return ce, nil
+  }
+
+  if n.Section == nil {
+    n.Section = &Section{Heading: n.Heading}
+  }
+
+  n.Section.Elements = append([]Element{ce}, n.Section.Elements...)
+  return ce, nil
+}
+
+// ClockOut stops the node's running clock at t.
+func (n *Node) ClockOut(t time.Time) (*ClockEntry, error) {
+  ce, ok := n.RunningClock()
+  if !ok {
+    return nil, NewNoRunningClockError(n)
+  }
+
+  return ce.Close(t)
+}
+
+// DanglingClock is a clock which was never closed.
+type DanglingClock struct {
+  Document *Document
+  Node     *Node
+  Clock    *ClockEntry
+}
+
+// DanglingClocks returns every running clock across docs. Org only allows a
+// single clock to run at a time, so more than one result, or a result other
+// than the clock the user expects to be running, points to a clock left open
+// by a crash or a sync conflict.
+func DanglingClocks(docs... *Document) []*DanglingClock {
+  out := make([]*DanglingClock, 0)
+  for _, doc := range docs {
+    for n := range doc.Nodes() {
+      for _, ce := range n.Clocks() {
+        if ce.IsRunning() {
+          out = append(out, &DanglingClock{Document: doc, Node: n, Clock: ce})
+        }
+      }
+    }
+  }
+
+  return out
+}
+
+// RecomputeClocks updates the recorded duration of every closed clock in the
+// document to match its range, returning the clocks which changed.
+func (d *Document) RecomputeClocks() []*ClockEntry {
+  out := make([]*ClockEntry, 0)
+  for n := range d.Nodes() {
+    for _, ce := range n.Clocks() {
+      if !ce.IsRunning() && ce.Recompute() {
+        out = append(out, ce)
+      }
+    }
+  }
+
+  return out
+}
+
+type InvalidClockLineError struct {
+  Line    string
+  Reason  string
+}
+
+func (icle InvalidClockLineError) Error() string {
+  return fmt.Sprintf("Invalid clock line %q: %s", icle.Line, icle.Reason)
+}
+
+func NewInvalidClockLineError(line, reason string) *InvalidClockLineError {
+  return &InvalidClockLineError{Line: line, Reason: reason}
+}
+
+type ClockRunningError struct {
+  Heading string
+  Clock   *ClockEntry
+}
+
+func (cre ClockRunningError) Error() string {
+  return fmt.Sprintf("Heading %q already has a clock running since %s", cre.Heading, cre.Clock.TimeRange.Start.Format(time.DateTime))
+}
+
+func NewClockRunningError(n *Node, ce *ClockEntry) *ClockRunningError {
+  e := &ClockRunningError{Clock: ce}
+  if n.Heading != nil {
+    e.Heading = n.Heading.Text
+  }
+
+  return e
+}
+
+type NoRunningClockError struct {
+  Heading string
+}
+
+func (nrce NoRunningClockError) Error() string {
+  return fmt.Sprintf("Heading %q has no running clock", nrce.Heading)
+}
+
+func NewNoRunningClockError(n *Node) *NoRunningClockError {
+  e := &NoRunningClockError{}
+  if n.Heading != nil {
+    e.Heading = n.Heading.Text
+  }
+
+  return e
+}
+
+type ClockNotRunningError struct {
+  Clock *ClockEntry
+}
+
+func (cnre ClockNotRunningError) Error() string {
+  return fmt.Sprintf("Clock started %s is already closed", cnre.Clock.TimeRange.Start.Format(time.DateTime))
+}
+
+func NewClockNotRunningError(ce *ClockEntry) *ClockNotRunningError {
+  return &ClockNotRunningError{Clock: ce}
+}
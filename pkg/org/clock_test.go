@@ -0,0 +1,113 @@
+package org
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestClockInOut(t *testing.T) {
+  d := New()
+  d.AddHeading(1, "Write report")
+  d.AddHeading(1, "Meeting")
+  n := d.NodeTree.Subtree[0].Node
+
+  start := time.Date(2050, 1, 1, 10, 0, 0, 0, time.UTC)
+  if _, err := n.ClockIn(start); err != nil {
+    t.Fatal(err)
+  }
+
+  if _, err := n.ClockIn(start); err == nil {
+    t.Error("ClockIn() with a running clock did not fail")
+  }
+
+  if got := DanglingClocks(d); len(got) != 1 || got[0].Node != n {
+    t.Errorf("DanglingClocks() = %d clocks, want 1", len(got))
+  }
+
+  ce, err := n.ClockOut(start.Add(90*time.Minute))
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  if ce.Recorded != 90*time.Minute || !strings.HasSuffix(ce.String(), "=>  1:30") {
+    t.Errorf("ClockOut() = %q", ce.String())
+  }
+
+  if _, err := n.ClockOut(start); err == nil {
+    t.Error("ClockOut() without a running clock did not fail")
+  }
+
+  if got := DanglingClocks(d); len(got) != 0 {
+    t.Errorf("DanglingClocks() after clocking out = %d clocks", len(got))
+  }
+
+  if n.Logbook(false) == nil || len(n.Clocks()) != 1 {
+    t.Error("clock was not written to the LOGBOOK drawer")
+  }
+
+  meeting := d.NodeTree.Subtree[1].Node
+  meeting.SetProperty("CLOCK_INTO_DRAWER", "CLOCKING")
+  meeting.ClockIn(start)
+  if meeting.Drawer("CLOCKING", false) == nil {
+    t.Error("clock did not honor CLOCK_INTO_DRAWER")
+  }
+}
+
+func TestParseClockEntry(t *testing.T) {
+  ce, err := ParseClockEntry("  CLOCK: [2050-01-01 Sat 10:00]--[2050-01-01 Sat 12:15] =>  1:00", time.UTC)
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  if ce.Recorded != time.Hour || ce.Duration() != 135*time.Minute {
+    t.Errorf("ParseClockEntry() recorded %v over %v", ce.Recorded, ce.Duration())
+  }
+
+  d := New()
+  d.AddHeading(1, "Edited")
+  n := d.NodeTree.Subtree[0].Node
+  n.Logbook(true).AddElement(ce)
+
+  if changed := d.RecomputeClocks(); len(changed) != 1 || ce.Recorded != 135*time.Minute {
+    t.Errorf("RecomputeClocks() changed %d clocks, recorded %v", len(changed), ce.Recorded)
+  }
+
+  running, err := ParseClockEntry("CLOCK: [2050-01-01 Sat 10:00]", time.UTC)
+  if err != nil || !running.IsRunning() {
+    t.Errorf("ParseClockEntry() of a running clock = %v, %v", running, err)
+  }
+
+  for _, s := range []string{
+    "CLOCK: [2050-01-01 Sat]",
+    "CLOCK: [2050-01-01 Sat 12:00]--[2050-01-01 Sat 10:00] =>  2:00",
+    "SCHEDULED: <2050-01-01 Sat>",
+  } {
+    if _, err := ParseClockEntry(s, time.UTC); err == nil {
+      t.Errorf("ParseClockEntry(%q) did not fail", s)
+    }
+  }
+}
+
+func TestClockEntryRoundTrip(t *testing.T) {
+  start := time.Date(2050, 3, 5, 9, 5, 0, 0, time.UTC)
+  ce := &ClockEntry{TimeRange: *NewTimestamp(start, WithInactive())}
+  if ce.String() != "CLOCK: [2050-03-05 Sat 09:05]" {
+    t.Errorf("String() = %q", ce.String())
+  }
+
+  ce.Close(start.Add(65*time.Minute))
+  want := "CLOCK: [2050-03-05 Sat 09:05]--[2050-03-05 Sat 10:10] =>  1:05"
+  if ce.String() != want {
+    t.Errorf("String() = %q, want %q", ce.String(), want)
+  }
+
+  back, err := ParseClockEntry(ce.String(), time.UTC)
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  if !back.TimeRange.Start.Equal(start) || !back.TimeRange.End.Equal(ce.TimeRange.End) || back.Recorded != ce.Recorded {
+    t.Errorf("ParseClockEntry(%q) = %q", ce.String(), back.String())
+  }
+}
@@ -0,0 +1,493 @@
+package org
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ClockReport sums the time clocked on a set of subtrees, as org's clocktable
+// does. Rows are listed in outline order, and subtrees without any clocked
+// time are left out.
+type ClockReport struct {
+  // The window clocked time is clipped to. Clocks partially within the
+  // window count only the overlapping time. A zero Start or End leaves that
+  // side of the window open.
+  Start time.Time
+  End   time.Time
+  // When set, only time clocked on headings satisfying the match is counted.
+  // Other headings are still listed when their descendants hold matching
+  // time.
+  Match *Match
+  Rows  []*ClockReportRow
+  Total time.Duration
+
+  roots []*Node
+}
+
+// ClockReportRow holds the time clocked on a single heading.
+type ClockReportRow struct {
+  Node  *Node
+  Level int
+  // Time clocked on the heading itself.
+  Own   time.Duration
+  // Time clocked on the heading and all of its descendants.
+  Total time.Duration
+}
+
+type ClockReportOpt func(*ClockReport)
+
+// Clips clocked time to the window from start up to end.
+func WithClockWindow(start, end time.Time) ClockReportOpt {
+  return func(r *ClockReport) {
+    r.Start = start
+    r.End = end
+  }
+}
+
+// Only counts time clocked on headings satisfying m.
+func WithClockMatch(m *Match) ClockReportOpt {
+  return func(r *ClockReport) {
+    r.Match = m
+  }
+}
+
+// NewClockReport sums the time clocked on each of roots and their
+// descendants. Running clocks are not counted.
+func NewClockReport(roots []*Node, opts... ClockReportOpt) *ClockReport {
+  r := &ClockReport{Rows: make([]*ClockReportRow, 0), roots: roots}
+  for _, opt := range opts {
+    opt(r)
+  }
+
+  for _, n := range roots {
+    r.Total += r.walk(n)
+  }
+
+  return r
+}
+
+func (r *ClockReport) walk(n *Node) time.Duration {
+  idx := len(r.Rows)
+  row := &ClockReportRow{Node: n, Level: n.Level()}
+  r.Rows = append(r.Rows, row)
+
+  if r.Match == nil || n.Matches(r.Match) {
+    row.Own = r.clocked(n)
+  }
+
+  row.Total = row.Own
+  if n.Tree != nil {
+    for _, st := range n.Tree.Subtree {
+      row.Total += r.walk(st.Node)
+    }
+  }
+
+  if row.Total == 0 {
+    r.Rows = r.Rows[:idx]
+  }
+
+  return row.Total
+}
+
+// Returns the time clocked on the node itself within the report's window.
+func (r *ClockReport) clocked(n *Node) time.Duration {
+  var total time.Duration
+  for _, ce := range n.Clocks() {
+    if ce.IsRunning() {
+      continue
+    }
+
+    start, end := ce.TimeRange.Start, ce.TimeRange.End
+    if !r.Start.IsZero() && start.Before(r.Start) {
+      start = r.Start
+    }
+
+    if !r.End.IsZero() && end.After(r.End) {
+      end = r.End
+    }
+
+    if end.After(start) {
+      total += end.Sub(start).Truncate(time.Minute)
+    }
+  }
+
+  return total
+}
+
+// ClockStep sets the period a stepped clock report is split into.
+type ClockStep string
+
+const (
+  CLOCK_STEP_NONE  ClockStep = ""
+  CLOCK_STEP_DAY   ClockStep = "day"
+  // weeks start on Monday, as with org's default :wstart
+  CLOCK_STEP_WEEK  ClockStep = "week"
+  CLOCK_STEP_MONTH ClockStep = "month"
+)
+
+// Split divides the report's window into consecutive periods of the given
+// step, returning a report for each. The report's window must be bounded.
+// The first and last periods are clipped to the window.
+func (r *ClockReport) Split(step ClockStep) ([]*ClockReport, error) {
+  if r.Start.IsZero() || r.End.IsZero() {
+    return nil, NewUnboundedClockReportError()
+  }
+
+  out := make([]*ClockReport, 0)
+  for start := r.Start; start.Before(r.End); {
+    var next time.Time
+    day := time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, start.Location())
+    switch step {
+    case CLOCK_STEP_DAY:
+      next = day.AddDate(0, 0, 1)
+    case CLOCK_STEP_WEEK:
+      next = day.AddDate(0, 0, 7-(int(day.Weekday())+6)%7)
+    case CLOCK_STEP_MONTH:
+      next = time.Date(day.Year(), day.Month()+1, 1, 0, 0, 0, 0, day.Location())
+    default:
+      return []*ClockReport{r}, nil
+    }
+
+    if next.After(r.End) {
+      next = r.End
+    }
+
+    out = append(out, NewClockReport(r.roots, WithClockWindow(start, next), WithClockMatch(r.Match)))
+    start = next
+  }
+
+  return out, nil
+}
+
+// Table renders the report as org's clocktable does, with one time column
+// per heading level up to maxLevel. Time clocked below maxLevel is included
+// in the rows of its ancestors. A maxLevel of zero or less lists every level.
+func (r *ClockReport) Table(maxLevel int) []string {
+  levels := 1
+  for _, row := range r.Rows {
+    if maxLevel <= 0 || row.Level <= maxLevel {
+      levels = max(levels, row.Level)
+    }
+  }
+
+  newRow := func(name string) []string {
+    row := make([]string, levels+1)
+    row[0] = name
+    return row
+  }
+
+  header := newRow("Headline")
+  header[1] = "Time"
+  total := newRow("*Total time*")
+  total[1] = "*" + FormatClockSum(r.Total) + "*"
+
+  rows := [][]string{header, nil, total, nil}
+  for _, row := range r.Rows {
+    if maxLevel > 0 && row.Level > maxLevel {
+      continue
+    }
+
+    title := ""
+    if row.Node.Heading != nil {
+      title = row.Node.Heading.Text
+    }
+
+    if row.Level > 1 {
+      title = `\_` + strings.Repeat(" ", 2*(row.Level-1)) + title
+    }
+
+    cells := newRow(title)
+    cells[max(row.Level, 1)] = FormatClockSum(row.Total)
+    rows = append(rows, cells)
+  }
+
+  return alignTable(rows)
+}
+
+// Formats a sum of clocked time as org-duration does by default, E.G., "2:30"
+// or "1d 2:30".
+func FormatClockSum(d time.Duration) string {
+  return FormatDuration(d, DURATION_FORMAT_DEFAULT)
+}
+
+// ClockTableParams holds the parameters of a clocktable dynamic block, E.G.:
+//
+//     #+BEGIN: clocktable :maxlevel 2 :scope subtree :block thisweek :step day
+type ClockTableParams struct {
+  // Deepest heading level listed, defaults to 3.
+  MaxLevel int
+  // One of "file" (the default), "subtree" (the heading holding the block),
+  // "tree" (the top level heading above the block), or "treeN" (the level N
+  // heading above the block).
+  Scope    string
+  // A named period such as "today", "yesterday", "thisweek", "lastweek",
+  // "thismonth", "lastmonth", "thisyear" or "lastyear", or a date such as
+  // "2050-01-05", "2050-W02", "2050-01" or "2050".
+  Block    string
+  // Explicit window bounds given with :tstart and :tend, narrowing Block.
+  TStart   time.Time
+  TEnd     time.Time
+  Step     ClockStep
+  Match    *Match
+}
+
+// ParseClockTableParams reads clocktable parameters from a block's parameter
+// list, interpreting dates in loc. Unknown parameters are ignored.
+func ParseClockTableParams(bp BlockParams, loc *time.Location) (*ClockTableParams, error) {
+  p := &ClockTableParams{MaxLevel: 3, Scope: "file"}
+
+  for _, param := range bp {
+    invalid := NewInvalidBlockParamError("clocktable", param.Key, param.Value)
+
+    switch param.Key {
+    case "maxlevel":
+      v, err := strconv.Atoi(param.Value)
+      if err != nil || v < 1 {
+        return nil, invalid
+      }
+      p.MaxLevel = v
+    case "scope":
+      if !clockScopeRegexp.MatchString(param.Value) {
+        return nil, invalid
+      }
+      p.Scope = param.Value
+    case "block":
+      p.Block = param.Value
+    case "tstart", "tend":
+      t, err := parseClockTableTime(param.Value, loc)
+      if err != nil {
+        return nil, invalid
+      }
+
+      if param.Key == "tstart" {
+        p.TStart = t
+      } else {
+        p.TEnd = t
+      }
+    case "step":
+      switch ClockStep(param.Value) {
+      case CLOCK_STEP_DAY, CLOCK_STEP_WEEK, CLOCK_STEP_MONTH:
+        p.Step = ClockStep(param.Value)
+      default:
+        return nil, invalid
+      }
+    case "match":
+      m, err := ParseMatch(param.Value)
+      if err != nil {
+        return nil, err
+      }
+      p.Match = m
+    }
+  }
+
+  if p.Step != CLOCK_STEP_NONE && p.Block == "" && (p.TStart.IsZero() || p.TEnd.IsZero()) {
+    return nil, NewInvalidBlockParamError("clocktable", "step", string(p.Step))
+  }
+
+  return p, nil
+}
+
+var clockScopeRegexp = regexp.MustCompile(`^(file|subtree|tree[0-9]*)$`)
+
+// Parses a :tstart or :tend value such as "<2050-01-01 Sat>" or
+// "<2050-01-01 Sat 10:00>".
+func parseClockTableTime(s string, loc *time.Location) (time.Time, error) {
+  s = strings.Trim(s, `" `)
+  if !strings.HasPrefix(s, "<") && !strings.HasPrefix(s, "[") {
+    s = "<" + s + ">"
+  }
+
+  ts, err := ParseTimestamp(s, WithParseLocation(loc))
+  if err != nil {
+    return time.Time{}, err
+  }
+
+  t, ok := ts.(*Timestamp)
+  if !ok {
+    return time.Time{}, fmt.Errorf("expected a single timestamp")
+  }
+
+  return t.Start, nil
+}
+
+// Returns the window selected by the :block, :tstart and :tend parameters,
+// relative to now. Either bound is zero when unset.
+func (p *ClockTableParams) Window(now time.Time) (time.Time, time.Time, error) {
+  var start, end time.Time
+  if p.Block != "" {
+    var err error
+    start, end, err = clockBlockWindow(p.Block, now)
+    if err != nil {
+      return start, end, err
+    }
+  }
+
+  if !p.TStart.IsZero() && (start.IsZero() || p.TStart.After(start)) {
+    start = p.TStart
+  }
+
+  if !p.TEnd.IsZero() && (end.IsZero() || p.TEnd.Before(end)) {
+    end = p.TEnd
+  }
+
+  return start, end, nil
+}
+
+var clockWeekRegexp = regexp.MustCompile(`^(\d{4})-W(\d{2})$`)
+
+func clockBlockWindow(block string, now time.Time) (time.Time, time.Time, error) {
+  loc := now.Location()
+  today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, loc)
+  monday := today.AddDate(0, 0, -((int(today.Weekday()) + 6) % 7))
+  month := time.Date(today.Year(), today.Month(), 1, 0, 0, 0, 0, loc)
+  year := time.Date(today.Year(), 1, 1, 0, 0, 0, 0, loc)
+
+  switch block {
+  case "today":
+    return today, today.AddDate(0, 0, 1), nil
+  case "yesterday":
+    return today.AddDate(0, 0, -1), today, nil
+  case "thisweek":
+    return monday, monday.AddDate(0, 0, 7), nil
+  case "lastweek":
+    return monday.AddDate(0, 0, -7), monday, nil
+  case "thismonth":
+    return month, month.AddDate(0, 1, 0), nil
+  case "lastmonth":
+    return month.AddDate(0, -1, 0), month, nil
+  case "thisyear":
+    return year, year.AddDate(1, 0, 0), nil
+  case "lastyear":
+    return year.AddDate(-1, 0, 0), year, nil
+  }
+
+  if m := clockWeekRegexp.FindStringSubmatch(block); m != nil {
+    y, _ := strconv.Atoi(m[1])
+    w, _ := strconv.Atoi(m[2])
+    // January 4th always falls within the first ISO week
+    jan4 := time.Date(y, 1, 4, 0, 0, 0, 0, loc)
+    start := jan4.AddDate(0, 0, -((int(jan4.Weekday())+6)%7) + (w-1)*7)
+    return start, start.AddDate(0, 0, 7), nil
+  }
+
+  for _, f := range []struct{ layout string; y, m, d int }{
+    {time.DateOnly, 0, 0, 1},
+    {"2006-01", 0, 1, 0},
+    {"2006", 1, 0, 0},
+  } {
+    if t, err := time.ParseInLocation(f.layout, block, loc); err == nil {
+      return t, t.AddDate(f.y, f.m, f.d), nil
+    }
+  }
+
+  return time.Time{}, time.Time{}, NewInvalidBlockParamError("clocktable", "block", block)
+}
+
+// Returns the nodes the table covers for the given scope, where at is the
+// node holding the block.
+func (p *ClockTableParams) roots(d *Document, at *Node) ([]*Node, error) {
+  if p.Scope == "file" {
+    out := make([]*Node, 0)
+    for _, st := range d.NodeTree.Subtree {
+      out = append(out, st.Node)
+    }
+    return out, nil
+  }
+
+  if at == nil || at.Heading == nil {
+    return nil, NewInvalidBlockParamError("clocktable", "scope", p.Scope)
+  }
+
+  if p.Scope == "subtree" {
+    return []*Node{at}, nil
+  }
+
+  level := 1
+  if lvl := strings.TrimPrefix(p.Scope, "tree"); lvl != "" {
+    level, _ = strconv.Atoi(lvl)
+  }
+
+  cur := at
+  for cur.Parent() != nil && cur.Parent().Heading != nil && cur.Level() > level {
+    cur = cur.Parent()
+  }
+
+  return []*Node{cur}, nil
+}
+
+// ClockTable renders the contents of a clocktable block with the given
+// parameters, as found under the heading at (nil for blocks outside any
+// heading) in d. now is used for the caption and for relative :block values.
+func ClockTable(d *Document, at *Node, params BlockParams, now time.Time) ([]string, error) {
+  p, err := ParseClockTableParams(params, now.Location())
+  if err != nil {
+    return nil, err
+  }
+
+  roots, err := p.roots(d, at)
+  if err != nil {
+    return nil, err
+  }
+
+  start, end, err := p.Window(now)
+  if err != nil {
+    return nil, err
+  }
+
+  report := NewClockReport(roots, WithClockWindow(start, end), WithClockMatch(p.Match))
+  out := []string{"#+CAPTION: Clock summary at " + NewTimestamp(now, WithInactive()).String()}
+  if p.Step == CLOCK_STEP_NONE {
+    return append(out, report.Table(p.MaxLevel)...), nil
+  }
+
+  steps, err := report.Split(p.Step)
+  if err != nil {
+    return nil, err
+  }
+
+  out = out[:0]
+  for i, s := range steps {
+    if i > 0 {
+      out = append(out, "")
+    }
+
+    day := NewTimestamp(s.Start, WithInactive(), WithDateOnly()).String()
+    switch p.Step {
+    case CLOCK_STEP_DAY:
+      out = append(out, "Daily report: "+day)
+    case CLOCK_STEP_WEEK:
+      out = append(out, "Weekly report starting on: "+day)
+    case CLOCK_STEP_MONTH:
+      out = append(out, "Monthly report starting on: "+day)
+    }
+
+    out = append(out, s.Table(p.MaxLevel)...)
+  }
+
+  return out, nil
+}
+
+// ClockTableBlock renders a complete clocktable dynamic block, from its
+// #+BEGIN line through #+END:, see ClockTable.
+func ClockTableBlock(d *Document, at *Node, params BlockParams, now time.Time) ([]string, error) {
+  body, err := ClockTable(d, at, params, now)
+  if err != nil {
+    return nil, err
+  }
+
+  db := &DynamicBlock{Name: "clocktable", Params: params, Lines: body}
+  return db.Strings(), nil
+}
+
+type UnboundedClockReportError struct{}
+
+func (UnboundedClockReportError) Error() string {
+  return "Clock report window must have a start and end to be split into steps"
+}
+
+func NewUnboundedClockReportError() *UnboundedClockReportError {
+  return &UnboundedClockReportError{}
+}
@@ -0,0 +1,147 @@
+package org
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func testingClockDocument(t *testing.T) *Document {
+  d := New()
+  d.AddHeading(1, "Project", WithTags([]string{"work"}))
+  d.AddHeading(2, "Task A")
+  d.AddHeading(3, "Deep")
+  d.AddHeading(1, "Personal", WithTags([]string{"home"}))
+
+  clock := func(n *Node, start time.Time, d time.Duration) {
+    if _, err := n.ClockIn(start); err != nil {
+      t.Fatal(err)
+    }
+
+    if _, err := n.ClockOut(start.Add(d)); err != nil {
+      t.Fatal(err)
+    }
+  }
+
+  at := func(day, hour, min int) time.Time {
+    return time.Date(2050, 1, day, hour, min, 0, 0, time.UTC)
+  }
+
+  project := d.NodeTree.Subtree[0]
+  clock(project.Node, at(3, 10, 0), 2*time.Hour)
+  clock(project.Subtree[0].Node, at(4, 9, 0), 90*time.Minute)
+  clock(project.Subtree[0].Subtree[0].Node, at(4, 23, 0), 2*time.Hour)
+  clock(d.NodeTree.Subtree[1].Node, at(5, 8, 0), 45*time.Minute)
+
+  return d
+}
+
+func testingClockRoots(d *Document) []*Node {
+  return []*Node{d.NodeTree.Subtree[0].Node, d.NodeTree.Subtree[1].Node}
+}
+
+func TestClockReport(t *testing.T) {
+  d := testingClockDocument(t)
+
+  r := NewClockReport(testingClockRoots(d))
+  wantTotals := []string{"5:30", "3:30", "2:00", "0:45"}
+  if len(r.Rows) != len(wantTotals) || FormatClockSum(r.Total) != "6:15" {
+    t.Fatalf("NewClockReport() = %d rows totalling %s", len(r.Rows), FormatClockSum(r.Total))
+  }
+
+  for i, w := range wantTotals {
+    if got := FormatClockSum(r.Rows[i].Total); got != w {
+      t.Errorf("row %d total = %s, want %s", i, got, w)
+    }
+  }
+
+  day := func(d int) time.Time {
+    return time.Date(2050, 1, d, 0, 0, 0, 0, time.UTC)
+  }
+
+  clipped := NewClockReport(testingClockRoots(d), WithClockWindow(day(4), day(5)))
+  if got := FormatClockSum(clipped.Total); got != "2:30" || len(clipped.Rows) != 3 {
+    t.Errorf("clipped report = %d rows totalling %s, want 3 totalling 2:30", len(clipped.Rows), got)
+  }
+
+  m, _ := ParseMatch("work")
+  if got := NewClockReport(testingClockRoots(d), WithClockMatch(m)); FormatClockSum(got.Total) != "5:30" {
+    t.Errorf("matched report total = %s, want 5:30", FormatClockSum(got.Total))
+  }
+
+  steps, err := NewClockReport(testingClockRoots(d), WithClockWindow(day(3), day(6))).Split(CLOCK_STEP_DAY)
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  wantSteps := []string{"2:00", "2:30", "1:45"}
+  for i, s := range steps {
+    if got := FormatClockSum(s.Total); i >= len(wantSteps) || got != wantSteps[i] {
+      t.Errorf("step %d total = %s", i, got)
+    }
+  }
+
+  if _, err := r.Split(CLOCK_STEP_WEEK); err == nil {
+    t.Error("Split() of an unbounded report did not fail")
+  }
+
+  want := []string{
+    `| Headline     | Time   |      |`,
+    `|--------------+--------+------|`,
+    `| *Total time* | *6:15* |      |`,
+    `|--------------+--------+------|`,
+    `| Project      | 5:30   |      |`,
+    `| \_  Task A   |        | 3:30 |`,
+    `| Personal     | 0:45   |      |`,
+  }
+
+  if got := r.Table(2); strings.Join(got, "\n") != strings.Join(want, "\n") {
+    t.Errorf("Table(2) =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+  }
+}
+
+func TestClockTableBlock(t *testing.T) {
+  d := testingClockDocument(t)
+  now := time.Date(2050, 1, 5, 12, 0, 0, 0, time.UTC)
+
+  params := ParseBlockParams(`:maxlevel 1 :scope file :block thisweek :step day :match "work|home"`)
+  if v, _ := params.Get(":match"); v != "work|home" {
+    t.Errorf("ParseBlockParams() match = %q", v)
+  }
+
+  out, err := ClockTableBlock(d, nil, params, now)
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  if out[0] != `#+BEGIN: clocktable :maxlevel 1 :scope file :block thisweek :step day :match work|home` || out[len(out)-1] != "#+END:" {
+    t.Errorf("ClockTableBlock() delimiters = %q, %q", out[0], out[len(out)-1])
+  }
+
+  reports := 0
+  for _, l := range out {
+    if strings.HasPrefix(l, "Daily report: ") {
+      reports++
+    }
+  }
+
+  if reports != 7 {
+    t.Errorf("ClockTableBlock() produced %d daily reports, want 7", reports)
+  }
+
+  task := d.NodeTree.Subtree[0].Subtree[0].Node
+  body, err := ClockTable(d, task, ParseBlockParams(":scope tree1 :maxlevel 3"), now)
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  if !strings.Contains(strings.Join(body, "\n"), "*5:30*") {
+    t.Errorf("ClockTable() with tree1 scope =\n%s", strings.Join(body, "\n"))
+  }
+
+  for _, p := range []string{":maxlevel none", ":scope agenda-with-archives", ":block someday", ":step day"} {
+    if _, err := ClockTable(d, task, ParseBlockParams(p), now); err == nil {
+      t.Errorf("ClockTable(%q) did not fail", p)
+    }
+  }
+}
@@ -0,0 +1,575 @@
+package org
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DEFAULT_COLUMNS mirrors org-columns-default-format, used when neither a
+// COLUMNS property nor a #+COLUMNS keyword applies.
+const DEFAULT_COLUMNS = "%25ITEM %TODO %3PRIORITY %TAGS"
+
+// ColumnSpec is a parsed column view format, as given by a #+COLUMNS keyword
+// or COLUMNS property, E.G.:
+//
+//     %25ITEM %TODO %3PRIORITY %Effort(Estimate){:} %CLOCKSUM
+type ColumnSpec struct {
+  Columns []*Column
+}
+
+// Column is a single column of a column view.
+type Column struct {
+  // The property shown. Besides regular properties, the special properties
+  // ITEM, TODO, PRIORITY, TAGS, ALLTAGS, CATEGORY, LEVEL, SCHEDULED,
+  // DEADLINE, CLOSED, CLOCKSUM and CLOCKSUM_T are supported.
+  Property      string
+  // The column's title, defaulting to Property.
+  Title         string
+  // The column's width, or zero to size it to its contents.
+  Width         int
+  // Operator summarizing the values of a heading's children into its own
+  // value, or empty for none.
+  Summary       ColumnSummary
+  // An optional printf format given after the operator, E.G., %.1f in
+  // {+;%.1f}.
+  SummaryFormat string
+}
+
+// ColumnSummary mirrors the summary types of org-columns-summary-types.
+type ColumnSummary string
+
+const (
+  SUMMARY_NONE             ColumnSummary = ""
+  // sum of numbers
+  SUMMARY_SUM              ColumnSummary = "+"
+  // sum of numbers, with two decimals
+  SUMMARY_CURRENCY         ColumnSummary = "$"
+  SUMMARY_MIN              ColumnSummary = "min"
+  SUMMARY_MAX              ColumnSummary = "max"
+  SUMMARY_MEAN             ColumnSummary = "mean"
+  // sum of durations, E.G., 1:30
+  SUMMARY_TIME             ColumnSummary = ":"
+  SUMMARY_TIME_MIN         ColumnSummary = ":min"
+  SUMMARY_TIME_MAX         ColumnSummary = ":max"
+  SUMMARY_TIME_MEAN        ColumnSummary = ":mean"
+  // [X] when every child is checked, [ ] otherwise
+  SUMMARY_CHECKBOX         ColumnSummary = "X"
+  // checked children out of all children, E.G., [2/3]
+  SUMMARY_CHECKBOX_COUNT   ColumnSummary = "X/"
+  // percentage of checked children, E.G., [66%]
+  SUMMARY_CHECKBOX_PERCENT ColumnSummary = "X%"
+  // sum of "low-high" estimates
+  SUMMARY_ESTIMATE         ColumnSummary = "est+"
+)
+
+var columnRegexp = regexp.MustCompile(`%(\d*)([^\s(){}%]+)(?:\(([^)]*)\))?(?:\{([^}]*)\})?`)
+
+// ParseColumns parses a column view format.
+func ParseColumns(s string) (*ColumnSpec, error) {
+  cs := &ColumnSpec{Columns: make([]*Column, 0)}
+
+  last := 0
+  for _, m := range columnRegexp.FindAllStringSubmatchIndex(s, -1) {
+    if strings.TrimSpace(s[last:m[0]]) != "" {
+      return nil, NewInvalidColumnSpecError(s, fmt.Sprintf("unexpected %q", strings.TrimSpace(s[last:m[0]])))
+    }
+    last = m[1]
+
+    col := &Column{Property: s[m[4]:m[5]]}
+    if m[3] > m[2] {
+      col.Width, _ = strconv.Atoi(s[m[2]:m[3]])
+    }
+
+    col.Title = col.Property
+    if m[6] >= 0 {
+      col.Title = s[m[6]:m[7]]
+    }
+
+    if m[8] >= 0 {
+      op, format, _ := strings.Cut(s[m[8]:m[9]], ";")
+      col.Summary = ColumnSummary(op)
+      col.SummaryFormat = format
+      if !col.Summary.valid() {
+        return nil, NewInvalidColumnSpecError(s, fmt.Sprintf("unknown summary type {%s}", op))
+      }
+    }
+
+    cs.Columns = append(cs.Columns, col)
+  }
+
+  if strings.TrimSpace(s[last:]) != "" || len(cs.Columns) == 0 {
+    return nil, NewInvalidColumnSpecError(s, "expected columns of the form %[width]PROPERTY[(title)][{summary}]")
+  }
+
+  return cs, nil
+}
+
+func (cs ColumnSummary) valid() bool {
+  switch cs {
+  case SUMMARY_NONE, SUMMARY_SUM, SUMMARY_CURRENCY, SUMMARY_MIN, SUMMARY_MAX,
+    SUMMARY_MEAN, SUMMARY_TIME, SUMMARY_TIME_MIN, SUMMARY_TIME_MAX,
+    SUMMARY_TIME_MEAN, SUMMARY_CHECKBOX, SUMMARY_CHECKBOX_COUNT,
+    SUMMARY_CHECKBOX_PERCENT, SUMMARY_ESTIMATE:
+    return true
+  }
+
+  return false
+}
+
+func (c *Column) String() string {
+  out := "%"
+  if c.Width > 0 {
+    out += strconv.Itoa(c.Width)
+  }
+
+  out += c.Property
+  if c.Title != c.Property {
+    out += "(" + c.Title + ")"
+  }
+
+  if c.Summary != SUMMARY_NONE {
+    out += "{" + string(c.Summary)
+    if c.SummaryFormat != "" {
+      out += ";" + c.SummaryFormat
+    }
+    out += "}"
+  }
+
+  return out
+}
+
+func (cs *ColumnSpec) String() string {
+  out := make([]string, 0, len(cs.Columns))
+  for _, c := range cs.Columns {
+    out = append(out, c.String())
+  }
+
+  return strings.Join(out, " ")
+}
+
+// Columns returns the column view format in effect for the node: its
+// inherited COLUMNS property, or the document's #+COLUMNS setting, or
+// DEFAULT_COLUMNS.
+func (n *Node) Columns() (*ColumnSpec, error) {
+  if v, ok := n.InheritedProperty("COLUMNS"); ok && strings.TrimSpace(v) != "" {
+    return ParseColumns(v)
+  }
+
+  if bs := n.bufferSettings(); bs != nil && strings.TrimSpace(bs.Columns) != "" {
+    return ParseColumns(bs.Columns)
+  }
+
+  return ParseColumns(DEFAULT_COLUMNS)
+}
+
+// ColumnValue returns the value the node shows in a column for the given
+// property, before any summary is applied. CLOCKSUM_T counts the time clocked
+// today.
+func (n *Node) ColumnValue(prop string) (string, bool) {
+  return n.columnValue(prop, time.Now())
+}
+
+func (n *Node) columnValue(prop string, now time.Time) (string, bool) {
+  h := n.Heading
+  if h == nil {
+    return "", false
+  }
+
+  nonEmpty := func(s string) (string, bool) {
+    return s, s != ""
+  }
+
+  planning := func(kind PlanningKind) (string, bool) {
+    if p := h.GetPlanning(kind); p != nil && p.TimestampRangeOrSexp != nil {
+      return p.TimestampRangeOrSexp.String(), true
+    }
+    return "", false
+  }
+
+  switch strings.ToUpper(prop) {
+  case "ITEM":
+    return h.Text, true
+  case "TODO":
+    return nonEmpty(h.TodoKeyword)
+  case "PRIORITY":
+    return h.GetPriority().String(), true
+  case "TAGS":
+    if len(h.Tags) == 0 {
+      return "", false
+    }
+    return ":" + strings.Join(h.Tags, ":") + ":", true
+  case "ALLTAGS", "CATEGORY", "LEVEL":
+    return nonEmpty(matchPropertyValue(n, prop))
+  case "SCHEDULED":
+    return planning(PLANNING_SCHEDULED)
+  case "DEADLINE":
+    return planning(PLANNING_DEADLINE)
+  case "CLOSED":
+    return planning(PLANNING_CLOSED)
+  case "CLOCKSUM", "CLOCKSUM_T":
+    opts := make([]ClockReportOpt, 0)
+    if strings.EqualFold(prop, "CLOCKSUM_T") {
+      y, m, d := now.Date()
+      start := time.Date(y, m, d, 0, 0, 0, 0, now.Location())
+      opts = append(opts, WithClockWindow(start, start.AddDate(0, 0, 1)))
+    }
+
+    total := NewClockReport([]*Node{n}, opts...).Total
+    if total == 0 {
+      return "", false
+    }
+    return FormatClockSum(total), true
+  }
+
+  return n.Property(prop)
+}
+
+// ColumnView is a table of column values for a set of subtrees, as shown by
+// org's column view and columnview dynamic block.
+type ColumnView struct {
+  Spec *ColumnSpec
+  Rows []*ColumnViewRow
+}
+
+// ColumnViewRow holds the values of a single heading, one per column.
+// Columns with a summary type hold the summary of the heading's children when
+// any of them holds a value.
+type ColumnViewRow struct {
+  Node   *Node
+  Level  int
+  Values []string
+}
+
+type ColumnViewOpt func(*columnViewConfig)
+
+type columnViewConfig struct {
+  maxLevel  int
+  skipEmpty bool
+  now       time.Time
+}
+
+// Only lists headings up to the given level. Summaries still include deeper
+// headings.
+func WithColumnMaxLevel(lvl int) ColumnViewOpt {
+  return func(c *columnViewConfig) {
+    c.maxLevel = lvl
+  }
+}
+
+// Leaves out rows whose values, ignoring the ITEM column, are all empty.
+func WithSkipEmptyRows() ColumnViewOpt {
+  return func(c *columnViewConfig) {
+    c.skipEmpty = true
+  }
+}
+
+// Sets the time CLOCKSUM_T is evaluated against.
+func WithColumnTime(t time.Time) ColumnViewOpt {
+  return func(c *columnViewConfig) {
+    c.now = t
+  }
+}
+
+// View builds the column view of each of roots and their descendants.
+func (cs *ColumnSpec) View(roots []*Node, opts... ColumnViewOpt) *ColumnView {
+  cfg := &columnViewConfig{now: time.Now()}
+  for _, opt := range opts {
+    opt(cfg)
+  }
+
+  cv := &ColumnView{Spec: cs, Rows: make([]*ColumnViewRow, 0)}
+  for _, n := range roots {
+    cv.collect(n, cfg)
+  }
+
+  return cv
+}
+
+// Adds the rows for the node's subtree, returning the node's values and
+// whether each holds a value.
+func (cv *ColumnView) collect(n *Node, cfg *columnViewConfig) ([]string, []bool) {
+  row := &ColumnViewRow{Node: n, Level: n.Level(), Values: make([]string, len(cv.Spec.Columns))}
+  has := make([]bool, len(cv.Spec.Columns))
+
+  listed := cfg.maxLevel <= 0 || row.Level <= cfg.maxLevel
+  if listed {
+    cv.Rows = append(cv.Rows, row)
+  }
+
+  for i, c := range cv.Spec.Columns {
+    row.Values[i], has[i] = n.columnValue(c.Property, cfg.now)
+  }
+
+  children := make([][]string, len(cv.Spec.Columns))
+  if n.Tree != nil {
+    for _, st := range n.Tree.Subtree {
+      vals, ok := cv.collect(st.Node, cfg)
+      for i := range vals {
+        if ok[i] {
+          children[i] = append(children[i], vals[i])
+        }
+      }
+    }
+  }
+
+  for i, c := range cv.Spec.Columns {
+    if c.Summary != SUMMARY_NONE && len(children[i]) > 0 {
+      row.Values[i], has[i] = c.summarize(children[i]), true
+    }
+  }
+
+  if listed && cfg.skipEmpty && cv.empty(row) {
+    cv.Rows = removeColumnViewRow(cv.Rows, row)
+  }
+
+  return row.Values, has
+}
+
+func (cv *ColumnView) empty(row *ColumnViewRow) bool {
+  for i, c := range cv.Spec.Columns {
+    if !strings.EqualFold(c.Property, "ITEM") && row.Values[i] != "" {
+      return false
+    }
+  }
+
+  return true
+}
+
+func removeColumnViewRow(rows []*ColumnViewRow, row *ColumnViewRow) []*ColumnViewRow {
+  for i, r := range rows {
+    if r == row {
+      return append(rows[:i], rows[i+1:]...)
+    }
+  }
+
+  return rows
+}
+
+// Table renders the view as an org table, with the column titles as its
+// header. ITEM values are prefixed with stars giving the heading's level.
+// When hlines is greater than zero, a horizontal rule precedes every heading
+// of that level or above.
+func (cv *ColumnView) Table(hlines int) []string {
+  header := make([]string, len(cv.Spec.Columns))
+  for i, c := range cv.Spec.Columns {
+    header[i] = c.Title
+  }
+
+  rows := [][]string{header, nil}
+  for i, r := range cv.Rows {
+    if hlines > 0 && i > 0 && r.Level <= hlines {
+      rows = append(rows, nil)
+    }
+
+    cells := make([]string, len(r.Values))
+    for j, c := range cv.Spec.Columns {
+      cells[j] = strings.ReplaceAll(r.Values[j], "|", `\vert{}`)
+      if strings.EqualFold(c.Property, "ITEM") {
+        cells[j] = strings.Repeat("*", r.Level) + " " + cells[j]
+      }
+    }
+
+    rows = append(rows, cells)
+  }
+
+  return alignTable(rows)
+}
+
+// Summarizes the values of a heading's children.
+func (c *Column) summarize(vals []string) string {
+  switch c.Summary {
+  case SUMMARY_CHECKBOX, SUMMARY_CHECKBOX_COUNT, SUMMARY_CHECKBOX_PERCENT:
+    checked := 0
+    for _, v := range vals {
+      if v == "[X]" {
+        checked++
+      }
+    }
+
+    switch c.Summary {
+    case SUMMARY_CHECKBOX_COUNT:
+      return fmt.Sprintf("[%d/%d]", checked, len(vals))
+    case SUMMARY_CHECKBOX_PERCENT:
+      return fmt.Sprintf("[%d%%]", checked*100/len(vals))
+    }
+
+    if checked == len(vals) {
+      return "[X]"
+    }
+    return "[ ]"
+  case SUMMARY_ESTIMATE:
+    return summarizeEstimates(vals)
+  case SUMMARY_TIME, SUMMARY_TIME_MIN, SUMMARY_TIME_MAX, SUMMARY_TIME_MEAN:
+    mins := make([]float64, 0, len(vals))
+    for _, v := range vals {
+      mins = append(mins, columnMinutes(v))
+    }
+
+    return FormatClockSum(time.Duration(aggregate(c.Summary, mins) * float64(time.Minute)))
+  }
+
+  nums := make([]float64, 0, len(vals))
+  for _, v := range vals {
+    f, _ := strconv.ParseFloat(strings.TrimSpace(v), 64)
+    nums = append(nums, f)
+  }
+
+  v := aggregate(c.Summary, nums)
+  switch {
+  case c.SummaryFormat != "":
+    return fmt.Sprintf(c.SummaryFormat, v)
+  case c.Summary == SUMMARY_CURRENCY:
+    return fmt.Sprintf("%.2f", v)
+  }
+
+  return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+func aggregate(kind ColumnSummary, vals []float64) float64 {
+  out := 0.0
+  for i, v := range vals {
+    switch kind {
+    case SUMMARY_MIN, SUMMARY_TIME_MIN:
+      if i == 0 || v < out {
+        out = v
+      }
+    case SUMMARY_MAX, SUMMARY_TIME_MAX:
+      if i == 0 || v > out {
+        out = v
+      }
+    default:
+      out += v
+    }
+  }
+
+  if (kind == SUMMARY_MEAN || kind == SUMMARY_TIME_MEAN) && len(vals) > 0 {
+    out /= float64(len(vals))
+  }
+
+  return out
+}
+
+// Sums "low-high" estimates as org does: the result spans one standard
+// deviation either side of the summed means.
+func summarizeEstimates(vals []string) string {
+  mean, variance := 0.0, 0.0
+  for _, v := range vals {
+    parts := strings.Split(v, "-")
+    low, _ := strconv.ParseFloat(strings.TrimSpace(parts[0]), 64)
+    if len(parts) != 2 {
+      mean += low
+      continue
+    }
+
+    high, _ := strconv.ParseFloat(strings.TrimSpace(parts[1]), 64)
+    m := (low + high) / 2
+    mean += m
+    variance += (low*low + high*high) / 2 - m*m
+  }
+
+  sd := math.Sqrt(variance)
+  return fmt.Sprintf("%.0f-%.0f", mean-sd, mean+sd)
+}
+
+// Returns the number of minutes in a duration value, see ParseDuration.
+// Values which can not be parsed count as zero.
+func columnMinutes(v string) float64 {
+  d, err := ParseDuration(v)
+  if err != nil {
+    return 0
+  }
+
+  return d.Minutes()
+}
+
+func init() {
+  RegisterDynamicBlock("columnview", func(ctx *DynamicBlockContext) ([]string, error) {
+    return ColumnViewTable(ctx.Document, ctx.Node, ctx.Block.Params, ctx.Now)
+  })
+}
+
+// ColumnViewTable renders the contents of a columnview block with the given
+// parameters, as found under the heading at (nil for blocks outside any
+// heading) in d. Supported parameters are :id ("local" for the heading
+// holding the block, the default, "global" for the whole document, or the ID
+// of a heading), :format, :maxlevel, :hlines and :skip-empty-rows.
+func ColumnViewTable(d *Document, at *Node, params BlockParams, now time.Time) ([]string, error) {
+  var roots []*Node
+  id, _ := params.Get("id")
+  switch {
+  case id == "global" || (id == "" || id == "local") && (at == nil || at.Heading == nil):
+    for _, st := range d.NodeTree.Subtree {
+      roots = append(roots, st.Node)
+    }
+  case id == "" || id == "local":
+    roots = []*Node{at}
+  default:
+    n := d.FindByID(strings.Trim(id, `"`))
+    if n == nil {
+      return nil, NewInvalidBlockParamError("columnview", "id", id)
+    }
+    roots = []*Node{n}
+  }
+
+  var spec *ColumnSpec
+  var err error
+  if f, ok := params.Get("format"); ok {
+    spec, err = ParseColumns(f)
+  } else if len(roots) == 1 {
+    spec, err = roots[0].Columns()
+  } else {
+    spec, err = d.NodeTree.Node.Columns()
+  }
+
+  if err != nil {
+    return nil, err
+  }
+
+  opts := []ColumnViewOpt{WithColumnTime(now)}
+  intParam := func(key string) (int, error) {
+    v, ok := params.Get(key)
+    if !ok {
+      return 0, nil
+    }
+
+    i, err := strconv.Atoi(v)
+    if err != nil {
+      return 0, NewInvalidBlockParamError("columnview", key, v)
+    }
+    return i, nil
+  }
+
+  maxLevel, err := intParam("maxlevel")
+  if err != nil {
+    return nil, err
+  }
+
+  hlines, err := intParam("hlines")
+  if err != nil {
+    return nil, err
+  }
+
+  opts = append(opts, WithColumnMaxLevel(maxLevel))
+  if v, ok := params.Get("skip-empty-rows"); ok && v != "nil" {
+    opts = append(opts, WithSkipEmptyRows())
+  }
+
+  return spec.View(roots, opts...).Table(hlines), nil
+}
+
+type InvalidColumnSpecError struct {
+  Spec   string
+  Reason string
+}
+
+func (icse InvalidColumnSpecError) Error() string {
+  return fmt.Sprintf("Invalid column format %q: %s", icse.Spec, icse.Reason)
+}
+
+func NewInvalidColumnSpecError(spec, reason string) *InvalidColumnSpecError {
+  return &InvalidColumnSpecError{Spec: spec, Reason: reason}
+}
@@ -0,0 +1,103 @@
+package org
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseColumns(t *testing.T) {
+  spec := "%25ITEM %TODO %3PRIORITY %Effort(Estimate){:} %Done{X/} %Cost{+;%.1f} %CLOCKSUM"
+  cs, err := ParseColumns(spec)
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  if len(cs.Columns) != 7 || cs.String() != spec {
+    t.Fatalf("ParseColumns() = %d columns, %q", len(cs.Columns), cs.String())
+  }
+
+  effort := cs.Columns[3]
+  if effort.Property != "Effort" || effort.Title != "Estimate" || effort.Summary != SUMMARY_TIME {
+    t.Errorf("Effort column = %+v", effort)
+  }
+
+  if cs.Columns[0].Width != 25 || cs.Columns[5].SummaryFormat != "%.1f" {
+    t.Errorf("ParseColumns() width = %d, format = %q", cs.Columns[0].Width, cs.Columns[5].SummaryFormat)
+  }
+
+  for _, s := range []string{"", "%ITEM garbage", "%Effort{avg}"} {
+    if _, err := ParseColumns(s); err == nil {
+      t.Errorf("ParseColumns(%q) did not fail", s)
+    }
+  }
+}
+
+func TestColumnView(t *testing.T) {
+  d := New()
+  d.BufferSettings.Columns = "%ITEM %Effort{:} %Done{X/} %Est{est+} %Cost{mean}"
+  d.AddHeading(1, "Project")
+  d.AddHeading(2, "Design")
+  d.AddHeading(2, "Build")
+  d.AddHeading(3, "Backend")
+  d.AddHeading(3, "Frontend")
+  d.AddHeading(1, "Other")
+
+  project := d.NodeTree.Subtree[0]
+  design := project.Subtree[0].Node
+  build := project.Subtree[1]
+  design.SetProperty("Effort", "1:30").SetProperty("Done", "[X]").SetProperty("Est", "2-4").SetProperty("Cost", "10")
+  build.Node.SetProperty("Effort", "9:00")
+  build.Subtree[0].Node.SetProperty("Effort", "2:00").SetProperty("Done", "[X]").SetProperty("Est", "1-3").SetProperty("Cost", "20")
+  build.Subtree[1].Node.SetProperty("Effort", "0:45").SetProperty("Done", "[ ]").SetProperty("Cost", "40")
+
+  cs, err := project.Node.Columns()
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  cv := cs.View([]*Node{project.Node})
+  want := [][]string{
+    {"Project", "4:15", "[1/2]", "4-6", "20"},
+    {"Design", "1:30", "[X]", "2-4", "10"},
+    {"Build", "2:45", "[1/2]", "1-3", "30"},
+    {"Backend", "2:00", "[X]", "1-3", "20"},
+    {"Frontend", "0:45", "[ ]", "", "40"},
+  }
+
+  if len(cv.Rows) != len(want) {
+    t.Fatalf("View() = %d rows, want %d", len(cv.Rows), len(want))
+  }
+
+  for i, w := range want {
+    if got := strings.Join(cv.Rows[i].Values, ","); got != strings.Join(w, ",") {
+      t.Errorf("row %d = %s, want %s", i, got, strings.Join(w, ","))
+    }
+  }
+
+  build.Node.SetProperty("COLUMNS", "%ITEM(Task) %Effort")
+  cs, _ = build.Node.Columns()
+  if got := cs.View([]*Node{build.Node}, WithColumnMaxLevel(2)).Table(0); len(got) != 3 || !strings.HasPrefix(got[2], "| ** Build | 9:00") {
+    t.Errorf("Table() with COLUMNS override =\n%s", strings.Join(got, "\n"))
+  }
+
+  block := NewDynamicBlock("columnview", ":id global :format \"%ITEM %Effort{:}\" :skip-empty-rows t :hlines 1")
+  d.NodeTree.Node.Section = &Section{Elements: []Element{block}}
+  if _, err := d.UpdateDynamicBlocks(time.Now()); err != nil {
+    t.Fatal(err)
+  }
+
+  wantBlock := []string{
+    "| ITEM         | Effort |",
+    "|--------------+--------|",
+    "| * Project    |   4:15 |",
+    "| ** Design    |   1:30 |",
+    "| ** Build     |   2:45 |",
+    "| *** Backend  |   2:00 |",
+    "| *** Frontend |   0:45 |",
+  }
+
+  if strings.Join(block.Lines, "\n") != strings.Join(wantBlock, "\n") {
+    t.Errorf("columnview block =\n%s\nwant\n%s", strings.Join(block.Lines, "\n"), strings.Join(wantBlock, "\n"))
+  }
+}
@@ -0,0 +1,181 @@
+package org
+
+import (
+	"fmt"
+	"strings"
+)
+
+// TodoDependencyPolicy mirrors org-enforce-todo-dependencies, controlling
+// what happens when a blocked heading is marked done.
+type TodoDependencyPolicy int
+
+const (
+  // blocking is not checked, which is the org default
+  TODO_DEPENDENCIES_IGNORE TodoDependencyPolicy = iota
+  // the transition is refused with a TodoBlockedError
+  TODO_DEPENDENCIES_REFUSE
+  // the transition is performed, and a TodoBlockedError is added to the
+  // returned TodoChange's warnings
+  TODO_DEPENDENCIES_WARN
+)
+
+type BlockReason string
+
+const (
+  // a descendant of the node is in a non-done todo state
+  BLOCKED_BY_CHILD   BlockReason = "child"
+  // the parent (or an ancestor) is ORDERED and an earlier sibling is in a
+  // non-done todo state
+  BLOCKED_BY_SIBLING BlockReason = "sibling"
+  // a node referenced by the BLOCKER property is in a non-done todo state, or
+  // could not be found
+  BLOCKED_BY_ID      BlockReason = "id"
+)
+
+// Blocker describes a single reason a node may not be marked done.
+type Blocker struct {
+  Reason  BlockReason
+  // The node blocking the transition. Nil when a BLOCKER id could not be
+  // resolved within the document.
+  Node    *Node
+  // The referenced id, for BLOCKED_BY_ID blockers.
+  ID      string
+}
+
+// Blockers returns every reason the node may not currently be marked done:
+//   - any descendant heading holding a non-done todo keyword
+//   - when the parent has the ORDERED property set, any earlier sibling
+//     holding a non-done todo keyword. This is checked for each ancestor in
+//     turn, so the children of a blocked task are blocked as well.
+//   - any node whose ID is listed in the BLOCKER property, written either as
+//     a whitespace separated list or as `ids(id1 id2)`, which is not done.
+//     Ids which can not be found in the document also block.
+//
+// Nodes without a todo keyword never block.
+func (n *Node) Blockers() []*Blocker {
+  out := make([]*Blocker, 0)
+
+  if n.Tree != nil {
+    for _, st := range n.Tree.Subtree {
+      for desc := range st.Nodes() {
+        if desc.isUndone() {
+          out = append(out, &Blocker{Reason: BLOCKED_BY_CHILD, Node: desc})
+        }
+      }
+    }
+  }
+
+  for cur := n; cur != nil && cur.Tree != nil && cur.Tree.Parent != nil; cur = cur.Parent() {
+    parent := cur.Tree.Parent
+    if v, ok := parent.Node.ownProperty("ORDERED"); !ok || v == "" || v == "nil" {
+      continue
+    }
+
+    for _, sib := range parent.Subtree {
+      if sib == cur.Tree {
+        break
+      }
+
+      if sib.Node.isUndone() {
+        out = append(out, &Blocker{Reason: BLOCKED_BY_SIBLING, Node: sib.Node})
+      }
+    }
+  }
+
+  v, _ := n.ownProperty("BLOCKER")
+  for _, id := range parseBlockerIDs(v) {
+    var target *Node
+    if n.Document != nil {
+      target = n.Document.FindByID(id)
+    }
+
+    if target == nil || target.isUndone() {
+      out = append(out, &Blocker{Reason: BLOCKED_BY_ID, Node: target, ID: id})
+    }
+  }
+
+  return out
+}
+
+// Returns true if the node may not currently be marked done, see Blockers.
+func (n *Node) IsBlocked() bool {
+  return len(n.Blockers()) > 0
+}
+
+// FindByID returns the first node in the document whose ID property equals
+// id, or nil.
+func (d *Document) FindByID(id string) *Node {
+  for n := range d.Nodes() {
+    if v, ok := n.ownProperty("ID"); ok && v == id {
+      return n
+    }
+  }
+
+  return nil
+}
+
+func parseBlockerIDs(v string) []string {
+  v = strings.TrimSpace(v)
+  if strings.HasPrefix(v, "ids(") && strings.HasSuffix(v, ")") {
+    v = v[4:len(v)-1]
+  }
+
+  return strings.Fields(v)
+}
+
+// Returns true if the node's heading holds a todo keyword which is not a done
+// keyword.
+func (n *Node) isUndone() bool {
+  if n.Heading == nil || n.Heading.TodoKeyword == "" {
+    return false
+  }
+
+  ts := n.Heading.todoSettings()
+  if ts == nil {
+    return false
+  }
+
+  return ts.GetKeywordKind(n.Heading.TodoKeyword) != TODO_KEYWORD_KIND_DONE
+}
+
+// Returns the value of a property set on the node itself, ignoring any
+// inheritance policy.
+func (n *Node) ownProperty(key string) (string, bool) {
+  v, ok, _ := accumulateProperty(key, n.Properties)
+  return v, ok
+}
+
+type TodoBlockedError struct {
+  Node      *Node
+  Keyword   string
+  Blockers  []*Blocker
+}
+
+func (tbe TodoBlockedError) Error() string {
+  reasons := make([]string, 0, len(tbe.Blockers))
+  for _, b := range tbe.Blockers {
+    switch {
+    case b.Node == nil:
+      reasons = append(reasons, fmt.Sprintf("%s %s not found", b.Reason, b.ID))
+    case b.Node.Heading != nil:
+      reasons = append(reasons, fmt.Sprintf("%s %q", b.Reason, b.Node.Heading.Text))
+    default:
+      reasons = append(reasons, string(b.Reason))
+    }
+  }
+
+  title := ""
+  if tbe.Node != nil && tbe.Node.Heading != nil {
+    title = tbe.Node.Heading.Text
+  }
+
+  return fmt.Sprintf("Unable to set %q to %s, blocked by: %s",
+    title,
+    tbe.Keyword,
+    strings.Join(reasons, ", "),
+    )
+}
+
+func NewTodoBlockedError(n *Node, k string, b []*Blocker) *TodoBlockedError {
+  return &TodoBlockedError{Node: n, Keyword: k, Blockers: b}
+}
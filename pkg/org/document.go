@@ -1,5 +1,9 @@
 package org
 
+import (
+	"iter"
+	"strings"
+)
 
 type Document struct {
   NodeTree *MetaNodeTree
@@ -31,6 +35,7 @@ func New() *Document {
     Virtual: false,
     Path: "",
   }
+  d.NodeTree.Node.Document = d
 
   bufSettings := &BufferSettings{}
   todoSettings := &TodoSettings{}
@@ -49,6 +54,7 @@ func New() *Document {
 
   bufSettings.Priorities = prioritySettings
   bufSettings.TodoSettings = todoSettings
+  bufSettings.Startup = NewStartupSettings()
   d.BufferSettings = bufSettings
 
   return d
@@ -111,6 +117,7 @@ func (d *Document) AddHeading(lvl int, text string, opts... HeadingOpt) (*Docume
     Heading: h,
     Document: d,
   }
+  h.Node = n
 
   if lvl == 1 {
     d.NodeTree.AddNode(n)
@@ -132,6 +139,65 @@ func (d *Document) AddHeading(lvl int, text string, opts... HeadingOpt) (*Docume
   return d, nil
 }
 
+// Nodes returns an iterator over every node in the document in document order,
+// starting with the zero-th node holding any content before the first heading.
+func (d *Document) Nodes() iter.Seq[*Node] {
+  return d.NodeTree.Nodes()
+}
+
+// ValidateProperties checks every property set on a node within the document,
+// and every document level `#+PROPERTY`, against the "_All" restriction in
+// effect for it, whether defined on the node itself, inherited from a parent,
+// or set at the document level. All violations are returned, each carrying
+// the offending node and its outline path; the zero-th node for document
+// level properties. Properties set with the "+" accumulation syntax append
+// whitespace separated values, and have each of them checked individually.
+func (d *Document) ValidateProperties() []*InvalidPropertyValueError {
+  out := make([]*InvalidPropertyValueError, 0)
+
+  for n := range d.Nodes() {
+    out = append(out, validateProperties(n, n.Properties)...)
+  }
+
+  if d.BufferSettings != nil {
+    out = append(out, validateProperties(d.NodeTree.Node, derefProperties(d.BufferSettings.Properties))...)
+  }
+
+  return out
+}
+
+// Validates props against the restrictions in effect for n.
+func validateProperties(n *Node, props []Property) []*InvalidPropertyValueError {
+  out := make([]*InvalidPropertyValueError, 0)
+  for _, p := range props {
+    if p.IsValueRestriction() {
+      continue
+    }
+
+    key := strings.TrimSuffix(p.Key, "+")
+    restriction, ok := n.PropertyRestriction(key)
+    if !ok {
+      continue
+    }
+
+    values := []string{p.Value}
+    if key != p.Key {
+      values = strings.Fields(p.Value)
+    }
+
+    for _, v := range values {
+      err := restriction.Validate(&Property{Key: key, Value: v})
+      if ipve, ok := err.(*InvalidPropertyValueError); ok {
+        ipve.Node = n
+        ipve.OutlinePath = n.OutlinePath()
+        out = append(out, ipve)
+      }
+    }
+  }
+
+  return out
+}
+
 type NilMetaNodeError struct {}
 func (NilMetaNodeError) Error() string {
   return "Unable to insert nil meta node into document node tree"
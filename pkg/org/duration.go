@@ -0,0 +1,281 @@
+package org
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DurationUnits mirrors org-duration-units: the number of minutes in each
+// unit accepted by ParseDuration. As in org, a month is 30 days and a year
+// 365.25 days.
+var DurationUnits = map[string]float64{
+  "min": 1,
+  "h":   60,
+  "d":   60*24,
+  "w":   60*24*7,
+  "m":   60*24*30,
+  "y":   60*24*365.25,
+}
+
+var (
+  durationHMMRegexp   = regexp.MustCompile(`^(\d+):(\d{2})$`)
+  durationHMMSSRegexp = regexp.MustCompile(`^(\d+):(\d{2}):(\d{2})$`)
+  durationUnitRegexp  = regexp.MustCompile(`^(\d+(?:\.\d*)?)\s*(min|h|d|w|m|y)`)
+  durationNumRegexp   = regexp.MustCompile(`^\d+(?:\.\d*)?$`)
+)
+
+// ParseDuration parses a duration as org-duration-to-minutes does. Accepted
+// forms are "H:MM" (E.G., 1:30), "H:MM:SS", unit durations such as "2d",
+// "1h 30min" or "1.5h", unit durations followed by "H:MM" (E.G., "1d 2:30"),
+// and bare numbers, which count minutes.
+func ParseDuration(s string) (time.Duration, error) {
+  s = strings.TrimSpace(s)
+
+  if durationNumRegexp.MatchString(s) {
+    f, _ := strconv.ParseFloat(s, 64)
+    return minutesToDuration(f), nil
+  }
+
+  if hms, ok := parseClockDuration(s); ok {
+    return hms, nil
+  }
+
+  var total time.Duration
+  rest := s
+  for rest != "" {
+    m := durationUnitRegexp.FindStringSubmatch(rest)
+    if m == nil {
+      // a trailing H:MM may follow unit durations, E.G., "1d 2:30"
+      if hms, ok := parseClockDuration(rest); ok && rest != s {
+        return total + hms, nil
+      }
+
+      return 0, NewInvalidDurationError(s)
+    }
+
+    f, _ := strconv.ParseFloat(m[1], 64)
+    total += minutesToDuration(f * DurationUnits[m[2]])
+    rest = strings.TrimSpace(rest[len(m[0]):])
+  }
+
+  if s == "" {
+    return 0, NewInvalidDurationError(s)
+  }
+
+  return total, nil
+}
+
+func parseClockDuration(s string) (time.Duration, bool) {
+  if m := durationHMMRegexp.FindStringSubmatch(s); m != nil {
+    h, _ := strconv.Atoi(m[1])
+    min, _ := strconv.Atoi(m[2])
+    return time.Duration(h)*time.Hour + time.Duration(min)*time.Minute, true
+  }
+
+  if m := durationHMMSSRegexp.FindStringSubmatch(s); m != nil {
+    h, _ := strconv.Atoi(m[1])
+    min, _ := strconv.Atoi(m[2])
+    sec, _ := strconv.Atoi(m[3])
+    return time.Duration(h)*time.Hour + time.Duration(min)*time.Minute + time.Duration(sec)*time.Second, true
+  }
+
+  return 0, false
+}
+
+func minutesToDuration(m float64) time.Duration {
+  return time.Duration(math.Round(m * float64(time.Minute)))
+}
+
+// DurationFormat selects how FormatDuration writes a duration.
+type DurationFormat string
+
+const (
+  // hours and minutes, E.G., "26:30"
+  DURATION_FORMAT_HMM     DurationFormat = "h:mm"
+  // org's default format: whole days followed by hours and minutes, E.G.,
+  // "1d 2:30", or "2:30" below a day
+  DURATION_FORMAT_DEFAULT DurationFormat = "default"
+  // each non-zero unit from days down to minutes, E.G., "1d 2h 30min"
+  DURATION_FORMAT_UNITS   DurationFormat = "units"
+)
+
+// FormatDuration writes a duration in the given format, truncated to whole
+// minutes.
+func FormatDuration(d time.Duration, f DurationFormat) string {
+  mins := int(d / time.Minute)
+  sign := ""
+  if mins < 0 {
+    sign = "-"
+    mins = -mins
+  }
+
+  switch f {
+  case DURATION_FORMAT_HMM:
+    return fmt.Sprintf("%s%d:%02d", sign, mins/60, mins%60)
+  case DURATION_FORMAT_UNITS:
+    out := make([]string, 0)
+    for _, u := range []string{"d", "h", "min"} {
+      per := int(DurationUnits[u])
+      if mins >= per {
+        out = append(out, fmt.Sprintf("%d%s", mins/per, u))
+        mins %= per
+      }
+    }
+
+    if len(out) == 0 {
+      return "0min"
+    }
+    return sign + strings.Join(out, " ")
+  }
+
+  days := mins / (24*60)
+  mins -= days*24*60
+  out := fmt.Sprintf("%d:%02d", mins/60, mins%60)
+  if days > 0 {
+    out = fmt.Sprintf("%dd %s", days, out)
+  }
+
+  return sign + out
+}
+
+// EFFORT_PROPERTY mirrors org-effort-property.
+const EFFORT_PROPERTY = "Effort"
+
+// Effort returns the node's own effort estimate and whether it defines one.
+// An error is returned if the Effort property can not be parsed.
+func (n *Node) Effort() (time.Duration, bool, error) {
+  v, ok := n.Property(EFFORT_PROPERTY)
+  if !ok || strings.TrimSpace(v) == "" {
+    return 0, false, nil
+  }
+
+  d, err := ParseDuration(v)
+  if err != nil {
+    return 0, true, err
+  }
+
+  return d, true, nil
+}
+
+// SetEffort sets the node's Effort property, written as H:MM as org does.
+func (n *Node) SetEffort(d time.Duration) *Node {
+  return n.SetProperty(EFFORT_PROPERTY, FormatDuration(d, DURATION_FORMAT_HMM))
+}
+
+// SubtreeEffort returns the effort estimate of the node's subtree, as the
+// {:} summary of a column view computes it: the sum of its children's subtree
+// efforts when any of them holds an estimate, or the node's own estimate
+// otherwise. Returns false if nothing in the subtree holds an estimate.
+func (n *Node) SubtreeEffort() (time.Duration, bool, error) {
+  var total time.Duration
+  found := false
+
+  if n.Tree != nil {
+    for _, st := range n.Tree.Subtree {
+      d, ok, err := st.Node.SubtreeEffort()
+      if err != nil {
+        return 0, false, err
+      }
+
+      if ok {
+        total += d
+        found = true
+      }
+    }
+  }
+
+  if found {
+    return total, true, nil
+  }
+
+  return n.Effort()
+}
+
+// EffortStatus compares the estimated effort of a subtree with the time
+// clocked on it.
+type EffortStatus struct {
+  Node    *Node
+  Effort  time.Duration
+  Clocked time.Duration
+}
+
+// Returns the estimated time left, negative when the estimate was exceeded.
+func (es *EffortStatus) Remaining() time.Duration {
+  return es.Effort - es.Clocked
+}
+
+// Returns true if more time was clocked than estimated.
+func (es *EffortStatus) Exceeded() bool {
+  return es.Clocked > es.Effort
+}
+
+// Returns the fraction of the estimate used so far, E.G., 1.5 when half as
+// much time again as estimated was clocked. Zero estimates return +Inf once
+// any time was clocked.
+func (es *EffortStatus) Ratio() float64 {
+  if es.Effort == 0 {
+    if es.Clocked == 0 {
+      return 0
+    }
+    return math.Inf(1)
+  }
+
+  return float64(es.Clocked) / float64(es.Effort)
+}
+
+// EffortStatus compares the node's subtree effort with the time clocked on
+// its subtree. Returns false if the subtree holds no estimate.
+func (n *Node) EffortStatus() (*EffortStatus, bool, error) {
+  effort, ok, err := n.SubtreeEffort()
+  if !ok || err != nil {
+    return nil, ok, err
+  }
+
+  return &EffortStatus{
+    Node: n,
+    Effort: effort,
+    Clocked: NewClockReport([]*Node{n}).Total,
+  }, true, nil
+}
+
+// OverEffort returns the status of every heading with its own effort
+// estimate whose subtree was clocked for longer than that estimate. Unlike
+// EffortStatus, the heading's own estimate is used rather than the rollup of
+// its children's, so a parent estimated at 8h is only over once 8h were
+// clocked on it and its children.
+func (d *Document) OverEffort() ([]*EffortStatus, error) {
+  out := make([]*EffortStatus, 0)
+  for n := range d.Nodes() {
+    effort, ok, err := n.Effort()
+    if err != nil {
+      return nil, err
+    }
+
+    if !ok {
+      continue
+    }
+
+    es := &EffortStatus{Node: n, Effort: effort, Clocked: NewClockReport([]*Node{n}).Total}
+    if es.Exceeded() {
+      out = append(out, es)
+    }
+  }
+
+  return out, nil
+}
+
+type InvalidDurationError struct {
+  Duration string
+}
+
+func (ide InvalidDurationError) Error() string {
+  return fmt.Sprintf("Invalid duration %q", ide.Duration)
+}
+
+func NewInvalidDurationError(d string) *InvalidDurationError {
+  return &InvalidDurationError{Duration: d}
+}
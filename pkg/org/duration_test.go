@@ -0,0 +1,92 @@
+package org
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseDuration(t *testing.T) {
+  tests := []struct {
+    in   string
+    want time.Duration
+  }{
+    {"1:30", 90*time.Minute},
+    {"0:45:30", 45*time.Minute + 30*time.Second},
+    {"2d", 48*time.Hour},
+    {"1h 30min", 90*time.Minute},
+    {"1.5h", 90*time.Minute},
+    {"1w 2d", 9*24*time.Hour},
+    {"1d 2:30", 26*time.Hour + 30*time.Minute},
+    {"45", 45*time.Minute},
+    {"1m", 30*24*time.Hour},
+  }
+
+  for _, tt := range tests {
+    got, err := ParseDuration(tt.in)
+    if err != nil || got != tt.want {
+      t.Errorf("ParseDuration(%q) = %v, %v, want %v", tt.in, got, err, tt.want)
+    }
+  }
+
+  for _, s := range []string{"", "soon", "1:3", "2 days", "1:30 2h"} {
+    if _, err := ParseDuration(s); err == nil {
+      t.Errorf("ParseDuration(%q) did not fail", s)
+    }
+  }
+
+  d := 26*time.Hour + 5*time.Minute
+  for f, want := range map[DurationFormat]string{
+    DURATION_FORMAT_HMM: "26:05",
+    DURATION_FORMAT_DEFAULT: "1d 2:05",
+    DURATION_FORMAT_UNITS: "1d 2h 5min",
+  } {
+    if got := FormatDuration(d, f); got != want {
+      t.Errorf("FormatDuration(%v, %s) = %q, want %q", d, f, got, want)
+    }
+  }
+}
+
+func TestEffort(t *testing.T) {
+  d := testingClockDocument(t)
+  project := d.NodeTree.Subtree[0]
+  task := project.Subtree[0]
+  personal := d.NodeTree.Subtree[1].Node
+
+  project.Node.SetProperty("Effort", "8h")
+  task.Node.SetEffort(3*time.Hour)
+  task.Subtree[0].Node.SetProperty("Effort", "1h 30min")
+  personal.SetProperty("Effort", "1:00")
+
+  if got, ok, err := task.Node.Effort(); !ok || err != nil || got != 3*time.Hour {
+    t.Errorf("Effort() = %v, %v, %v", got, ok, err)
+  }
+
+  if v, _ := task.Node.Property("Effort"); v != "3:00" {
+    t.Errorf("SetEffort() wrote %q", v)
+  }
+
+  if got, _, _ := project.Node.SubtreeEffort(); got != 90*time.Minute {
+    t.Errorf("SubtreeEffort() = %v, want 1h30m", got)
+  }
+
+  over, err := d.OverEffort()
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  // Project stays within its own 8:00 estimate despite 5:30 clocked, while
+  // Task A's 3:00 is exceeded by 3:30 and Deep's 1:30 by 2:00. Personal stays
+  // within its hour
+  if len(over) != 2 || over[0].Node != task.Node || over[0].Remaining() != -30*time.Minute {
+    t.Errorf("OverEffort() = %d statuses", len(over))
+  }
+
+  if len(over) == 2 && (over[1].Node != task.Subtree[0].Node || over[1].Remaining() != -30*time.Minute) {
+    t.Errorf("OverEffort()[1] = %v", over[1])
+  }
+
+  personal.SetProperty("Effort", "a while")
+  if _, err := d.OverEffort(); err == nil {
+    t.Error("OverEffort() with an invalid estimate did not fail")
+  }
+}
@@ -16,7 +16,7 @@ const (
   ELEMENT_HEADING
   ELEMENT_GREATER_BLOCK
   ELEMENT_DRAWER
-  ELEMENT_DYNAMIC_BLOCK //TODO
+  ELEMENT_DYNAMIC_BLOCK
   ELEMENT_FOOTNOTE_DEF
   ELEMENT_INLINE_TASK //TODO
   ELEMENT_ITEM
@@ -35,7 +35,7 @@ const (
   ELEMENT_NODE_PROPERTY
   ELEMENT_PARAGRAPH
   ELEMENT_TABLE_ROW
-  ELEMENT_DIARY_SEXP //TODO
+  ELEMENT_DIARY_SEXP
 )
 
 // Legible strings for error and debug output purposes
@@ -62,6 +62,7 @@ func (ek ElementKind) String() string {
     ELEMENT_NODE_PROPERTY: "Node Property",
     ELEMENT_PARAGRAPH: "Paragraph",
     ELEMENT_TABLE_ROW: "Table Row",
+    ELEMENT_DIARY_SEXP: "Diary Sexp",
   }
 
   o, ok := elemStringMap[ek]
@@ -0,0 +1,167 @@
+package org
+
+import (
+	"fmt"
+	"strings"
+)
+
+// LogEntry is a single item recorded by org in a heading's log, most commonly
+// within a LOGBOOK drawer, E.G.:
+//
+//     - State "DONE"       from "TODO"       [2050-01-01 Sat 10:00]
+//     - CLOSING NOTE [2050-01-01 Sat 10:00] \\
+//       finished early
+//
+// Org writes these as plain list items, newest first.
+type LogEntry struct {
+  EntryKind LogEntryKind
+  // The state entered, for LOG_ENTRY_STATE entries.
+  State     string
+  // The state left, for LOG_ENTRY_STATE entries. May be empty when a
+  // keyword was set on a heading which previously had none.
+  From      string
+  Time      *Timestamp
+  // Lines of free text attached to the entry.
+  Note      []string
+}
+
+func (le LogEntry) Kind() ElementKind {
+  return ELEMENT_ITEM
+}
+
+func (le LogEntry) IsGreaterElement() bool {
+  return true
+}
+
+func (le *LogEntry) String() string {
+  return strings.Join(le.Strings(), "\n")
+}
+
+// Returns the lines of the entry as org writes them, with any note indented
+// beneath the entry's heading line.
+func (le *LogEntry) Strings() []string {
+  ts := ""
+  if le.Time != nil {
+    ts = le.Time.String()
+  }
+
+  var head string
+  switch le.EntryKind {
+  case LOG_ENTRY_STATE:
+    head = fmt.Sprintf("- State %-12s from %-12s %s",
+      fmt.Sprintf("%q", le.State),
+      fmt.Sprintf("%q", le.From),
+      ts,
+      )
+  case LOG_ENTRY_CLOSING_NOTE:
+    head = fmt.Sprintf("- CLOSING NOTE %s", ts)
+  default:
+    head = fmt.Sprintf("- Note taken on %s", ts)
+  }
+
+  if len(le.Note) == 0 {
+    return []string{head}
+  }
+
+  out := []string{head + ` \\`}
+  for _, l := range le.Note {
+    out = append(out, "  "+l)
+  }
+
+  return out
+}
+
+type LogEntryKind string
+
+const (
+  LOG_ENTRY_NOTE         LogEntryKind = "note"
+  LOG_ENTRY_STATE        LogEntryKind = "state"
+  LOG_ENTRY_CLOSING_NOTE LogEntryKind = "done"
+)
+
+// Returns the drawer with the given name in the node's section, creating it
+// at the start of the section if it does not exist and create is true. Drawer
+// names are compared case-insensitively.
+func (n *Node) Drawer(name string, create bool) *Drawer {
+  if n.Section != nil {
+    for _, e := range n.Section.Elements {
+      if d, ok := e.(*Drawer); ok && strings.EqualFold(d.Name, name) {
+        return d
+      }
+    }
+  }
+
+  if !create {
+    return nil
+  }
+
+  if n.Section == nil {
+    n.Section = &Section{Heading: n.Heading}
+  }
+
+  d := &Drawer{Name: name}
+  n.Section.Elements = append([]Element{d}, n.Section.Elements...)
+
+  return d
+}
+
+// Logbook returns the node's LOGBOOK drawer, creating it if create is true.
+func (n *Node) Logbook(create bool) *Drawer {
+  return n.Drawer("LOGBOOK", create)
+}
+
+// Returns the name of the drawer log entries are written to, as set by the
+// inherited LOG_INTO_DRAWER property. Defaults to LOGBOOK. Returns false if
+// the property is "nil", meaning entries are written directly into the
+// section.
+func (n *Node) LogDrawerName() (string, bool) {
+  v, ok := n.InheritedProperty("LOG_INTO_DRAWER")
+  switch {
+  case !ok, v == "", v == "t":
+    return "LOGBOOK", true
+  case v == "nil":
+    return "", false
+  }
+
+  return v, true
+}
+
+// Returns every log entry held by the node's log drawer, or its section when
+// not logging into a drawer, newest first.
+func (n *Node) LogEntries() []*LogEntry {
+  out := make([]*LogEntry, 0)
+
+  var elements []Element
+  if name, ok := n.LogDrawerName(); ok {
+    if d := n.Drawer(name, false); d != nil {
+      elements = d.Elements
+    }
+  } else if n.Section != nil {
+    elements = n.Section.Elements
+  }
+
+  for _, e := range elements {
+    if le, ok := e.(*LogEntry); ok {
+      out = append(out, le)
+    }
+  }
+
+  return out
+}
+
+// Adds a log entry to the top of the node's log drawer, matching org's
+// default of recording the newest entries first.
+func (n *Node) addLogEntry(le *LogEntry) {
+  name, ok := n.LogDrawerName()
+  if ok {
+    d := n.Drawer(name, true)
+    d.Elements = append([]Element{le}, d.Elements...)
+    return
+  }
+
+  if n.Section == nil {
+    n.Section = &Section{Heading: n.Heading}
+  }
+
+  n.Section.Elements = append([]Element{le}, n.Section.Elements...)
+}
@@ -0,0 +1,629 @@
+package org
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Match is a parsed org match string as used by tag searches and agenda views,
+// E.G., `+work-boss|home+@laptop`. A match holds one or more alternatives
+// separated by "|", where an alternative matches when all of its terms do.
+// Group tags defined in the document's TagRegistry match any of their
+// members.
+//
+// Terms may also compare properties, E.G., `+work+PRIORITY="A"+LEVEL>1`, and
+// the match may end with a todo keyword condition following a slash, E.G.,
+// `work/WAIT|NEXT`, `work/-DONE`, or `work/!` to only match headings in a
+// non-done todo state.
+type Match struct {
+  Raw           string
+  Alternatives  [][]*MatchTerm
+  // Todo holds the condition following the slash, or nil if none was given.
+  Todo          *TodoMatch
+}
+
+// MatchTerm is a single condition within a match alternative.
+type MatchTerm struct {
+  // When true, the term matches headings which do NOT satisfy it.
+  Negate  bool
+  // The tag queried by the term. Empty when Pattern or Property is set.
+  Tag     string
+  // Set when the term was given as a regular expression in braces, E.G.,
+  // `+{^proj}`, matching any tag the expression matches. For property terms,
+  // set when the compared value was given in braces.
+  Pattern *regexp.Regexp
+  // The property compared by the term, E.G., "Effort" in `Effort<2`. The
+  // special properties TODO, LEVEL, PRIORITY, CATEGORY, ITEM, TAGS,
+  // SCHEDULED, DEADLINE, CLOSED, TIMESTAMP and TIMESTAMP_IA refer to the
+  // heading rather than its property drawer.
+  Property string
+  Op       MatchOp
+  // The value compared against. Values given in quotes are compared as
+  // strings, unquoted values as numbers, and values in angle brackets, quoted
+  // or not, such as "<2050-01-01>", as dates. Dates may also be given
+  // relative to the current time as <now>, <today>, <tomorrow>, <yesterday>,
+  // or an offset such as <+1w> or <-3d>. Value holds dates without their
+  // brackets.
+  Value    string
+  numeric  bool
+  date     bool
+}
+
+// Returns the current time when resolving relative dates in matches.
+var matchNow = time.Now
+
+// TodoMatch is the todo keyword condition of a match, following the slash.
+type TodoMatch struct {
+  // Only headings holding one of these keywords match, when non-empty.
+  Keywords  []string
+  // Headings holding one of these keywords never match.
+  Exclude   []string
+  // When true, only headings in a non-done todo state match.
+  UndoneOnly bool
+}
+
+type MatchOp string
+
+const (
+  MATCH_OP_EQ MatchOp = "="
+  MATCH_OP_NE MatchOp = "<>"
+  MATCH_OP_LT MatchOp = "<"
+  MATCH_OP_LE MatchOp = "<="
+  MATCH_OP_GT MatchOp = ">"
+  MATCH_OP_GE MatchOp = ">="
+)
+
+// ParseMatch parses an org match string. An empty string produces a match
+// which is satisfied by every heading.
+func ParseMatch(s string) (*Match, error) {
+  m := &Match{Raw: s, Alternatives: make([][]*MatchTerm, 0)}
+
+  query, todo, hasTodo := cutMatchTodo(s)
+  if hasTodo {
+    m.Todo = parseTodoMatch(todo)
+  }
+
+  col := 0
+  for _, alt := range splitMatchAlternatives(query) {
+    terms, err := parseMatchAlternative(alt, col)
+    if err != nil {
+      err.Match = s
+      return nil, err
+    }
+
+    if len(terms) > 0 {
+      m.Alternatives = append(m.Alternatives, terms)
+    }
+
+    col += len(alt) + 1
+  }
+
+  return m, nil
+}
+
+// Splits the todo condition from the match at the first slash occurring
+// outside of braces or quotes.
+func cutMatchTodo(s string) (string, string, bool) {
+  depth := 0
+  quoted := false
+  for i, c := range s {
+    switch {
+    case c == '"':
+      quoted = !quoted
+    case quoted:
+    case c == '{':
+      depth++
+    case c == '}':
+      depth--
+    case c == '/' && depth == 0:
+      return s[:i], s[i+1:], true
+    }
+  }
+
+  return s, "", false
+}
+
+func parseTodoMatch(s string) *TodoMatch {
+  tm := &TodoMatch{}
+  if strings.HasPrefix(s, "!") {
+    tm.UndoneOnly = true
+    s = s[1:]
+  }
+
+  for _, kw := range strings.FieldsFunc(s, func(r rune) bool { return r == '|' || r == ' ' }) {
+    switch {
+    case strings.HasPrefix(kw, "-"):
+      tm.Exclude = append(tm.Exclude, kw[1:])
+    default:
+      tm.Keywords = append(tm.Keywords, strings.TrimPrefix(kw, "+"))
+    }
+  }
+
+  return tm
+}
+
+func splitMatchAlternatives(s string) []string {
+  out := make([]string, 0)
+  depth := 0
+  quoted := false
+  last := 0
+  for i, c := range s {
+    switch {
+    case c == '"':
+      quoted = !quoted
+    case quoted:
+    case c == '{':
+      depth++
+    case c == '}':
+      depth--
+    case c == '|' && depth == 0:
+      out = append(out, s[last:i])
+      last = i+1
+    }
+  }
+
+  return append(out, s[last:])
+}
+
+func parseMatchAlternative(alt string, offset int) ([]*MatchTerm, *InvalidMatchError) {
+  terms := make([]*MatchTerm, 0)
+
+  for i := 0; i < len(alt); {
+    if alt[i] == ' ' {
+      i++
+      continue
+    }
+
+    term := &MatchTerm{}
+    switch alt[i] {
+    case '-':
+      term.Negate = true
+      i++
+    case '+', '&':
+      i++
+    }
+
+    if i >= len(alt) {
+      return nil, NewInvalidMatchError(offset+i, "expected a tag")
+    }
+
+    if alt[i] == '{' {
+      re, n, err := parseMatchPattern(alt[i:], offset+i)
+      if err != nil {
+        return nil, err
+      }
+
+      term.Pattern = re
+      terms = append(terms, term)
+      i += n
+      continue
+    }
+
+    start := i
+    for i < len(alt) && isTagChar(alt[i]) {
+      i++
+    }
+
+    if start == i {
+      return nil, NewInvalidMatchError(offset+i, fmt.Sprintf("unexpected character %q", alt[i]))
+    }
+
+    if i < len(alt) && strings.IndexByte("=<>!", alt[i]) > -1 {
+      term.Property = alt[start:i]
+      n, err := parseMatchComparison(term, alt[i:], offset+i)
+      if err != nil {
+        return nil, err
+      }
+
+      terms = append(terms, term)
+      i += n
+      continue
+    }
+
+    term.Tag = alt[start:i]
+    terms = append(terms, term)
+  }
+
+  return terms, nil
+}
+
+// Parses a braced regular expression at the start of s, returning it along
+// with the number of bytes consumed.
+func parseMatchPattern(s string, col int) (*regexp.Regexp, int, *InvalidMatchError) {
+  end := strings.IndexByte(s, '}')
+  if end < 0 {
+    return nil, 0, NewInvalidMatchError(col, "unterminated regular expression")
+  }
+
+  re, err := regexp.Compile(s[1:end])
+  if err != nil {
+    return nil, 0, NewInvalidMatchError(col, err.Error())
+  }
+
+  return re, end+1, nil
+}
+
+// Parses the operator and value of a property comparison at the start of s,
+// returning the number of bytes consumed.
+func parseMatchComparison(term *MatchTerm, s string, col int) (int, *InvalidMatchError) {
+  i := 0
+  for _, op := range []string{"<>", "!=", "<=", ">=", "=", "<", ">"} {
+    if strings.HasPrefix(s, op) {
+      term.Op = MatchOp(op)
+      if op == "!=" {
+        term.Op = MATCH_OP_NE
+      }
+
+      i = len(op)
+      break
+    }
+  }
+
+  if i == 0 || i >= len(s) {
+    return 0, NewInvalidMatchError(col, "malformed property comparison")
+  }
+
+  switch s[i] {
+  case '{':
+    if term.Op != MATCH_OP_EQ && term.Op != MATCH_OP_NE {
+      return 0, NewInvalidMatchError(col+i, "regular expressions only support = and <>")
+    }
+
+    re, n, err := parseMatchPattern(s[i:], col+i)
+    if err != nil {
+      return 0, err
+    }
+
+    term.Pattern = re
+    return i+n, nil
+  case '"':
+    end := strings.IndexByte(s[i+1:], '"')
+    if end < 0 {
+      return 0, NewInvalidMatchError(col+i, "unterminated string")
+    }
+
+    term.Value = s[i+1:i+1+end]
+    if len(term.Value) > 2 && term.Value[0] == '<' && term.Value[len(term.Value)-1] == '>' {
+      term.Value = term.Value[1:len(term.Value)-1]
+      term.date = true
+    }
+
+    if term.date {
+      if _, ok := matchDate(term.Value); !ok {
+        return 0, NewInvalidMatchError(col+i, "invalid date")
+      }
+    }
+
+    return i+end+2, nil
+  case '<':
+    end := strings.IndexByte(s[i:], '>')
+    if end < 0 {
+      return 0, NewInvalidMatchError(col+i, "unterminated date")
+    }
+
+    term.Value = s[i+1:i+end]
+    term.date = true
+    if _, ok := matchDate(term.Value); !ok {
+      return 0, NewInvalidMatchError(col+i, "invalid date")
+    }
+
+    return i+end+1, nil
+  }
+
+  start := i
+  for i < len(s) && strings.IndexByte("+-.0123456789", s[i]) > -1 {
+    if i > start && (s[i] == '+' || s[i] == '-') {
+      break
+    }
+    i++
+  }
+
+  if _, err := strconv.ParseFloat(s[start:i], 64); err != nil {
+    return 0, NewInvalidMatchError(col+start, "expected a number, string, or date")
+  }
+
+  term.Value = s[start:i]
+  term.numeric = true
+  return i, nil
+}
+
+func isTagChar(c byte) bool {
+  switch {
+  case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+    return true
+  }
+
+  return strings.IndexByte("_@#%", c) > -1
+}
+
+// MatchTags returns true if the given tags satisfy the match, expanding group
+// tags with reg. reg may be nil, in which case tags are compared literally.
+// Property comparisons and the todo condition require a node and are not
+// considered, see Node.Matches.
+func (m *Match) MatchTags(tags []string, reg *TagRegistry) bool {
+  return m.match(nil, tags, reg)
+}
+
+func (m *Match) match(n *Node, tags []string, reg *TagRegistry) bool {
+  if len(m.Alternatives) == 0 {
+    return true
+  }
+
+  for _, alt := range m.Alternatives {
+    ok := true
+    for _, term := range alt {
+      if term.Property != "" && n == nil {
+        continue
+      }
+
+      if term.matches(n, tags, reg) == term.Negate {
+        ok = false
+        break
+      }
+    }
+
+    if ok {
+      return true
+    }
+  }
+
+  return false
+}
+
+func (mt *MatchTerm) matches(n *Node, tags []string, reg *TagRegistry) bool {
+  if mt.Property != "" {
+    return mt.compare(matchPropertyValue(n, mt.Property))
+  }
+
+  for _, tag := range tags {
+    if mt.Pattern != nil && mt.Pattern.MatchString(tag) {
+      return true
+    }
+
+    if mt.Pattern == nil && reg.Matches(mt.Tag, tag) {
+      return true
+    }
+  }
+
+  return false
+}
+
+func (mt *MatchTerm) compare(v string) bool {
+  if mt.Pattern != nil {
+    return mt.Pattern.MatchString(v) == (mt.Op == MATCH_OP_EQ)
+  }
+
+  c := 0
+  if mt.date {
+    // values which do not hold a date, such as an unset DEADLINE, never match
+    left, ok := storedMatchDate(v)
+    right, _ := matchDate(mt.Value)
+    if !ok {
+      return false
+    }
+
+    c = left.Compare(right)
+  } else if mt.numeric {
+    // as with org's string-to-number, unparseable values compare as 0
+    left, _ := strconv.ParseFloat(strings.TrimSpace(v), 64)
+    right, _ := strconv.ParseFloat(mt.Value, 64)
+    switch {
+    case left < right:
+      c = -1
+    case left > right:
+      c = 1
+    }
+  } else {
+    c = strings.Compare(v, mt.Value)
+  }
+
+  switch mt.Op {
+  case MATCH_OP_EQ:
+    return c == 0
+  case MATCH_OP_NE:
+    return c != 0
+  case MATCH_OP_LT:
+    return c < 0
+  case MATCH_OP_LE:
+    return c <= 0
+  case MATCH_OP_GT:
+    return c > 0
+  case MATCH_OP_GE:
+    return c >= 0
+  }
+
+  return false
+}
+
+// Resolves the date of a match term, given without its brackets, either as a
+// timestamp such as 2050-01-01 Sat 10:00 or relative to the current time.
+// Offsets in hours are relative to the current time, other offsets to the
+// start of today.
+func matchDate(s string) (time.Time, bool) {
+  now := matchNow()
+  today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+  switch s {
+  case "now":
+    return now, true
+  case "today":
+    return today, true
+  case "tomorrow":
+    return today.AddDate(0, 0, 1), true
+  case "yesterday":
+    return today.AddDate(0, 0, -1), true
+  }
+
+  if len(s) > 2 && (s[0] == '+' || s[0] == '-') {
+    n, err := strconv.Atoi(s[:len(s)-1])
+    if err == nil {
+      switch s[len(s)-1] {
+      case 'h':
+        return now.Add(time.Duration(n) * time.Hour), true
+      case 'd':
+        return today.AddDate(0, 0, n), true
+      case 'w':
+        return today.AddDate(0, 0, 7*n), true
+      case 'm':
+        return today.AddDate(0, n, 0), true
+      case 'y':
+        return today.AddDate(n, 0, 0), true
+      }
+    }
+  }
+
+  return storedMatchDate("<" + s + ">")
+}
+
+// Returns the start of the timestamp held by a property value.
+func storedMatchDate(v string) (time.Time, bool) {
+  tros, err := ParseTimestamp(strings.TrimSpace(v), WithParseLocation(matchNow().Location()))
+  if err != nil {
+    return time.Time{}, false
+  }
+
+  switch ts := tros.(type) {
+  case *Timestamp:
+    return ts.Start, true
+  case *RepeatStamp:
+    return ts.Start, true
+  case *TimestampRange:
+    if ts.StartDate != nil {
+      return ts.StartDate.Start, true
+    }
+  }
+
+  return time.Time{}, false
+}
+
+func isActive(tros TimestampRangeOrSexp) bool {
+  switch ts := tros.(type) {
+  case *Timestamp:
+    return ts.Active
+  case *RepeatStamp:
+    return ts.Active
+  case *TimestampRange:
+    return ts.IsActive()
+  }
+
+  return true
+}
+
+// Returns the value of a property as seen by a match, resolving the special
+// properties describing the heading itself.
+func matchPropertyValue(n *Node, key string) string {
+  h := n.Heading
+  switch strings.ToUpper(key) {
+  case "TODO":
+    if h != nil {
+      return h.TodoKeyword
+    }
+    return ""
+  case "LEVEL":
+    return strconv.Itoa(n.Level())
+  case "PRIORITY":
+    if h != nil {
+      return h.GetPriority().String()
+    }
+    return ""
+  case "CATEGORY":
+    return n.Category()
+  case "ITEM":
+    if h != nil {
+      return h.Text
+    }
+    return ""
+  case "SCHEDULED", "DEADLINE", "CLOSED":
+    if h != nil {
+      if p := h.GetPlanning(PlanningKind(strings.ToUpper(key))); p != nil && p.TimestampRangeOrSexp != nil {
+        return p.TimestampRangeOrSexp.String()
+      }
+    }
+    return ""
+  case "TIMESTAMP", "TIMESTAMP_IA":
+    if h != nil {
+      active := strings.ToUpper(key) == "TIMESTAMP"
+      for _, p := range h.Planning {
+        if p.PlanningKind == PLANNING_EVENT && p.TimestampRangeOrSexp != nil && isActive(p.TimestampRangeOrSexp) == active {
+          return p.TimestampRangeOrSexp.String()
+        }
+      }
+    }
+    return ""
+  case "TAGS", "ALLTAGS":
+    tags := EffectiveTagNames(n.EffectiveTags(n.tagInheritOpts()))
+    if len(tags) == 0 {
+      return ""
+    }
+    return ":" + strings.Join(tags, ":") + ":"
+  }
+
+  v, _ := n.Property(key)
+  return v
+}
+
+// Matches returns true if the node's effective tags, properties, and todo
+// keyword satisfy m, using the tag inheritance settings and tag registry of
+// the node's document.
+func (n *Node) Matches(m *Match) bool {
+  if m.Todo != nil && !m.Todo.matches(n) {
+    return false
+  }
+
+  tags := EffectiveTagNames(n.EffectiveTags(n.tagInheritOpts()))
+  return m.match(n, tags, n.tagRegistry())
+}
+
+func (tm *TodoMatch) matches(n *Node) bool {
+  if n.Heading == nil {
+    return false
+  }
+
+  kw := n.Heading.TodoKeyword
+  if tm.UndoneOnly && (kw == "" || n.Heading.IsDone()) {
+    return false
+  }
+
+  for _, ex := range tm.Exclude {
+    if kw == ex {
+      return false
+    }
+  }
+
+  if len(tm.Keywords) == 0 {
+    return true
+  }
+
+  for _, k := range tm.Keywords {
+    if kw == k {
+      return true
+    }
+  }
+
+  return false
+}
+
+func (n *Node) tagInheritOpts() TagInheritOpts {
+  bs := n.bufferSettings()
+  if bs == nil || bs.TagInheritance == nil {
+    return DefaultTagInheritOpts
+  }
+
+  return *bs.TagInheritance
+}
+
+type InvalidMatchError struct {
+  Match   string
+  Column  int
+  Reason  string
+}
+
+func (ime InvalidMatchError) Error() string {
+  return fmt.Sprintf("Invalid match %q at column %d: %s", ime.Match, ime.Column, ime.Reason)
+}
+
+func NewInvalidMatchError(col int, reason string) *InvalidMatchError {
+  return &InvalidMatchError{Column: col, Reason: reason}
+}
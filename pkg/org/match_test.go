@@ -0,0 +1,61 @@
+package org
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMatchDates(t *testing.T) {
+  matchNow = func() time.Time { return time.Date(2050, 1, 1, 10, 0, 0, 0, time.Local) }
+  defer func() { matchNow = time.Now }()
+
+  d := New()
+  d.AddHeading(1, "Report")
+  n := d.NodeTree.Subtree[0].Node
+  for kind, s := range map[PlanningKind]string{
+    PLANNING_DEADLINE: "<2050-01-03 Mon>",
+    PLANNING_SCHEDULED: "<2049-12-31 Fri 09:00>",
+    PLANNING_EVENT: "<2050-01-02 Sun 14:00>",
+  } {
+    ts, err := ParseTimestamp(s)
+    if err != nil {
+      t.Fatal(err)
+    }
+    n.Heading.SetPlanning(&Planning{PlanningKind: kind, TimestampRangeOrSexp: ts})
+  }
+
+  tests := []struct {
+    match string
+    want  bool
+  }{
+    {`DEADLINE<"<2050-01-05>"`, true},
+    {`DEADLINE<"<2050-01-03>"`, false},
+    {`DEADLINE<="<2050-01-03 Mon>"`, true},
+    {`DEADLINE=<2050-01-03>`, true},
+    {`DEADLINE<"<+1w>"`, true},
+    {`DEADLINE>"<tomorrow>"`, true},
+    {`DEADLINE<"<+2d>"`, false},
+    {`SCHEDULED<"<today>"`, true},
+    {`SCHEDULED>"<yesterday>"`, true},
+    {`SCHEDULED<"<now>"`, true},
+    {`TIMESTAMP>"<+22h>"`, true},
+    {`TIMESTAMP_IA<"<+1y>"`, false},
+    {`CLOSED<"<today>"`, false},
+  }
+
+  for _, tt := range tests {
+    m, err := ParseMatch(tt.match)
+    if err != nil {
+      t.Errorf("ParseMatch(%q): %v", tt.match, err)
+      continue
+    }
+
+    if got := n.Matches(m); got != tt.want {
+      t.Errorf("%s = %v, want %v", tt.match, got, tt.want)
+    }
+  }
+
+  if _, err := ParseMatch(`DEADLINE<"<someday>"`); err == nil {
+    t.Errorf("ParseMatch() with an invalid date should fail")
+  }
+}
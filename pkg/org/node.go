@@ -1,5 +1,10 @@
 package org
 
+import (
+	"path/filepath"
+	"strings"
+)
+
 // A node represents a discrete collection of elements on the tree consisting
 // of, at the very least, a heading element, any elements within the
 // section owned by the heading, and ends at the next occurrance of a heading.
@@ -38,3 +43,261 @@ func (n *Node) Level() int {
 
   return n.Heading.Level
 }
+
+// Returns the node owning the subtree this node's tree belongs to, or nil if
+// the node is the zero-th node or has not been placed in a tree.
+func (n *Node) Parent() *Node {
+  if n.Tree == nil || n.Tree.Parent == nil {
+    return nil
+  }
+
+  return n.Tree.Parent.Node
+}
+
+// Property returns the value of the property held by key, and whether or not
+// it was defined. Keys are compared case-insensitively. If the node does not
+// define the property itself, parent nodes and the document level properties
+// are consulted according to BufferSettings.PropertyInheritance. Properties
+// defined with a trailing "+" (E.G., `:VAR+: value`) append their value to
+// the value of VAR, separated by a single space.
+func (n *Node) Property(key string) (string, bool) {
+  return n.property(key, n.inherits(key))
+}
+
+// InheritedProperty behaves as Property, but always consults parent nodes and
+// the document regardless of the configured inheritance policy. This is the
+// equivalent of calling org-entry-get with a non-nil inherit argument, and is
+// used for properties org always treats as heritable, such as CATEGORY.
+func (n *Node) InheritedProperty(key string) (string, bool) {
+  return n.property(key, true)
+}
+
+// InheritedProperties returns every property in effect for the node: its own
+// properties, followed by those inherited from parent nodes and the document
+// as allowed by the inheritance policy. Accumulated ("+" suffixed) values are
+// resolved, and the returned keys never carry the suffix.
+func (n *Node) InheritedProperties() []Property {
+  out := make([]Property, 0)
+  seen := make(map[string]struct{}, 0)
+
+  own := true
+  for _, props := range n.propertyChain() {
+    for _, p := range props {
+      key := strings.TrimSuffix(p.Key, "+")
+      if _, ok := seen[strings.ToUpper(key)]; ok {
+        continue
+      }
+
+      if !own && !n.inherits(key) {
+        continue
+      }
+
+      seen[strings.ToUpper(key)] = struct{}{}
+      if v, ok := n.Property(key); ok {
+        out = append(out, Property{Key: key, Value: v})
+      }
+    }
+
+    own = false
+  }
+
+  return out
+}
+
+// SetProperty sets the value of the node's own property held by key,
+// replacing any existing value, including values accumulated with the "+"
+// syntax.
+func (n *Node) SetProperty(key, value string) *Node {
+  props := make([]Property, 0, len(n.Properties)+1)
+  set := false
+  for _, p := range n.Properties {
+    if strings.EqualFold(p.Key, key) || strings.EqualFold(p.Key, key+"+") {
+      if !set {
+        props = append(props, Property{Key: key, Value: value})
+        set = true
+      }
+      continue
+    }
+
+    props = append(props, p)
+  }
+
+  if !set {
+    props = append(props, Property{Key: key, Value: value})
+  }
+
+  n.Properties = props
+  return n
+}
+
+// RemoveProperty removes the node's own property held by key, including
+// values accumulated with the "+" syntax. Inherited values are not affected.
+func (n *Node) RemoveProperty(key string) *Node {
+  props := make([]Property, 0, len(n.Properties))
+  for _, p := range n.Properties {
+    if strings.EqualFold(p.Key, key) || strings.EqualFold(p.Key, key+"+") {
+      continue
+    }
+
+    props = append(props, p)
+  }
+
+  n.Properties = props
+  return n
+}
+
+// PropertyRestriction returns the "_All" suffixed property restricting the
+// values allowed for key, if one is defined on the node, a parent node, or the
+// document. Restrictions are always inherited.
+func (n *Node) PropertyRestriction(key string) (*Property, bool) {
+  rkey := key + "_All"
+  v, ok := n.InheritedProperty(rkey)
+  if !ok {
+    return nil, false
+  }
+
+  return &Property{Key: rkey, Value: v}, true
+}
+
+// Returns the heading text of the node and each of its parents, ordered from
+// the top level heading down to the node itself.
+func (n *Node) OutlinePath() []string {
+  out := make([]string, 0)
+  for cur := n; cur != nil; cur = cur.Parent() {
+    if cur.Heading == nil {
+      continue
+    }
+
+    out = append([]string{cur.Heading.Text}, out...)
+  }
+
+  return out
+}
+
+func (n *Node) inherits(key string) bool {
+  if isValueRestrictionKey(key) {
+    return true
+  }
+
+  bs := n.bufferSettings()
+  if bs == nil || bs.PropertyInheritance == nil {
+    return false
+  }
+
+  return bs.PropertyInheritance.Inherits(key)
+}
+
+func (n *Node) bufferSettings() *BufferSettings {
+  if n.Document == nil {
+    return nil
+  }
+
+  return n.Document.BufferSettings
+}
+
+func (n *Node) property(key string, inherit bool) (string, bool) {
+  val, found, complete := accumulateProperty(key, n.Properties)
+  if complete || !inherit {
+    return val, found
+  }
+
+  var upVal string
+  var upFound bool
+  if parent := n.Parent(); parent != nil {
+    upVal, upFound = parent.property(key, true)
+  } else if bs := n.bufferSettings(); bs != nil {
+    upVal, upFound, _ = accumulateProperty(key, derefProperties(bs.Properties))
+  }
+
+  if !found {
+    return upVal, upFound
+  }
+
+  return joinPropertyValues(upVal, val), true
+}
+
+// Returns the property lists consulted during inheritance, ordered from the
+// node itself up to the document level properties.
+func (n *Node) propertyChain() [][]Property {
+  out := [][]Property{n.Properties}
+
+  parent := n.Parent()
+  for ; parent != nil; parent = parent.Parent() {
+    out = append(out, parent.Properties)
+  }
+
+  if bs := n.bufferSettings(); bs != nil {
+    out = append(out, derefProperties(bs.Properties))
+  }
+
+  return out
+}
+
+// Walks a list of properties in order, resolving the value of key. A "+"
+// suffixed key appends to the value accumulated so far, while a plain key
+// replaces it and marks the value as complete, meaning no inherited value
+// should be prepended to it.
+func accumulateProperty(key string, props []Property) (string, bool, bool) {
+  val := ""
+  found := false
+  complete := false
+
+  for _, p := range props {
+    if strings.EqualFold(p.Key, key) {
+      val = p.Value
+      found = true
+      complete = true
+      continue
+    }
+
+    if strings.EqualFold(p.Key, key+"+") {
+      val = joinPropertyValues(val, p.Value)
+      found = true
+    }
+  }
+
+  return val, found, complete
+}
+
+func joinPropertyValues(left, right string) string {
+  if left == "" {
+    return right
+  }
+
+  if right == "" {
+    return left
+  }
+
+  return left + " " + right
+}
+
+func derefProperties(props []*Property) []Property {
+  out := make([]Property, 0, len(props))
+  for _, p := range props {
+    if p != nil {
+      out = append(out, *p)
+    }
+  }
+
+  return out
+}
+
+// Category returns the category of the node as used by agenda views: the
+// inherited CATEGORY property, else the document's #+CATEGORY setting, else
+// the document's file name without its extension.
+func (n *Node) Category() string {
+  if v, ok := n.InheritedProperty("CATEGORY"); ok && v != "" {
+    return v
+  }
+
+  if bs := n.bufferSettings(); bs != nil && bs.Category != "" {
+    return bs.Category
+  }
+
+  if n.Document != nil && n.Document.Path != "" {
+    base := filepath.Base(n.Document.Path)
+    return strings.TrimSuffix(base, filepath.Ext(base))
+  }
+
+  return ""
+}
@@ -0,0 +1,141 @@
+package org
+
+import (
+	"regexp"
+	"testing"
+)
+
+func testingPropertyDocument(pi *PropertyInheritance) (*Document, *Node) {
+  d := New()
+  d.BufferSettings.PropertyInheritance = pi
+  d.BufferSettings.Properties = []*Property{
+    {Key: "Owner", Value: "docs"},
+    {Key: "Status_All", Value: "open closed"},
+  }
+
+  d.AddHeading(1, "Parent")
+  d.AddHeading(2, "Child")
+
+  parent := d.NodeTree.Subtree[0].Node
+  parent.Properties = []Property{
+    {Key: "VAR", Value: "a"},
+    {Key: "VAR+", Value: "b"},
+    {Key: "Color", Value: "red"},
+  }
+
+  child := parent.Tree.Subtree[0].Node
+  child.Properties = []Property{
+    {Key: "var+", Value: "c"},
+  }
+
+  return d, child
+}
+
+func TestNodeProperty(t *testing.T) {
+  var tests = []struct {
+    policy *PropertyInheritance
+    key string
+    want string
+    found bool
+  }{
+    {nil, "VAR", "c", true},
+    {nil, "Color", "", false},
+    {nil, "Status_All", "open closed", true},
+    {&PropertyInheritance{Kind: PROPERTY_INHERITANCE_ALL}, "VAR", "a b c", true},
+    {&PropertyInheritance{Kind: PROPERTY_INHERITANCE_ALL}, "owner", "docs", true},
+    {&PropertyInheritance{Kind: PROPERTY_INHERITANCE_LIST, Keys: []string{"color"}}, "Color", "red", true},
+    {&PropertyInheritance{Kind: PROPERTY_INHERITANCE_LIST, Keys: []string{"color"}}, "Owner", "", false},
+    {&PropertyInheritance{Kind: PROPERTY_INHERITANCE_REGEXP, Pattern: regexp.MustCompile("^Own")}, "Owner", "docs", true},
+  }
+
+  for _, test := range tests {
+    _, child := testingPropertyDocument(test.policy)
+    got, found := child.Property(test.key)
+    if got != test.want || found != test.found {
+      t.Errorf("Property(%s) = %q, %v; want %q, %v", test.key, got, found, test.want, test.found)
+    }
+  }
+}
+
+func TestNodeInheritedProperties(t *testing.T) {
+  _, child := testingPropertyDocument(&PropertyInheritance{Kind: PROPERTY_INHERITANCE_ALL})
+  want := map[string]string{
+    "var": "a b c",
+    "Color": "red",
+    "Owner": "docs",
+    "Status_All": "open closed",
+  }
+
+  got := child.InheritedProperties()
+  if len(got) != len(want) {
+    t.Fatalf("InheritedProperties() = %v", got)
+  }
+
+  for _, p := range got {
+    if want[p.Key] != p.Value {
+      t.Errorf("InheritedProperties() %s = %q, want %q", p.Key, p.Value, want[p.Key])
+    }
+  }
+}
+
+func TestRestrictionValues(t *testing.T) {
+  p := &Property{Key: "Status_ALL", Value: `open  "in review" closed`}
+  want := []string{"open", "in review", "closed"}
+
+  got := p.RestrictionValues()
+  if len(got) != len(want) {
+    t.Fatalf("RestrictionValues() = %v, want %v", got, want)
+  }
+
+  for i := range want {
+    if got[i] != want[i] {
+      t.Errorf("RestrictionValues() = %v, want %v", got, want)
+    }
+  }
+
+  if p.RestrictionKey() != "Status" {
+    t.Errorf("RestrictionKey() = %s, want Status", p.RestrictionKey())
+  }
+
+  if (&Property{Key: "ID"}).IsValueRestriction() {
+    t.Errorf("IsValueRestriction() = true for short key")
+  }
+}
+
+func TestDocumentValidateProperties(t *testing.T) {
+  d, child := testingPropertyDocument(nil)
+  child.Properties = append(child.Properties, Property{Key: "Status", Value: "pending"})
+  child.Parent().Properties = append(child.Parent().Properties, Property{Key: "Status", Value: "closed"})
+
+  errs := d.ValidateProperties()
+  if len(errs) != 1 {
+    t.Fatalf("ValidateProperties() returned %d errors, want 1", len(errs))
+  }
+
+  if errs[0].Node != child || errs[0].PropertyValue != "pending" {
+    t.Errorf("ValidateProperties() = %v", errs[0])
+  }
+
+  if len(errs[0].OutlinePath) != 2 || errs[0].OutlinePath[1] != "Child" {
+    t.Errorf("OutlinePath = %v", errs[0].OutlinePath)
+  }
+}
+
+func TestDocumentValidateAccumulatedProperties(t *testing.T) {
+  d, child := testingPropertyDocument(nil)
+  child.Properties = append(child.Properties, Property{Key: "Status+", Value: "open pending"})
+  d.BufferSettings.Properties = append(d.BufferSettings.Properties, &Property{Key: "Status", Value: "stale"})
+
+  errs := d.ValidateProperties()
+  if len(errs) != 2 {
+    t.Fatalf("ValidateProperties() returned %d errors, want 2", len(errs))
+  }
+
+  if errs[0].Node != child || errs[0].PropertyValue != "pending" {
+    t.Errorf("accumulated value error = %v", errs[0])
+  }
+
+  if errs[1].Node != d.NodeTree.Node || errs[1].PropertyValue != "stale" {
+    t.Errorf("document level error = %v", errs[1])
+  }
+}
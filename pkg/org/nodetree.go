@@ -1,6 +1,10 @@
 package org
 
-import "github.com/lcyvin/gorgeous/internal/util"
+import (
+	"iter"
+
+	"github.com/lcyvin/gorgeous/internal/util"
+)
 
 type MetaNodeTree struct {
   Parent *MetaNodeTree
@@ -42,6 +46,7 @@ func (mnt *MetaNodeTree) AddNode(n *Node) *MetaNodeTree {
     Node: n,
     Parent: mnt,
   }
+  n.Tree = newMetaNode
 
   mnt.Subtree = append(mnt.Subtree, newMetaNode)
 
@@ -53,6 +58,28 @@ func (mnt *MetaNodeTree) AddSubtree(st *MetaNodeTree) *MetaNodeTree {
   return mnt
 }
 
+// Nodes returns an iterator over the node held by this tree and every node in
+// its subtrees, depth first and in document order.
+func (mnt *MetaNodeTree) Nodes() iter.Seq[*Node] {
+  return func(yield func(*Node) bool) {
+    mnt.walk(yield)
+  }
+}
+
+func (mnt *MetaNodeTree) walk(yield func(*Node) bool) bool {
+  if mnt.Node != nil && !yield(mnt.Node) {
+    return false
+  }
+
+  for _, st := range mnt.Subtree {
+    if !st.walk(yield) {
+      return false
+    }
+  }
+
+  return true
+}
+
 func (mnt *MetaNodeTree) Level() int {
   return mnt.Node.Level()
 }
@@ -146,65 +173,27 @@ func (mnt *MetaNodeTree) WalkBackToLevel(targetLvl int) *MetaNodeTree {
     return mnt
   }
 
-  if mnt.Parent == nil {
-    return nil
-  }
-
   tree := mnt.Parent
-
-  for lvl := tree.Level(); lvl <= targetLvl; tree = tree.Parent {
-    if lvl <= targetLvl {
-      return tree
-    }
+  for tree != nil && tree.Level() > targetLvl {
+    tree = tree.Parent
   }
 
-  return nil
+  return tree
 }
 
+// Returns the tags inherited by the node held by this tree, including any set
+// by FILETAGS, in stable order with duplicates removed. The node's own tags
+// are not included, see Node.EffectiveTags for the full tag set of a node.
 func (mnt *MetaNodeTree) InheritTags(include, exclude []string, all bool) []string {
-  upstreamTags := make([]string, 0)
-
-  if len(include) == 0 && !all {
-    return upstreamTags
-  }
-
-  if mnt.Parent.Level() != 0 || mnt.Parent.Node == nil {
-    upstreamTags = mnt.Parent.InheritTags(include, exclude, all)
-  }
-
-  for _, v := range mnt.Parent.GetNodeTags() {
-    pass := false
-
-    if !util.In(v, include) && !all {
-      pass = true
-    }
-
-    if util.In(v, exclude) && all {
-      pass = true
-    }
-
-    if pass {
-      continue
-    }
-
-    upstreamTags = append(upstreamTags, v)
-  }
-
-  // this is just to de-dupe the list we have. Using map keys lets us emulate
-  // 'set' behavior in this instance
-  coalesce := make(map[string]struct{}, 0)
-  for _, v := range upstreamTags {
-    if _, exists := coalesce[v]; !exists {
-      coalesce[v] = struct{}{}
-    }
-  }
-
-  out := make([]string, 0)
-  for k := range coalesce {
-    out = append(out, k)
+  if mnt.Node == nil {
+    return make([]string, 0)
   }
 
-   return out
+  return mnt.Node.inheritedTags(TagInheritOpts{
+    InheritAll: all,
+    Inherit: include,
+    NoInherit: exclude,
+  })
 }
 
 func (mnt *MetaNodeTree) GetNodeTags() []string {
@@ -246,9 +235,3 @@ func (mnt *MetaNodeTree) GetNodesByProperties(propMap map[string][]string) []*No
 
   return nodes
 }
-
-type TagInheritOpts struct {
-  InheritAll bool
-  Inherit []string
-  NoInherit []string
-}
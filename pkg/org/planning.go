@@ -41,6 +41,7 @@ const (
   // the timestamp
   PLANNING_SCHEDULED PlanningKind = "SCHEDULED"
   PLANNING_DEADLINE  PlanningKind = "DEADLINE"
+  PLANNING_CLOSED    PlanningKind = "CLOSED"
 )
 
 func (pk PlanningKind) String() string {
@@ -48,7 +49,8 @@ func (pk PlanningKind) String() string {
 }
 
 type TimestampRangeOrSexp interface {
-  // Should return out of either TIMESTAMP_KIND_TIMESTAMP or TIMESTAMP_KIND_SEXP
+  // Should return one of the TIMESTAMP_KIND values other than
+  // TIMESTAMP_KIND_UNKNOWN
   Kind() TimestampKind
 
   // Returns true if the planning event held by the TimestampRange or sexp 
@@ -81,4 +83,5 @@ const (
   TIMESTAMP_KIND_TIMESTAMP = "timestamp"
   TIMESTAMP_KIND_TIMESTAMP_RANGE = "timestamp-range"
   TIMESTAMP_KIND_SEXP = "sexp"
+  TIMESTAMP_KIND_RECURRENCE = "recurrence"
 )
@@ -3,6 +3,7 @@ package org
 import (
 	"fmt"
 	"strings"
+	"unicode"
 )
 
 type Property struct {
@@ -25,13 +26,16 @@ func (p Property) IsGreaterElement() bool {
 // Org syntax defines that properties ending with the suffix `_All`
 // should be heritable by nodes down the tree, enforcing the values
 // listed (whitespace-separated) as the allowed values for the 
-// corresponding property (sans _All).
+// corresponding property (sans _All). The suffix is matched
+// case-insensitively.
 func (p *Property) IsValueRestriction() bool {
-  if p.Key[len(p.Key)-4:] == "_All" {
-    return true
-  }
+  return isValueRestrictionKey(p.Key)
+}
 
-  return false
+// Returns true if the key carries the "_All" suffix, compared
+// case-insensitively as org does.
+func isValueRestrictionKey(key string) bool {
+  return strings.HasSuffix(strings.ToUpper(key), "_ALL")
 }
 
 // When a property's value is restricted by heritable `_All`-suffixed
@@ -39,7 +43,7 @@ func (p *Property) IsValueRestriction() bool {
 // name matchse the restriction key less the suffix.
 func (p *Property) RestrictionKey() string {
   if p.IsValueRestriction() {
-    return p.Key[len(p.Key)-4:]
+    return p.Key[:len(p.Key)-4]
   }
 
   return p.Key
@@ -56,22 +60,31 @@ func (p *Property) RestrictionValues() []string {
   }
 
   brktOpen := false
+  quoted := false
   val := ""
   for _, c := range p.Value {
     if c == '"' {
       brktOpen = !brktOpen
+      quoted = true
       continue
     }
 
-    if c == ' ' && !brktOpen {
-      out = append(out, val)
+    if unicode.IsSpace(c) && !brktOpen {
+      if val != "" || quoted {
+        out = append(out, val)
+      }
       val = ""
+      quoted = false
       continue
     }
 
     val += string(c)
   }
 
+  if val != "" || quoted {
+    out = append(out, val)
+  }
+
   return out
 }
 
@@ -95,7 +108,7 @@ func (p *Property) Validate(prop *Property) error {
     }
   }
 
-  return NewInvalidPropertyValueError(p, prop)
+  return NewInvalidPropertyValueError(prop, p)
 }
 
 type NotValueRestictionPropertyError struct {
@@ -122,6 +135,12 @@ type InvalidPropertyValueError struct {
   PropertyValue     string
   Restrictor        string
   RestrictorValues  []string
+  // Node holds the node defining the invalid value when the error was
+  // produced by a document-wide validation, and is otherwise nil.
+  Node              *Node
+  // OutlinePath holds the heading text of the node and each of its parents,
+  // from the top level heading down, to locate the node in error output.
+  OutlinePath       []string
 }
 
 func NewInvalidPropertyValueError(p, r *Property) *InvalidPropertyValueError {
@@ -136,8 +155,19 @@ func NewInvalidPropertyValueError(p, r *Property) *InvalidPropertyValueError {
 }
 
 func (ipve InvalidPropertyValueError) Error() string {
-  msg := fmt.Sprintf(
-    "Invalid property value for property %s: %s.",
+  msg := ""
+  if ipve.Node != nil {
+    if ipve.Node.Document != nil && ipve.Node.Document.Path != "" {
+      msg += ipve.Node.Document.Path + ": "
+    }
+
+    if len(ipve.OutlinePath) > 0 {
+      msg += strings.Join(ipve.OutlinePath, "/") + ": "
+    }
+  }
+
+  msg += fmt.Sprintf(
+    "Invalid property value for property %s: %s. ",
     ipve.Property,
     ipve.PropertyValue,
     )
@@ -1,7 +1,7 @@
 package org
 
 import (
-	"fmt"
+	"iter"
 	"time"
 )
 
@@ -9,7 +9,7 @@ var DefaultRepeatConfig RepeatConfig = RepeatConfig{
   ClampToEndOfMonth: false,
   ShiftByDays: false,
   FixedDate: true,
-  Location: time.Now().Location(),
+  Location: nil,
 }
 
 type RepeatConfig struct {
@@ -47,6 +47,10 @@ type RepeatConfig struct {
   // only occur in february if it is a leap year.
   FixedDate bool
 
+  // Location shifts are computed in, so a repeater keeps its time of day in
+  // that zone across daylight saving transitions. When nil, as in
+  // DefaultRepeatConfig, shifts are computed in the location of the
+  // timestamp itself.
   Location *time.Location
 }
 
@@ -63,7 +67,7 @@ type RepeatStamp struct {
 func NewRepeatStampFromTimestamp(ts *Timestamp, cfg RepeatConfig) *RepeatStamp {
   return &RepeatStamp{
     Timestamp: *ts,
-    RepeatConfig: DefaultRepeatConfig,
+    RepeatConfig: cfg,
   }
 }
 
@@ -76,51 +80,107 @@ func NewRepeatStamp(start time.Time, cfg RepeatConfig, opts... NewTimestampOpt)
   return rs
 }
 
-// Returns a standard representation of a repeatstamp definition in orgmode.
-// This is primarily intended for debug output, and writers should implement
-// more robust handlers for this.
+// Returns the repeatstamp as org writes it, including its repeat cookie. See
+// Timestamp.Format.
 func (rs *RepeatStamp) String() string {
-  out := fmt.Sprintf("%d-%d-%d %s", rs.Year(), rs.Month(), rs.Day(), rs.Weekday())
+  return rs.Timestamp.Format()
+}
+
+// Returns a list containing one element, which is the result of RepeatStamp.String()
+func (rs *RepeatStamp) Strings() []string {
+  return []string{rs.String()}
+}
 
-  if !rs.DateOnly {
-    out += fmt.Sprintf(" %02d:%02d", rs.Start.Hour(), rs.Start.Minute())
+// Returns a boolean value describing if the repeating event occurs within the
+// window defined by start and end, see RepeatStamp.Occurrences. This does not
+// consider the current state of the timestamp, as repeated events in vanilla
+// orgmode are considered to repeat ad infinitum.
+func (rs *RepeatStamp) InWindow(start, end time.Time) bool {
+  for range rs.Occurrences(start, end) {
+    return true
   }
 
-  if !rs.DateOnly && !rs.End.IsZero() {
-    out += fmt.Sprintf("-%02d:%02d", rs.End.Hour(), rs.End.Minute())
+  return false
+}
+
+// Occurrences returns the timestamp and each of its repetitions that overlap
+// the window [start, end), in order. A timestamp without a time range
+// overlaps the window when it starts within it. Repetitions are computed with
+// Shiftn, so they follow the month mode set by RepeatConfig, and never occur
+// before the timestamp itself. A timestamp without a repeat cookie yields at
+// most itself.
+func (rs *RepeatStamp) Occurrences(start, end time.Time) iter.Seq[*Timestamp] {
+  return func(yield func(*Timestamp) bool) {
+    if rs.Repeat == nil || rs.Repeat.IntervalAmount <= 0 {
+      if rs.overlaps(start, end) {
+        occ := rs.Timestamp
+        yield(&occ)
+      }
+      return
+    }
+
+    cur := rs.skipTo(start)
+    for cur != nil && cur.Start.Before(end) {
+      if cur.overlaps(start, end) {
+        occ := cur.Timestamp
+        if !yield(&occ) {
+          return
+        }
+      }
+
+      next := cur.Shiftn(1)
+      if next == nil || !next.Start.After(cur.Start) {
+        return
+      }
+
+      cur = next
+    }
   }
+}
 
-  out += fmt.Sprintf(" %s", rs.Repeat.String())
+// Returns true if the stamp overlaps [start, end).
+func (rs *RepeatStamp) overlaps(start, end time.Time) bool {
+  if !rs.Start.Before(end) {
+    return false
+  }
 
-  enclose := "<%s>"
-  if !rs.Active {
-    enclose = "[%s]"
+  if rs.End.After(rs.Start) {
+    return rs.End.After(start)
   }
 
-  return fmt.Sprintf(enclose, out)
+  return !rs.Start.Before(start)
 }
 
-// Returns a list containing one element, which is the result of RepeatStamp.String()
-func (rs *RepeatStamp) Strings() []string {
-  return []string{rs.String()}
-}
+// Returns the stamp shifted by as many whole intervals as can be skipped
+// without passing any repetition overlapping t. Hour, day and week intervals
+// are skipped in one step, leaving a margin of one interval for daylight
+// saving transitions. Month and year intervals are returned as-is, as month
+// shifts depend on the repetitions before them.
+func (rs *RepeatStamp) skipTo(t time.Time) *RepeatStamp {
+  var interval time.Duration
+  amt := time.Duration(rs.Repeat.IntervalAmount)
+  switch rs.Repeat.Interval {
+  case REPEAT_INTERVAL_HOUR:
+    interval = amt*time.Hour
+  case REPEAT_INTERVAL_DAY:
+    interval = amt*24*time.Hour
+  case REPEAT_INTERVAL_WEEK:
+    interval = amt*7*24*time.Hour
+  default:
+    return rs
+  }
 
-// Returns a boolean value describing if the repeating event may occur within the
-// window defined by start and end, inclusively. This does not consider the
-// current state of the timestamp, as repeated events in vanilla orgmode are
-// considered to repeat ad infinitum.
-func (rs *RepeatStamp) InWindow(start, end time.Time) bool {
-  start = start.In(rs.Start.Location())
-  end = end.In(rs.Start.Location())
+  span := time.Duration(0)
+  if rs.End.After(rs.Start) {
+    span = rs.End.Sub(rs.Start)
+  }
 
-  // using Shiftn() instead of ShiftUntilAfter() because ShiftUntilAfter() is
-  // exclusive, and something could be partially in-window.
-  afterStart := rs.ShiftUntil(start).Shiftn(1)
-  
-  // since afterStart should be the next repetition immediately following
-  // the result of ShiftUntil(), which is exclusive, we can use its internally
-  // held Timestamp struct's InWindow func to perform the actual window check.
-  return afterStart.Timestamp.InWindow(start, end)
+  n := int(t.Sub(rs.Start.Add(span))/interval) - 1
+  if n < 1 {
+    return rs
+  }
+
+  return rs.Shiftn(n)
 }
 
 // Implements the Shift() function as required by api.Repeater
@@ -133,7 +193,7 @@ func (rs *RepeatStamp) InWindow(start, end time.Time) bool {
 func (rs *RepeatStamp) Shift(t time.Time) *RepeatStamp {
   switch rs.Repeat.Kind {
   case REPEAT_KIND_SHIFT:
-    return rs.Shiftn(rs.Repeat.IntervalAmount)
+    return rs.Shiftn(1)
   case REPEAT_KIND_SHIFT_FUTURE_FIXED:
     if t.IsZero() {
       t = time.Now()
@@ -154,7 +214,14 @@ func (rs *RepeatStamp) Shift(t time.Time) *RepeatStamp {
       duration = rs.End.Sub(rs.Start)
     }
 
+    // org shifts relative to today for day and larger intervals, keeping the
+    // time of day held by the timestamp. Hourly repeats are relative to now.
     nrs.Start = now
+    if rs.Repeat.Interval != REPEAT_INTERVAL_HOUR {
+      y, m, d := now.In(rs.Start.Location()).Date()
+      hour, minute, _ := rs.Start.Clock()
+      nrs.Start = time.Date(y, m, d, hour, minute, 0, 0, rs.Start.Location())
+    }
     
     if !rs.End.IsZero() {
       nrs.End = nrs.Start.Add(duration)
@@ -176,7 +243,13 @@ func (rs *RepeatStamp) Shift(t time.Time) *RepeatStamp {
 // timestamp into the future, only ever performing one shift on the timestamp.
 // Ipso facto, that timestamp may remain in the past if it has not been actioned
 // for some time. 
+//
+// Shifts are computed in RepeatConfig.Location when one is set, so a
+// timestamp keeps its time of day in that zone across daylight saving
+// transitions, and the returned stamp is held in that location. Otherwise
+// they are computed in, and returned in, the timestamp's own location.
 func (rs *RepeatStamp) Shiftn(i int) *RepeatStamp {
+  rs = rs.inRepeatLocation()
   amt := rs.Repeat.IntervalAmount
   switch rs.Repeat.Interval {
   case REPEAT_INTERVAL_HOUR:
@@ -193,59 +266,69 @@ func (rs *RepeatStamp) Shiftn(i int) *RepeatStamp {
 
     return o
   case REPEAT_INTERVAL_YEAR:
-    return rs.shiftByYears(amt)
+    return rs.shiftByYears(amt*i)
   default:
     return nil
   }
 }
 
-// ShiftUntil returns a new pointer to a RepeatStamp whose timestamp is exactly
-// before the supplied time. That is, its scheduled start and end occur BEFORE
-// the time passed to `t`. 
+// ShiftUntil returns a new pointer to a RepeatStamp holding the last
+// repetition which occurs entirely before the supplied time. That is, its
+// scheduled start and end occur BEFORE the time passed to `t`. If no
+// repetition does, a copy of the stamp itself is returned.
 func (rs *RepeatStamp) ShiftUntil(t time.Time) *RepeatStamp {
-  nrs := *rs
-  one := rs.Shiftn(1)
-  next := one.Shiftn(1)
-  delta := one.Start.Sub(rs.Start)
+  ends := func(s *RepeatStamp) time.Time {
+    if s.End.After(s.Start) {
+      return s.End
+    }
 
-  if t.Before(one.Start) && t.Before(one.End) {
-    return &nrs
+    return s.Start
   }
 
-  if t.After(one.Start) && t.Before(next.Start) {
-    return one
+  cur := rs.skipTo(t)
+  if cur != rs && !ends(cur).Before(t) {
+    cur = rs
   }
 
-  // this will not always land, but should get us in the ballpark
-  window := t.Sub(rs.Start)
-  shiftN := int(window.Hours()/delta.Hours())
-  
-  try := rs.Shiftn(shiftN)
-  if t.Before(try.Start) && t.Before(try.End) {
-    halfShift := int(shiftN/2)
-    return rs.Shiftn(halfShift).ShiftUntil(t)   
+  for {
+    next := cur.Shiftn(1)
+    if next == nil || !next.Start.After(cur.Start) || !ends(next).Before(t) {
+      nrs := *cur
+      return &nrs
+    }
+
+    cur = next
   }
+}
 
-  confirmTry := try.Shiftn(1)
-  if t.Before(confirmTry.Start) && t.Before(confirmTry.End) {
-    return confirmTry.ShiftUntil(t)
+// ShiftUntilAfter returns a new pointer to a RepeatStamp shifted by as many
+// intervals as needed for its start to occur after t, with a minimum shift of
+// one interval.
+func (rs *RepeatStamp) ShiftUntilAfter(t time.Time) *RepeatStamp {
+  next := rs.skipTo(t).Shiftn(1)
+  for next != nil && !next.Start.After(t) {
+    next = next.Shiftn(1)
   }
 
-  return try
+  return next
 }
 
-func (rs *RepeatStamp) ShiftUntilAfter(t time.Time) *RepeatStamp {
-  before := rs.ShiftUntil(t)
-  after := before.Shiftn(1)
-
-  // Technically, we should only need to check t.After(after.Start), but I'm
-  // keeping the second check in for safety in case an impossible date range is
-  // supplied somehow.
-  if t.After(after.Start) && t.After(after.End) {
-    after.ShiftUntilAfter(t)
+// Returns the repeatstamp converted to RepeatConfig.Location, if one is set,
+// or with RepeatConfig.Location set to the timestamp's own location.
+func (rs *RepeatStamp) inRepeatLocation() *RepeatStamp {
+  loc := rs.RepeatConfig.Location
+  if loc == rs.Start.Location() {
+    return rs
+  }
+
+  nrs := *rs
+  if loc == nil {
+    nrs.RepeatConfig.Location = rs.Start.Location()
+    return &nrs
   }
 
-  return after
+  nrs.Timestamp = *rs.Timestamp.In(loc)
+  return &nrs
 }
 
 func (rs *RepeatStamp) shiftByHours(i int) *RepeatStamp {
@@ -257,14 +340,14 @@ func (rs *RepeatStamp) shiftByHours(i int) *RepeatStamp {
   // if the timestamp was originally defined without a specific time, but has
   // an hourly repeat, we need to assume it is incrementing from 00:00 on that
   // calendar day.
+  base := rs.Start
   if rs.DateOnly {
     y, m, d := rs.Start.Date()
-    rs.Start = time.Date(y, m, d, 0, 0, 0, 0, rs.RepeatConfig.Location)
+    base = time.Date(y, m, d, 0, 0, 0, 0, rs.Start.Location())
     nrs.DateOnly = false
   }
 
-  start := rs.Start.Add(time.Duration(i)*time.Hour)
-  nrs.Start = start
+  nrs.Start = base.Add(time.Duration(i)*time.Hour)
 
   if !rs.End.IsZero() {
       nrs.End = rs.End.Add(time.Duration(i)*time.Hour)
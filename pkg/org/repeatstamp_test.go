@@ -52,3 +52,119 @@ func TestShiftFutureFixed(t *testing.T) {
     }
   }
 }
+
+func TestOccurrences(t *testing.T) {
+  utc := time.UTC
+  window := func(y int, m time.Month, d int, days int) (time.Time, time.Time) {
+    s := time.Date(y, m, d, 0, 0, 0, 0, utc)
+    return s, s.AddDate(0, 0, days)
+  }
+
+  format := func(rs *RepeatStamp, start, end time.Time) []string {
+    out := make([]string, 0)
+    for occ := range rs.Occurrences(start, end) {
+      out = append(out, occ.Start.Format("2006-01-02 15:04"))
+    }
+    return out
+  }
+
+  clamp := RepeatConfig{ClampToEndOfMonth: true, FixedDate: true, Location: utc}
+  clampOnly := RepeatConfig{ClampToEndOfMonth: true, Location: utc}
+  byDays := RepeatConfig{ShiftByDays: true, Location: utc}
+  clampByDays := RepeatConfig{ClampToEndOfMonth: true, ShiftByDays: true, Location: utc}
+  fixed := RepeatConfig{FixedDate: true, Location: utc}
+  monthly := func(cfg RepeatConfig) *RepeatStamp {
+    r, _ := ParseRepeat("+1m")
+    return NewRepeatStamp(time.Date(2050, 1, 31, 0, 0, 0, 0, utc), cfg, WithDateOnly(), WithRepeat(r))
+  }
+
+  start, end := window(2050, 1, 1, 120)
+  tests := []struct {
+    name string
+    got  []string
+    want []string
+  }{
+    {"clamp", format(monthly(clamp), start, end), []string{"2050-01-31 00:00", "2050-02-28 00:00", "2050-03-28 00:00", "2050-04-28 00:00"}},
+    {"clamp only", format(monthly(clampOnly), start, end), []string{"2050-01-31 00:00", "2050-02-28 00:00", "2050-03-31 00:00", "2050-04-30 00:00"}},
+    {"days", format(monthly(byDays), start, end), []string{"2050-01-31 00:00", "2050-03-02 00:00", "2050-04-01 00:00"}},
+    {"clamp days", format(monthly(clampByDays), start, end), []string{"2050-01-31 00:00", "2050-02-28 00:00", "2050-03-30 00:00", "2050-04-29 00:00"}},
+    {"fixed", format(monthly(fixed), start, end), []string{"2050-01-31 00:00", "2050-03-31 00:00"}},
+  }
+
+  hourly := NewRepeatStamp(time.Date(2020, 1, 1, 8, 30, 0, 0, utc), RepeatConfig{Location: utc},
+    WithRepeat(&Repeat{Kind: REPEAT_KIND_SHIFT, IntervalAmount: 6, Interval: REPEAT_INTERVAL_HOUR}))
+  start, end = window(2020, 3, 1, 1)
+  tests = append(tests, struct {
+    name string
+    got  []string
+    want []string
+  }{"hours", format(hourly, start, end), []string{"2020-03-01 02:30", "2020-03-01 08:30", "2020-03-01 14:30", "2020-03-01 20:30"}})
+
+  for _, tt := range tests {
+    if len(tt.got) != len(tt.want) {
+      t.Errorf("%s: Occurrences() = %v, want %v", tt.name, tt.got, tt.want)
+      continue
+    }
+
+    for i := range tt.want {
+      if tt.got[i] != tt.want[i] {
+        t.Errorf("%s: Occurrences() = %v, want %v", tt.name, tt.got, tt.want)
+        break
+      }
+    }
+  }
+
+  // a weekly time range still running at the start of the window is included
+  r, _ := ParseRepeat("+1w")
+  meeting := NewRepeatStamp(time.Date(2050, 1, 3, 23, 0, 0, 0, utc), DefaultRepeatConfig,
+    WithEnd(time.Date(2050, 1, 4, 1, 0, 0, 0, utc)), WithRepeat(r))
+  meeting.RepeatConfig.Location = utc
+  start, end = window(2050, 3, 1, 7)
+  got := make([]*Timestamp, 0)
+  for occ := range meeting.Occurrences(start, end) {
+    got = append(got, occ)
+  }
+
+  if len(got) != 2 || got[0].Start.Day() != 28 || got[0].End.Day() != 1 || got[1].Start.Day() != 7 {
+    t.Errorf("Occurrences() of a time range = %v", got)
+  }
+
+  if !meeting.InWindow(start, end) || meeting.InWindow(time.Date(2050, 3, 8, 2, 0, 0, 0, utc), time.Date(2050, 3, 14, 0, 0, 0, 0, utc)) {
+    t.Errorf("InWindow() disagrees with Occurrences()")
+  }
+
+  before := meeting.ShiftUntil(time.Date(2050, 3, 1, 0, 30, 0, 0, utc))
+  if before.Start.Format(time.DateOnly) != "2050-02-21" {
+    t.Errorf("ShiftUntil() = %v, want the repetition of 2050-02-21", before.Start)
+  }
+
+  day := NewRepeatStamp(time.Date(2050, 1, 1, 0, 0, 0, 0, utc), RepeatConfig{FixedDate: true, Location: utc},
+    WithDateOnly(), WithRepeat(&Repeat{Kind: REPEAT_KIND_SHIFT, IntervalAmount: 12, Interval: REPEAT_INTERVAL_HOUR}))
+  if next := day.Shiftn(1); next.Start.Hour() != 12 || next.DateOnly || !day.DateOnly || !day.Start.Equal(time.Date(2050, 1, 1, 0, 0, 0, 0, utc)) {
+    t.Errorf("hourly Shiftn() = %v, source %v", next, day)
+  }
+}
+
+func TestShiftInOwnLocation(t *testing.T) {
+  ny, err := time.LoadLocation("America/New_York")
+  if err != nil {
+    t.Skip(err)
+  }
+
+  local := time.Local
+  time.Local = ny
+  defer func() { time.Local = local }()
+
+  r, _ := ParseRepeat("+1m")
+  rs := NewRepeatStamp(time.Date(2020, 1, 31, 14, 30, 0, 0, time.UTC), DefaultRepeatConfig, WithRepeat(r))
+  next := rs.Shiftn(1)
+  if next.Start.Location() != time.UTC || next.Start.Format("2006-01-02 15:04") != "2020-03-31 14:30" {
+    t.Errorf("Shiftn(1) = %v, want 2020-03-31 14:30 UTC", next.Start)
+  }
+
+  r, _ = ParseRepeat("+1d")
+  rs = NewRepeatStamp(time.Date(2020, 3, 7, 14, 30, 0, 0, time.UTC), DefaultRepeatConfig, WithRepeat(r))
+  if got := rs.Shiftn(2).Start; got.Location() != time.UTC || got.Hour() != 14 {
+    t.Errorf("Shiftn(2) = %v, want 14:30 UTC", got)
+  }
+}
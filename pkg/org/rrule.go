@@ -0,0 +1,870 @@
+package org
+
+import (
+	"fmt"
+	"iter"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RRULE_PROPERTY and EXDATE_PROPERTY hold a recurrence rule, and the dates it
+// excludes, for headings whose recurrence org's repeaters and diary sexps
+// can not express. See Node.SetRecurrence.
+const (
+  RRULE_PROPERTY  = "RRULE"
+  EXDATE_PROPERTY = "EXDATE"
+)
+
+// RRule is an RFC 5545 recurrence rule, E.G., FREQ=MONTHLY;BYDAY=2TU. The
+// FREQ, INTERVAL, BYDAY, BYMONTHDAY, BYMONTH, COUNT, UNTIL and WKST parts
+// are supported.
+type RRule struct {
+  Freq       RRuleFreq
+  // Defaults to 1.
+  Interval   int
+  ByDay      []RRuleDay
+  // Days of the month, negative values count back from the last day.
+  ByMonthDay []int
+  ByMonth    []time.Month
+  // The total number of occurrences, including the first. Zero when unset.
+  Count      int
+  // The last instant an occurrence may start at, inclusive. Zero when unset.
+  Until      time.Time
+  // Set when UNTIL was given as a date rather than a date and time.
+  UntilDate  bool
+  // The day weeks start on, which places the weeks of WEEKLY rules with an
+  // INTERVAL above 1 and a BYDAY. ParseRRule defaults it to Monday.
+  WeekStart  time.Weekday
+}
+
+type RRuleFreq string
+
+const (
+  RRULE_FREQ_UNKNOWN RRuleFreq = ""
+  RRULE_FREQ_HOURLY  RRuleFreq = "HOURLY"
+  RRULE_FREQ_DAILY   RRuleFreq = "DAILY"
+  RRULE_FREQ_WEEKLY  RRuleFreq = "WEEKLY"
+  RRULE_FREQ_MONTHLY RRuleFreq = "MONTHLY"
+  RRULE_FREQ_YEARLY  RRuleFreq = "YEARLY"
+)
+
+func (rf RRuleFreq) String() string {
+  return string(rf)
+}
+
+// RRuleDay is a BYDAY entry: a weekday, and for monthly and yearly rules an
+// optional ordinal, E.G., 2TU for the second Tuesday or -1FR for the last
+// Friday. N is zero when no ordinal is given.
+type RRuleDay struct {
+  N       int
+  Weekday time.Weekday
+}
+
+var rruleWeekdays = []string{"SU", "MO", "TU", "WE", "TH", "FR", "SA"}
+
+func (rd RRuleDay) String() string {
+  if rd.N == 0 {
+    return rruleWeekdays[rd.Weekday]
+  }
+
+  return strconv.Itoa(rd.N) + rruleWeekdays[rd.Weekday]
+}
+
+// ParseRRule parses a recurrence rule, with or without its "RRULE:" prefix.
+// An UNTIL without a zone is read in loc.
+func ParseRRule(s string, loc *time.Location) (*RRule, error) {
+  s = strings.TrimSpace(s)
+  rule, _ := strings.CutPrefix(s, "RRULE:")
+  r := &RRule{Interval: 1, WeekStart: time.Monday}
+
+  for _, part := range strings.Split(rule, ";") {
+    if strings.TrimSpace(part) == "" {
+      continue
+    }
+
+    key, value, ok := strings.Cut(part, "=")
+    if !ok {
+      return nil, NewInvalidRRuleError(s, fmt.Sprintf("expected KEY=VALUE, got %q", part))
+    }
+
+    var err error
+    switch strings.ToUpper(key) {
+    case "FREQ":
+      r.Freq = RRuleFreq(strings.ToUpper(value))
+      switch r.Freq {
+      case RRULE_FREQ_HOURLY, RRULE_FREQ_DAILY, RRULE_FREQ_WEEKLY, RRULE_FREQ_MONTHLY, RRULE_FREQ_YEARLY:
+      default:
+        err = fmt.Errorf("unsupported FREQ %q", value)
+      }
+    case "INTERVAL":
+      r.Interval, err = strconv.Atoi(value)
+      if err == nil && r.Interval < 1 {
+        err = fmt.Errorf("INTERVAL must be positive")
+      }
+    case "COUNT":
+      r.Count, err = strconv.Atoi(value)
+      if err == nil && r.Count < 1 {
+        err = fmt.Errorf("COUNT must be positive")
+      }
+    case "UNTIL":
+      r.Until, r.UntilDate, err = ParseICalTime(value, loc)
+    case "BYDAY":
+      for _, v := range strings.Split(value, ",") {
+        day, derr := parseRRuleDay(v)
+        if derr != nil {
+          err = derr
+          break
+        }
+        r.ByDay = append(r.ByDay, day)
+      }
+    case "BYMONTHDAY":
+      r.ByMonthDay, err = parseRRuleInts(value, -31, 31)
+    case "BYMONTH":
+      var months []int
+      months, err = parseRRuleInts(value, 1, 12)
+      for _, m := range months {
+        r.ByMonth = append(r.ByMonth, time.Month(m))
+      }
+    case "WKST":
+      wd := slices.Index(rruleWeekdays, strings.ToUpper(value))
+      if wd < 0 {
+        err = fmt.Errorf("invalid WKST %q", value)
+      }
+      r.WeekStart = time.Weekday(wd)
+    default:
+      err = fmt.Errorf("unsupported rule part %s", key)
+    }
+
+    if err != nil {
+      return nil, NewInvalidRRuleError(s, err.Error())
+    }
+  }
+
+  switch {
+  case r.Freq == RRULE_FREQ_UNKNOWN:
+    return nil, NewInvalidRRuleError(s, "FREQ is required")
+  case r.Count > 0 && !r.Until.IsZero():
+    return nil, NewInvalidRRuleError(s, "COUNT and UNTIL can not both be set")
+  }
+
+  return r, nil
+}
+
+func parseRRuleDay(s string) (RRuleDay, error) {
+  s = strings.ToUpper(strings.TrimSpace(s))
+  if len(s) < 2 {
+    return RRuleDay{}, fmt.Errorf("invalid BYDAY %q", s)
+  }
+
+  wd := slices.Index(rruleWeekdays, s[len(s)-2:])
+  if wd < 0 {
+    return RRuleDay{}, fmt.Errorf("invalid BYDAY %q", s)
+  }
+
+  day := RRuleDay{Weekday: time.Weekday(wd)}
+  if n := s[:len(s)-2]; n != "" {
+    i, err := strconv.Atoi(strings.TrimPrefix(n, "+"))
+    if err != nil || i == 0 || i < -53 || i > 53 {
+      return RRuleDay{}, fmt.Errorf("invalid BYDAY %q", s)
+    }
+    day.N = i
+  }
+
+  return day, nil
+}
+
+func parseRRuleInts(s string, min, max int) ([]int, error) {
+  out := make([]int, 0)
+  for _, v := range strings.Split(s, ",") {
+    i, err := strconv.Atoi(strings.TrimPrefix(strings.TrimSpace(v), "+"))
+    if err != nil || i == 0 || i < min || i > max {
+      return nil, fmt.Errorf("invalid value %q", v)
+    }
+    out = append(out, i)
+  }
+
+  return out, nil
+}
+
+func (r *RRule) String() string {
+  parts := []string{"FREQ=" + r.Freq.String()}
+  if r.Interval > 1 {
+    parts = append(parts, fmt.Sprintf("INTERVAL=%d", r.Interval))
+  }
+
+  if len(r.ByMonth) > 0 {
+    months := make([]string, 0, len(r.ByMonth))
+    for _, m := range r.ByMonth {
+      months = append(months, strconv.Itoa(int(m)))
+    }
+    parts = append(parts, "BYMONTH=" + strings.Join(months, ","))
+  }
+
+  if len(r.ByMonthDay) > 0 {
+    days := make([]string, 0, len(r.ByMonthDay))
+    for _, d := range r.ByMonthDay {
+      days = append(days, strconv.Itoa(d))
+    }
+    parts = append(parts, "BYMONTHDAY=" + strings.Join(days, ","))
+  }
+
+  if len(r.ByDay) > 0 {
+    days := make([]string, 0, len(r.ByDay))
+    for _, d := range r.ByDay {
+      days = append(days, d.String())
+    }
+    parts = append(parts, "BYDAY=" + strings.Join(days, ","))
+  }
+
+  if r.Count > 0 {
+    parts = append(parts, fmt.Sprintf("COUNT=%d", r.Count))
+  }
+
+  if !r.Until.IsZero() {
+    parts = append(parts, "UNTIL=" + FormatICalTime(r.Until, r.UntilDate))
+  }
+
+  if r.WeekStart != time.Monday {
+    parts = append(parts, "WKST=" + rruleWeekdays[r.WeekStart])
+  }
+
+  return strings.Join(parts, ";")
+}
+
+// ParseICalTime parses an RFC 5545 DATE or DATE-TIME value, E.G., 20500101,
+// 20500101T100000 or 20500101T100000Z, returning whether it is a date. Values
+// without a zone are read in loc.
+func ParseICalTime(s string, loc *time.Location) (time.Time, bool, error) {
+  switch {
+  case len(s) == 8:
+    t, err := time.ParseInLocation("20060102", s, loc)
+    return t, true, err
+  case strings.HasSuffix(s, "Z"):
+    t, err := time.Parse("20060102T150405Z", s)
+    return t, false, err
+  }
+
+  t, err := time.ParseInLocation("20060102T150405", s, loc)
+  return t, false, err
+}
+
+// FormatICalTime writes t as an RFC 5545 DATE when date is set, else as a
+// UTC DATE-TIME.
+func FormatICalTime(t time.Time, date bool) string {
+  if date {
+    return t.Format("20060102")
+  }
+
+  return t.UTC().Format("20060102T150405Z")
+}
+
+// Recurrence is a timestamp repeating by an RRule, for recurrences org's
+// repeaters can not express such as "every 2nd Tuesday" or "weekdays only".
+// Start and End hold the first occurrence, and the location of Start is the
+// zone occurrences are computed in.
+type Recurrence struct {
+  Start    time.Time
+  End      time.Time
+  DateOnly bool
+  Rule     *RRule
+  // Occurrences starting at these instants, or on these days for date only
+  // recurrences, are left out. They still count towards Rule.Count.
+  ExDates  []time.Time
+}
+
+func NewRecurrence(start time.Time, rule *RRule, opts... NewTimestampOpt) *Recurrence {
+  ts := NewTimestamp(start, opts...)
+  return &Recurrence{Start: ts.Start, End: ts.End, DateOnly: ts.DateOnly, Rule: rule}
+}
+
+func (rc *Recurrence) Kind() TimestampKind {
+  return TIMESTAMP_KIND_RECURRENCE
+}
+
+// Returns true if an occurrence overlaps the window.
+func (rc *Recurrence) InWindow(start, end time.Time) bool {
+  for range rc.Occurrences(start, end) {
+    return true
+  }
+
+  return false
+}
+
+func (rc *Recurrence) Time() (int, int, int) {
+  return rc.first().Time()
+}
+
+func (rc *Recurrence) EndTime() (int, int, int) {
+  return rc.first().EndTime()
+}
+
+// Returns the recurrence in org syntax when it can be written as a repeater
+// or diary sexp, else its first occurrence. See Recurrence.Org.
+func (rc *Recurrence) String() string {
+  if tros, ok := rc.Org(); ok {
+    return tros.String()
+  }
+
+  return rc.first().String()
+}
+
+func (rc *Recurrence) Strings() []string {
+  return []string{rc.String()}
+}
+
+// Returns the first occurrence as a plain timestamp.
+func (rc *Recurrence) first() *Timestamp {
+  ts := NewTimestamp(rc.Start)
+  ts.End = rc.End
+  ts.IsRange = !rc.End.IsZero()
+  ts.DateOnly = rc.DateOnly
+
+  return ts
+}
+
+// Occurrences returns each occurrence overlapping the window [start, end),
+// in order. The first occurrence is always Start, as RFC 5545 counts DTSTART
+// as the first instance.
+func (rc *Recurrence) Occurrences(start, end time.Time) iter.Seq[*Timestamp] {
+  return func(yield func(*Timestamp) bool) {
+    for occ := range rc.all(end) {
+      if !occ.Start.Before(end) {
+        return
+      }
+
+      last := occ.Start
+      if occ.End.After(occ.Start) {
+        last = occ.End
+      }
+
+      if (last.After(start) || !occ.Start.Before(start)) && !yield(occ) {
+        return
+      }
+    }
+  }
+}
+
+// Yields every occurrence starting before end in order, ending early when the
+// rule's COUNT or UNTIL is reached, or when the rule stops matching any dates.
+func (rc *Recurrence) all(end time.Time) iter.Seq[*Timestamp] {
+  return func(yield func(*Timestamp) bool) {
+    span := time.Duration(0)
+    if rc.End.After(rc.Start) {
+      span = rc.End.Sub(rc.Start)
+    }
+
+    // emits the occurrence starting at t, returning false once iteration
+    // should stop
+    count := 0
+    emit := func(t time.Time) bool {
+      if rc.Rule != nil && !rc.Rule.Until.IsZero() && t.After(rc.untilTime()) {
+        return false
+      }
+
+      count++
+      if rc.Rule != nil && rc.Rule.Count > 0 && count > rc.Rule.Count {
+        return false
+      }
+
+      if rc.excluded(t) {
+        return true
+      }
+
+      occ := rc.first()
+      occ.Start = t
+      if span > 0 {
+        occ.End = t.Add(span)
+      }
+
+      return yield(occ)
+    }
+
+    if !emit(rc.Start) || rc.Rule == nil {
+      return
+    }
+
+    // the calendar repeats every 400 years, so a rule matching nothing over
+    // that many of its intervals never matches again
+    limit := rc.Start.AddDate(400*rc.Rule.Interval, 0, 0)
+    for period := 0; ; period = rc.nextPeriod(period) {
+      ps := rc.periodStart(period)
+      if !ps.Before(end) || ps.After(limit) {
+        return
+      }
+
+      dates := rc.periodDates(period)
+      if len(dates) == 0 {
+        continue
+      }
+      limit = ps.AddDate(400*rc.Rule.Interval, 0, 0)
+
+      for _, t := range dates {
+        if !t.After(rc.Start) {
+          continue
+        }
+
+        if !emit(t) {
+          return
+        }
+      }
+    }
+  }
+}
+
+func (rc *Recurrence) untilTime() time.Time {
+  u := rc.Rule.Until
+  if rc.Rule.UntilDate {
+    y, m, d := u.Date()
+    return time.Date(y, m, d, 23, 59, 59, 0, rc.Start.Location())
+  }
+
+  return u
+}
+
+func (rc *Recurrence) excluded(t time.Time) bool {
+  for _, ex := range rc.ExDates {
+    if rc.DateOnly {
+      ey, em, ed := ex.Date()
+      ty, tm, td := t.Date()
+      if ey == ty && em == tm && ed == td {
+        return true
+      }
+      continue
+    }
+
+    if ex.Equal(t) {
+      return true
+    }
+  }
+
+  return false
+}
+
+// Returns the midnight starting the nth period of the rule, counted from the
+// period holding Start, or for hourly rules the nth period's own time. No
+// date of the period is before it.
+func (rc *Recurrence) periodStart(n int) time.Time {
+  r := rc.Rule
+  y, m, d := rc.Start.Date()
+  step := n*r.Interval
+  day := func(y int, m time.Month, d int) time.Time {
+    return time.Date(y, m, d, 0, 0, 0, 0, rc.Start.Location())
+  }
+
+  switch r.Freq {
+  case RRULE_FREQ_HOURLY:
+    return rc.Start.Add(time.Duration(step)*time.Hour)
+  case RRULE_FREQ_WEEKLY:
+    return day(y, m, d - (int(rc.Start.Weekday()-r.WeekStart)+7)%7 + step*7)
+  case RRULE_FREQ_MONTHLY:
+    return day(y, m+time.Month(step), 1)
+  case RRULE_FREQ_YEARLY:
+    return day(y+step, 1, 1)
+  }
+
+  return day(y, m, d+step)
+}
+
+// Returns the period following the nth worth expanding. Hourly and daily
+// periods falling in months left out by BYMONTH are skipped.
+func (rc *Recurrence) nextPeriod(n int) int {
+  r := rc.Rule
+  ps := rc.periodStart(n)
+  if len(r.ByMonth) == 0 || slices.Contains(r.ByMonth, ps.Month()) || r.Freq != RRULE_FREQ_HOURLY && r.Freq != RRULE_FREQ_DAILY {
+    return n+1
+  }
+
+  next := time.Date(ps.Year(), ps.Month()+1, 1, 0, 0, 0, 0, ps.Location())
+  for !slices.Contains(r.ByMonth, next.Month()) {
+    next = next.AddDate(0, 1, 0)
+  }
+
+  // whole days between the two dates, regardless of daylight saving time
+  gap := int(time.Date(next.Year(), next.Month(), 1, 0, 0, 0, 0, time.UTC).Sub(
+    time.Date(ps.Year(), ps.Month(), ps.Day(), 0, 0, 0, 0, time.UTC)).Hours()/24)
+  if r.Freq == RRULE_FREQ_HOURLY {
+    gap = int(next.Sub(ps).Hours())
+  }
+
+  return n + max(1, gap/r.Interval)
+}
+
+// Returns the candidate dates of the nth period of the rule, counted from
+// the period holding Start, at Start's time of day and in order.
+func (rc *Recurrence) periodDates(n int) []time.Time {
+  r := rc.Rule
+  loc := rc.Start.Location()
+  y, m, d := rc.Start.Date()
+  h, min, s := rc.Start.Clock()
+  at := func(y int, m time.Month, d int) time.Time {
+    return time.Date(y, m, d, h, min, s, 0, loc)
+  }
+
+  out := make([]time.Time, 0)
+  step := n*r.Interval
+  ps := rc.periodStart(n)
+  switch r.Freq {
+  case RRULE_FREQ_HOURLY:
+    if r.matchesDay(ps, false) {
+      out = append(out, ps)
+    }
+  case RRULE_FREQ_DAILY:
+    t := at(y, m, d+step)
+    if r.matchesDay(t, false) {
+      out = append(out, t)
+    }
+  case RRULE_FREQ_WEEKLY:
+    if len(r.ByDay) == 0 {
+      if t := at(y, m, d+step*7); r.matchesDay(t, false) {
+        out = append(out, t)
+      }
+      return out
+    }
+
+    for i := 0; i < 7; i++ {
+      t := at(ps.Year(), ps.Month(), ps.Day()+i)
+      if r.matchesDay(t, false) {
+        out = append(out, t)
+      }
+    }
+  case RRULE_FREQ_MONTHLY:
+    first := time.Date(y, m+time.Month(step), 1, h, min, s, 0, loc)
+    out = r.monthDates(first, d, false)
+  case RRULE_FREQ_YEARLY:
+    year := y + step
+    if len(r.ByMonth) == 0 && len(r.ByMonthDay) == 0 && len(r.ByDay) > 0 {
+      return r.yearDates(at(year, 1, 1))
+    }
+
+    // BYMONTHDAY alone applies to every month of the year, and a rule with
+    // neither repeats Start's month
+    months := r.ByMonth
+    switch {
+    case len(months) > 0:
+    case len(r.ByMonthDay) > 0:
+      for month := time.January; month <= time.December; month++ {
+        months = append(months, month)
+      }
+    default:
+      months = []time.Month{m}
+    }
+
+    for _, month := range months {
+      out = append(out, r.monthDates(time.Date(year, month, 1, h, min, s, 0, loc), d, len(r.ByMonth) > 0)...)
+    }
+  }
+
+  slices.SortFunc(out, func(a, b time.Time) int {
+    return a.Compare(b)
+  })
+
+  return out
+}
+
+// Returns the dates within the month starting at first matched by the rule's
+// BYMONTHDAY and BYDAY parts, or day when the rule has neither.
+func (r *RRule) monthDates(first time.Time, day int, monthMatched bool) []time.Time {
+  out := make([]time.Time, 0)
+  if !monthMatched && len(r.ByMonth) > 0 && !slices.Contains(r.ByMonth, first.Month()) {
+    return out
+  }
+
+  last := first.AddDate(0, 1, -1).Day()
+  if len(r.ByMonthDay) == 0 && len(r.ByDay) == 0 {
+    if day <= last {
+      out = append(out, first.AddDate(0, 0, day-1))
+    }
+    return out
+  }
+
+  for i := 0; i < last; i++ {
+    t := first.AddDate(0, 0, i)
+    if r.matchesDay(t, true) {
+      out = append(out, t)
+    }
+  }
+
+  return out
+}
+
+// Returns the dates of the year starting at first matched by BYDAY, with
+// ordinals counted within the year.
+func (r *RRule) yearDates(first time.Time) []time.Time {
+  out := make([]time.Time, 0)
+  days := first.AddDate(1, 0, 0).Sub(first).Hours()/24
+  for i := 0; i < int(days+0.5); i++ {
+    t := first.AddDate(0, 0, i)
+    for _, bd := range r.ByDay {
+      if t.Weekday() == bd.Weekday && (bd.N == 0 || ordinalMatches(bd.N, t.YearDay(), int(days+0.5))) {
+        out = append(out, t)
+        break
+      }
+    }
+  }
+
+  return out
+}
+
+// Returns true if t is matched by the rule's BYMONTH, BYMONTHDAY and BYDAY
+// parts. Ordinal BYDAY entries are counted within t's month when monthly is
+// set, and ignored otherwise.
+func (r *RRule) matchesDay(t time.Time, monthly bool) bool {
+  if len(r.ByMonth) > 0 && !slices.Contains(r.ByMonth, t.Month()) {
+    return false
+  }
+
+  last := time.Date(t.Year(), t.Month()+1, 0, 0, 0, 0, 0, time.UTC).Day()
+  if len(r.ByMonthDay) > 0 {
+    found := false
+    for _, md := range r.ByMonthDay {
+      if md == t.Day() || md < 0 && last+md+1 == t.Day() {
+        found = true
+        break
+      }
+    }
+
+    if !found {
+      return false
+    }
+  }
+
+  if len(r.ByDay) == 0 {
+    return true
+  }
+
+  for _, bd := range r.ByDay {
+    if bd.Weekday != t.Weekday() {
+      continue
+    }
+
+    if bd.N == 0 || monthly && ordinalMatches(bd.N, t.Day(), last) {
+      return true
+    }
+  }
+
+  return false
+}
+
+// Returns true if the day, of a period holding days days, is the nth of its
+// weekday in the period, counting from the end for a negative n.
+func ordinalMatches(n, day, days int) bool {
+  if n > 0 {
+    return (day-1)/7+1 == n
+  }
+
+  return (days-day)/7+1 == -n
+}
+
+// Org returns the recurrence written in org syntax, if it can be: as a
+// timestamp with a repeater, E.G., <2050-01-04 Tue +2w>, or as a sexp
+// timestamp using diary-float or diary-date, E.G., <%%(diary-float t 2 2)>.
+// A sexp only holds when Start is itself matched by the rule, and unlike the
+// rule it also matches dates before Start. Recurrences with a COUNT, UNTIL,
+// or excluded dates, and rules without an equivalent, return false.
+func (rc *Recurrence) Org() (TimestampRangeOrSexp, bool) {
+  r := rc.Rule
+  if r == nil {
+    return rc.first(), true
+  }
+
+  if r.Count > 0 || !r.Until.IsZero() || len(rc.ExDates) > 0 {
+    return nil, false
+  }
+
+  if repeat, ok := rc.repeater(); ok {
+    ts := rc.first()
+    ts.Repeat = repeat
+    ts.RawCookie = repeat.String()
+    return ts, true
+  }
+
+  if r.Interval != 1 || r.Freq != RRULE_FREQ_MONTHLY && r.Freq != RRULE_FREQ_YEARLY {
+    return nil, false
+  }
+
+  if r.Freq == RRULE_FREQ_YEARLY && len(r.ByMonth) == 0 || !r.matchesDay(rc.Start, true) {
+    return nil, false
+  }
+
+  months := "t"
+  if len(r.ByMonth) > 0 {
+    ints := make([]int, 0, len(r.ByMonth))
+    for _, m := range r.ByMonth {
+      ints = append(ints, int(m))
+    }
+    months = sexpList(ints)
+  }
+
+  var expr string
+  switch {
+  case len(r.ByDay) == 1 && r.ByDay[0].N != 0 && len(r.ByMonthDay) == 0 && r.ByDay[0].N >= -5 && r.ByDay[0].N <= 5:
+    expr = fmt.Sprintf("(diary-float %s %d %d)", months, int(r.ByDay[0].Weekday), r.ByDay[0].N)
+  case len(r.ByDay) == 0 && len(r.ByMonthDay) > 0 && !slices.ContainsFunc(r.ByMonthDay, func(d int) bool { return d < 0 }):
+    expr = fmt.Sprintf("(diary-date %s %s t)", months, sexpList(r.ByMonthDay))
+  default:
+    return nil, false
+  }
+
+  sexp, err := ParseSexp(expr, DIARY_DATE_STYLE_AMERICAN)
+  if err != nil {
+    return nil, false
+  }
+
+  st := NewSexpTimestamp(sexp)
+  if !rc.DateOnly {
+    st.DateOnly = false
+    st.Start = rc.Start.Sub(midnightOf(rc.Start))
+    if !rc.End.IsZero() {
+      st.End = rc.End.Sub(midnightOf(rc.Start))
+    }
+  }
+
+  return st, true
+}
+
+// Returns the org repeater equivalent to the rule, when the rule only
+// repeats its start by a fixed interval.
+func (rc *Recurrence) repeater() (*Repeat, bool) {
+  r := rc.Rule
+  _, m, d := rc.Start.Date()
+  if len(r.ByMonth) > 1 || len(r.ByMonth) == 1 && (r.Freq != RRULE_FREQ_YEARLY || r.ByMonth[0] != m) {
+    return nil, false
+  }
+
+  if len(r.ByMonthDay) > 1 || len(r.ByMonthDay) == 1 && (r.Freq != RRULE_FREQ_MONTHLY && r.Freq != RRULE_FREQ_YEARLY || r.ByMonthDay[0] != d) {
+    return nil, false
+  }
+
+  if len(r.ByDay) > 1 || len(r.ByDay) == 1 && (r.Freq != RRULE_FREQ_WEEKLY || r.ByDay[0].Weekday != rc.Start.Weekday()) {
+    return nil, false
+  }
+
+  repeat := &Repeat{Kind: REPEAT_KIND_SHIFT, IntervalAmount: r.Interval}
+  switch r.Freq {
+  case RRULE_FREQ_HOURLY:
+    repeat.Interval = REPEAT_INTERVAL_HOUR
+  case RRULE_FREQ_DAILY:
+    repeat.Interval = REPEAT_INTERVAL_DAY
+  case RRULE_FREQ_WEEKLY:
+    repeat.Interval = REPEAT_INTERVAL_WEEK
+  case RRULE_FREQ_MONTHLY:
+    // RFC 5545 skips months without the day, as org's repeater does with
+    // RepeatConfig.FixedDate
+    repeat.Interval = REPEAT_INTERVAL_MONTH
+  case RRULE_FREQ_YEARLY:
+    repeat.Interval = REPEAT_INTERVAL_YEAR
+  default:
+    return nil, false
+  }
+
+  return repeat, true
+}
+
+func sexpList(ints []int) string {
+  if len(ints) == 1 {
+    return strconv.Itoa(ints[0])
+  }
+
+  strs := make([]string, 0, len(ints))
+  for _, i := range ints {
+    strs = append(strs, strconv.Itoa(i))
+  }
+
+  return "'(" + strings.Join(strs, " ") + ")"
+}
+
+func midnightOf(t time.Time) time.Time {
+  y, m, d := t.Date()
+  return time.Date(y, m, d, 0, 0, 0, 0, t.Location())
+}
+
+// SetRecurrence sets the heading's planning element of the given kind to the
+// recurrence. When the recurrence can be written as a timestamp with a
+// repeater, see Recurrence.Org, the planning holds that timestamp and any
+// RRULE and EXDATE properties are removed. Otherwise the planning holds the
+// first occurrence and the rule is kept in the RRULE and EXDATE properties,
+// to be read back with Node.Recurrence. Sexps are not used, as they match
+// dates before the first occurrence.
+func (n *Node) SetRecurrence(kind PlanningKind, rc *Recurrence) *Node {
+  tros, ok := rc.Org()
+  if _, isTs := tros.(*Timestamp); ok && isTs {
+    n.RemoveProperty(RRULE_PROPERTY)
+    n.RemoveProperty(EXDATE_PROPERTY)
+  } else {
+    tros = rc.first()
+    n.SetProperty(RRULE_PROPERTY, rc.Rule.String())
+    if len(rc.ExDates) > 0 {
+      strs := make([]string, 0, len(rc.ExDates))
+      for _, ex := range rc.ExDates {
+        strs = append(strs, FormatICalTime(ex, rc.DateOnly))
+      }
+      n.SetProperty(EXDATE_PROPERTY, strings.Join(strs, ","))
+    } else {
+      n.RemoveProperty(EXDATE_PROPERTY)
+    }
+  }
+
+  n.Heading.SetPlanning(&Planning{PlanningKind: kind, TimestampRangeOrSexp: tros})
+  return n
+}
+
+// Recurrence returns the recurrence stored by SetRecurrence: the node's own
+// RRULE and EXDATE properties applied to the first active timestamp of its
+// planning. Returns false if the node holds no RRULE.
+func (n *Node) Recurrence() (*Recurrence, bool, error) {
+  v, ok := n.Property(RRULE_PROPERTY)
+  if !ok || strings.TrimSpace(v) == "" {
+    return nil, false, nil
+  }
+
+  var start *Timestamp
+  if n.Heading != nil {
+    for _, p := range n.Heading.Planning {
+      if ts, isTs := p.TimestampRangeOrSexp.(*Timestamp); isTs && ts.Active && p.PlanningKind != PLANNING_CLOSED {
+        start = ts
+        break
+      }
+    }
+  }
+
+  if start == nil {
+    return nil, true, NewInvalidRRuleError(v, "heading holds no active timestamp to start the recurrence")
+  }
+
+  rule, err := ParseRRule(v, start.Start.Location())
+  if err != nil {
+    return nil, true, err
+  }
+
+  rc := &Recurrence{Start: start.Start, End: start.End, DateOnly: start.DateOnly, Rule: rule}
+  if ex, ok := n.Property(EXDATE_PROPERTY); ok {
+    for _, s := range strings.Split(ex, ",") {
+      if s = strings.TrimSpace(s); s == "" {
+        continue
+      }
+
+      t, _, err := ParseICalTime(s, start.Start.Location())
+      if err != nil {
+        return nil, true, NewInvalidRRuleError(ex, fmt.Sprintf("invalid EXDATE %q", s))
+      }
+      rc.ExDates = append(rc.ExDates, t)
+    }
+  }
+
+  return rc, true, nil
+}
+
+type InvalidRRuleError struct {
+  Rule   string
+  Reason string
+}
+
+func (ire InvalidRRuleError) Error() string {
+  return fmt.Sprintf("Invalid recurrence rule %q: %s", ire.Rule, ire.Reason)
+}
+
+func NewInvalidRRuleError(rule, reason string) *InvalidRRuleError {
+  return &InvalidRRuleError{Rule: rule, Reason: reason}
+}
@@ -0,0 +1,219 @@
+package org
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRecurrence(t *testing.T) {
+  at := func(m time.Month, d, h int) time.Time {
+    return time.Date(2050, m, d, h, 0, 0, 0, time.UTC)
+  }
+
+  dates := func(rc *Recurrence, start, end time.Time) []string {
+    out := make([]string, 0)
+    for occ := range rc.Occurrences(start, end) {
+      out = append(out, occ.Start.Format("2006-01-02"))
+    }
+    return out
+  }
+
+  tests := []struct {
+    rule  string
+    start time.Time
+    end   time.Time
+    want  []string
+    org   string
+  }{
+    {"FREQ=MONTHLY;BYDAY=2TU", at(1, 11, 10), at(4, 1, 0), []string{"2050-01-11", "2050-02-08", "2050-03-08"}, "<%%(diary-float t 2 2) 10:00>"},
+    {"RRULE:FREQ=WEEKLY;INTERVAL=2", at(1, 4, 0), at(2, 1, 0), []string{"2050-01-04", "2050-01-18"}, "<2050-01-04 Tue +2w>"},
+    {"FREQ=MONTHLY;BYMONTHDAY=-1;UNTIL=20500430", at(1, 31, 0), at(12, 1, 0), []string{"2050-01-31", "2050-02-28", "2050-03-31", "2050-04-30"}, ""},
+    {"FREQ=YEARLY;BYMONTH=5;BYDAY=2SU", at(5, 8, 0), at(5, 8, 0).AddDate(2, 0, 0), []string{"2050-05-08", "2051-05-14"}, "<%%(diary-float 5 0 2)>"},
+    {"FREQ=MONTHLY;BYMONTHDAY=1,15", at(1, 1, 0), at(2, 2, 0), []string{"2050-01-01", "2050-01-15", "2050-02-01"}, "<%%(diary-date t '(1 15) t)>"},
+    {"FREQ=DAILY;INTERVAL=3;COUNT=3", at(1, 1, 0), at(12, 1, 0), []string{"2050-01-01", "2050-01-04", "2050-01-07"}, ""},
+    {"FREQ=YEARLY;BYDAY=1MO", at(1, 3, 0), time.Date(2052, 1, 1, 0, 0, 0, 0, time.UTC), []string{"2050-01-03", "2051-01-02"}, ""},
+  }
+
+  for _, tt := range tests {
+    rule, err := ParseRRule(tt.rule, time.UTC)
+    if err != nil {
+      t.Errorf("ParseRRule(%q): %v", tt.rule, err)
+      continue
+    }
+
+    opts := []NewTimestampOpt{WithDateOnly()}
+    if tt.start.Hour() != 0 {
+      opts = []NewTimestampOpt{}
+    }
+
+    rc := NewRecurrence(tt.start, rule, opts...)
+    got := dates(rc, tt.start, tt.end)
+    if len(got) != len(tt.want) {
+      t.Errorf("%s: Occurrences() = %v, want %v", tt.rule, got, tt.want)
+      continue
+    }
+
+    for i := range got {
+      if got[i] != tt.want[i] {
+        t.Errorf("%s: Occurrences() = %v, want %v", tt.rule, got, tt.want)
+        break
+      }
+    }
+
+    tros, ok := rc.Org()
+    if tt.org == "" && ok {
+      t.Errorf("%s: Org() = %s, want no org equivalent", tt.rule, tros)
+    }
+
+    if tt.org != "" && (!ok || tros.String() != tt.org) {
+      t.Errorf("%s: Org() = %v, %v, want %s", tt.rule, tros, ok, tt.org)
+    }
+  }
+
+  for _, s := range []string{"FREQ=SECONDLY", "FREQ=DAILY;INTERVAL=0", "FREQ=DAILY;COUNT=2;UNTIL=20500101", "FREQ=WEEKLY;BYDAY=XX", "BYDAY=MO"} {
+    var invalid *InvalidRRuleError
+    if _, err := ParseRRule(s, time.UTC); !errors.As(err, &invalid) {
+      t.Errorf("ParseRRule(%q) error = %v, want an InvalidRRuleError", s, err)
+    }
+  }
+
+  rule, _ := ParseRRule("FREQ=MONTHLY;INTERVAL=2;BYDAY=-1FR;UNTIL=20501231T120000Z", time.UTC)
+  if got := rule.String(); got != "FREQ=MONTHLY;INTERVAL=2;BYDAY=-1FR;UNTIL=20501231T120000Z" {
+    t.Errorf("String() = %s", got)
+  }
+}
+
+func TestRecurrenceExpansion(t *testing.T) {
+  day := func(y int, m time.Month, d int) time.Time {
+    return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+  }
+
+  tests := []struct {
+    rule  string
+    start time.Time
+    from  time.Time
+    to    time.Time
+    want  []string
+  }{
+    {"FREQ=MONTHLY;BYMONTH=3,9", day(2050, 3, 15), day(2050, 1, 1), day(2051, 1, 1), []string{"2050-03-15", "2050-09-15"}},
+    {"FREQ=DAILY;BYMONTH=2;BYMONTHDAY=29", day(2048, 2, 29), day(2050, 1, 1), day(2058, 1, 1), []string{"2052-02-29", "2056-02-29"}},
+    {"FREQ=HOURLY;INTERVAL=5;BYMONTH=2;BYMONTHDAY=29", day(2048, 2, 29), day(2052, 2, 29), day(2052, 2, 29).Add(12*time.Hour), []string{"2052-02-29 01:00", "2052-02-29 06:00", "2052-02-29 11:00"}},
+    {"FREQ=DAILY;BYMONTH=2;BYMONTHDAY=30", day(2050, 1, 1), day(2050, 1, 1), day(2450, 1, 1), []string{"2050-01-01"}},
+    {"FREQ=YEARLY;BYMONTHDAY=1", day(2050, 1, 1), day(2050, 1, 1), day(2051, 1, 1), []string{
+      "2050-01-01", "2050-02-01", "2050-03-01", "2050-04-01", "2050-05-01", "2050-06-01",
+      "2050-07-01", "2050-08-01", "2050-09-01", "2050-10-01", "2050-11-01", "2050-12-01",
+    }},
+    // the examples of RFC 5545 section 3.3.10 for WKST
+    {"FREQ=WEEKLY;INTERVAL=2;COUNT=4;BYDAY=TU,SU;WKST=MO", day(1997, 8, 5), day(1997, 1, 1), day(1998, 1, 1), []string{"1997-08-05", "1997-08-10", "1997-08-19", "1997-08-24"}},
+    {"FREQ=WEEKLY;INTERVAL=2;COUNT=4;BYDAY=TU,SU;WKST=SU;", day(1997, 8, 5), day(1997, 1, 1), day(1998, 1, 1), []string{"1997-08-05", "1997-08-17", "1997-08-19", "1997-08-31"}},
+  }
+
+  for _, tt := range tests {
+    rule, err := ParseRRule(tt.rule, time.UTC)
+    if err != nil {
+      t.Errorf("ParseRRule(%q): %v", tt.rule, err)
+      continue
+    }
+
+    rc := NewRecurrence(tt.start, rule, WithDateOnly())
+    layout := "2006-01-02"
+    if rule.Freq == RRULE_FREQ_HOURLY {
+      rc = NewRecurrence(tt.start, rule)
+      layout = "2006-01-02 15:04"
+    }
+
+    got := make([]string, 0)
+    for occ := range rc.Occurrences(tt.from, tt.to) {
+      got = append(got, occ.Start.Format(layout))
+    }
+
+    if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+      t.Errorf("%s: Occurrences() = %v, want %v", tt.rule, got, tt.want)
+    }
+  }
+
+  rule, err := ParseRRule("FREQ=WEEKLY;WKST=su;", time.UTC)
+  if err != nil || rule.WeekStart != time.Sunday || rule.String() != "FREQ=WEEKLY;WKST=SU" {
+    t.Errorf("ParseRRule(WKST=su) = %v, %v", rule, err)
+  }
+}
+
+func TestSetRecurrence(t *testing.T) {
+  d := New()
+  d.AddHeading(1, "Standup")
+  n := d.NodeTree.Subtree[0].Node
+
+  rule, _ := ParseRRule("FREQ=WEEKLY;BYDAY=MO,TU,WE,TH,FR;COUNT=7", time.UTC)
+  start := time.Date(2050, 1, 3, 9, 0, 0, 0, time.UTC)
+  rc := NewRecurrence(start, rule, WithEnd(start.Add(30*time.Minute)))
+  rc.ExDates = []time.Time{start.AddDate(0, 0, 2)}
+
+  if _, ok := rc.Org(); ok {
+    t.Fatalf("weekday recurrence should have no org equivalent")
+  }
+
+  n.SetRecurrence(PLANNING_SCHEDULED, rc)
+  if v, _ := n.Property(RRULE_PROPERTY); v != "FREQ=WEEKLY;BYDAY=MO,TU,WE,TH,FR;COUNT=7" {
+    t.Errorf("RRULE = %q", v)
+  }
+
+  if v, _ := n.Property(EXDATE_PROPERTY); v != "20500105T090000Z" {
+    t.Errorf("EXDATE = %q", v)
+  }
+
+  if got := n.Heading.GetPlanning(PLANNING_SCHEDULED).String(); got != "SCHEDULED: <2050-01-03 Mon 09:00-09:30>" {
+    t.Errorf("planning = %s", got)
+  }
+
+  back, ok, err := n.Recurrence()
+  if !ok || err != nil {
+    t.Fatalf("Recurrence() = %v, %v", ok, err)
+  }
+
+  want := []int{3, 4, 6, 7, 10, 11}
+  got := make([]int, 0)
+  for occ := range back.Occurrences(start, start.AddDate(0, 1, 0)) {
+    got = append(got, occ.Start.Day())
+    if occ.End.Sub(occ.Start) != 30*time.Minute {
+      t.Errorf("occurrence %s lost its time range", occ)
+    }
+  }
+
+  if len(got) != len(want) {
+    t.Fatalf("Occurrences() days = %v, want %v", got, want)
+  }
+
+  for i := range want {
+    if got[i] != want[i] {
+      t.Fatalf("Occurrences() days = %v, want %v", got, want)
+    }
+  }
+
+  // a start the rule does not match has no sexp equivalent, and sexps are
+  // not written as they also match dates before the start
+  second, _ := ParseRRule("FREQ=MONTHLY;BYDAY=2TU", time.UTC)
+  if tros, ok := NewRecurrence(start, second).Org(); ok {
+    t.Errorf("Org() = %s, want no org equivalent for an unmatched start", tros)
+  }
+
+  n.SetRecurrence(PLANNING_SCHEDULED, NewRecurrence(time.Date(2050, 1, 11, 10, 0, 0, 0, time.UTC), second))
+  if v, _ := n.Property(RRULE_PROPERTY); v != "FREQ=MONTHLY;BYDAY=2TU" {
+    t.Errorf("RRULE = %q, want it kept for a sexp equivalent", v)
+  }
+
+  if got := n.Heading.GetPlanning(PLANNING_SCHEDULED).String(); got != "SCHEDULED: <2050-01-11 Tue 10:00>" {
+    t.Errorf("planning = %s", got)
+  }
+
+  simple, _ := ParseRRule("FREQ=WEEKLY", time.UTC)
+  n.SetRecurrence(PLANNING_SCHEDULED, NewRecurrence(start, simple))
+  if _, ok := n.Property(RRULE_PROPERTY); ok {
+    t.Errorf("RRULE should be removed once org can express the recurrence")
+  }
+
+  if got := n.Heading.GetPlanning(PLANNING_SCHEDULED).String(); got != "SCHEDULED: <2050-01-03 Mon 09:00 +1w>" {
+    t.Errorf("planning = %s", got)
+  }
+}
@@ -0,0 +1,709 @@
+package org
+
+import (
+	"fmt"
+	"iter"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Sexp is a diary s-expression, such as (diary-float t 4 2), as held by sexp
+// timestamps and diary sexp lines. Only the functions registered with
+// RegisterDiarySexp can be evaluated; the diary-anniversary, diary-block,
+// diary-cyclic, diary-date and diary-float functions are built in.
+type Sexp struct {
+  // The expression as written, including its parentheses.
+  Raw   string
+  Func  string
+  Args  []SexpArg
+  Style DiaryDateStyle
+
+  match func(time.Time) bool
+}
+
+// SexpArg is a single argument of a diary sexp: an integer, t, nil, a
+// quoted list of integers, a string, or a symbol.
+type SexpArg struct {
+  Raw  string
+  // Set for t, which diary-date and diary-float treat as matching any value.
+  True bool
+  Nil  bool
+  // The integer, or the members of a quoted list.
+  Ints []int
+  List bool
+  // The contents of a string argument, or the name of a symbol.
+  Str  string
+}
+
+// Returns the argument's value if it is a single integer.
+func (sa SexpArg) Int() (int, bool) {
+  if sa.List || len(sa.Ints) != 1 {
+    return 0, false
+  }
+
+  return sa.Ints[0], true
+}
+
+// Returns true if the argument is t, or an integer or list holding v.
+func (sa SexpArg) Matches(v int) bool {
+  if sa.True {
+    return true
+  }
+
+  for _, i := range sa.Ints {
+    if i == v {
+      return true
+    }
+  }
+
+  return false
+}
+
+// DiaryDateStyle is the order in which diary functions take a date's month,
+// day and year, as set by calendar-date-style in emacs.
+type DiaryDateStyle string
+
+const (
+  // month day year, emacs' default
+  DIARY_DATE_STYLE_AMERICAN DiaryDateStyle = "american"
+  // day month year
+  DIARY_DATE_STYLE_EUROPEAN DiaryDateStyle = "european"
+  // year month day
+  DIARY_DATE_STYLE_ISO      DiaryDateStyle = "iso"
+)
+
+// Returns the month, day and year of a date written as three arguments in
+// the given style.
+func (dds DiaryDateStyle) order(a, b, c SexpArg) (SexpArg, SexpArg, SexpArg) {
+  switch dds {
+  case DIARY_DATE_STYLE_EUROPEAN:
+    return b, a, c
+  case DIARY_DATE_STYLE_ISO:
+    return b, c, a
+  }
+
+  return a, b, c
+}
+
+// DiarySexpFunc compiles the arguments of a diary function into a function
+// reporting whether the diary entry occurs on a date.
+type DiarySexpFunc func(args []SexpArg, style DiaryDateStyle) (func(time.Time) bool, error)
+
+var (
+  diarySexpsMu sync.RWMutex
+  diarySexps = map[string]DiarySexpFunc{}
+)
+
+func init() {
+  RegisterDiarySexp("diary-anniversary", diaryAnniversary)
+  RegisterDiarySexp("diary-block", diaryBlock)
+  RegisterDiarySexp("diary-cyclic", diaryCyclic)
+  RegisterDiarySexp("diary-date", diaryDate)
+  RegisterDiarySexp("diary-float", diaryFloat)
+}
+
+// RegisterDiarySexp sets the function evaluated for sexps calling name,
+// replacing any function already registered with it.
+func RegisterDiarySexp(name string, fn DiarySexpFunc) {
+  diarySexpsMu.Lock()
+  defer diarySexpsMu.Unlock()
+
+  diarySexps[name] = fn
+}
+
+// Returns the function registered for sexps calling name.
+func LookupDiarySexp(name string) (DiarySexpFunc, bool) {
+  diarySexpsMu.RLock()
+  defer diarySexpsMu.RUnlock()
+
+  fn, ok := diarySexps[name]
+  return fn, ok
+}
+
+// ParseSexp parses a diary sexp such as "(diary-anniversary 10 31 1948)",
+// reading dates in the given style. Calls to functions which are not
+// registered return an UnknownDiarySexpError.
+func ParseSexp(s string, style DiaryDateStyle) (*Sexp, error) {
+  raw := strings.TrimSpace(s)
+  r := &sexpReader{src: raw}
+  fn, args, err := r.call()
+  if err != nil {
+    return nil, NewInvalidDiarySexpError(raw, err.Error())
+  }
+
+  r.skipSpace()
+  if r.pos < len(r.src) {
+    return nil, NewInvalidDiarySexpError(raw, fmt.Sprintf("unexpected %q after expression", r.src[r.pos:]))
+  }
+
+  compile, ok := LookupDiarySexp(fn)
+  if !ok {
+    return nil, NewUnknownDiarySexpError(fn)
+  }
+
+  if style == "" {
+    style = DIARY_DATE_STYLE_AMERICAN
+  }
+
+  match, err := compile(args, style)
+  if err != nil {
+    return nil, NewInvalidDiarySexpError(raw, err.Error())
+  }
+
+  return &Sexp{Raw: raw, Func: fn, Args: args, Style: style, match: match}, nil
+}
+
+// Returns true if the diary entry occurs on the day holding t.
+func (s *Sexp) Matches(t time.Time) bool {
+  return s.match != nil && s.match(t)
+}
+
+func (s *Sexp) String() string {
+  return s.Raw
+}
+
+// Reads the subset of emacs lisp used by diary sexps: a single call whose
+// arguments are atoms, strings and quoted lists.
+type sexpReader struct {
+  src string
+  pos int
+}
+
+func (r *sexpReader) call() (string, []SexpArg, error) {
+  r.skipSpace()
+  if !r.consume('(') {
+    return "", nil, fmt.Errorf("expected ( at column %d", r.pos)
+  }
+
+  r.skipSpace()
+  fn := r.atom()
+  if fn == "" {
+    return "", nil, fmt.Errorf("expected a function name at column %d", r.pos)
+  }
+
+  args := make([]SexpArg, 0)
+  for {
+    r.skipSpace()
+    if r.consume(')') {
+      return fn, args, nil
+    }
+
+    start := r.pos
+    arg, err := r.arg()
+    if err != nil {
+      return "", nil, err
+    }
+
+    arg.Raw = r.src[start:r.pos]
+    args = append(args, arg)
+  }
+}
+
+func (r *sexpReader) arg() (SexpArg, error) {
+  switch {
+  case r.pos >= len(r.src):
+    return SexpArg{}, fmt.Errorf("missing closing )")
+  case r.consume('\''):
+    if !r.consume('(') {
+      return SexpArg{Str: r.atom()}, nil
+    }
+
+    out := SexpArg{List: true, Ints: make([]int, 0)}
+    for {
+      r.skipSpace()
+      if r.consume(')') {
+        return out, nil
+      }
+
+      atom := r.atom()
+      i, err := strconv.Atoi(atom)
+      if err != nil {
+        return SexpArg{}, fmt.Errorf("expected an integer in list at column %d", r.pos-len(atom))
+      }
+      out.Ints = append(out.Ints, i)
+    }
+  case r.consume('"'):
+    start := r.pos
+    for r.pos < len(r.src) && r.src[r.pos] != '"' {
+      if r.src[r.pos] == '\\' {
+        r.pos++
+      }
+      r.pos++
+    }
+
+    if !r.consume('"') {
+      return SexpArg{}, fmt.Errorf("unterminated string at column %d", start-1)
+    }
+
+    return SexpArg{Str: r.src[start:r.pos-1]}, nil
+  case r.src[r.pos] == '(':
+    return SexpArg{}, fmt.Errorf("nested expressions are not supported at column %d", r.pos)
+  }
+
+  atom := r.atom()
+  switch atom {
+  case "":
+    return SexpArg{}, fmt.Errorf("unexpected %q at column %d", r.src[r.pos], r.pos)
+  case "t":
+    return SexpArg{True: true}, nil
+  case "nil":
+    return SexpArg{Nil: true}, nil
+  }
+
+  if i, err := strconv.Atoi(atom); err == nil {
+    return SexpArg{Ints: []int{i}}, nil
+  }
+
+  return SexpArg{Str: atom}, nil
+}
+
+func (r *sexpReader) atom() string {
+  start := r.pos
+  for r.pos < len(r.src) && strings.IndexByte(" \t()'\"", r.src[r.pos]) < 0 {
+    r.pos++
+  }
+
+  return r.src[start:r.pos]
+}
+
+func (r *sexpReader) consume(c byte) bool {
+  if r.pos < len(r.src) && r.src[r.pos] == c {
+    r.pos++
+    return true
+  }
+
+  return false
+}
+
+func (r *sexpReader) skipSpace() {
+  for r.pos < len(r.src) && (r.src[r.pos] == ' ' || r.src[r.pos] == '\t') {
+    r.pos++
+  }
+}
+
+// Checks the number of arguments passed to a diary function. Each function
+// accepts a trailing mark argument, which is ignored.
+func sexpArity(args []SexpArg, min, max int) error {
+  if len(args) < min || len(args) > max+1 {
+    return fmt.Errorf("expected %d to %d arguments, got %d", min, max, len(args))
+  }
+
+  return nil
+}
+
+// Returns the dates written as month, day and year arguments, in order.
+func sexpDates(args []SexpArg, style DiaryDateStyle) ([]time.Time, error) {
+  out := make([]time.Time, 0, len(args)/3)
+  for i := 0; i+2 < len(args); i += 3 {
+    m, d, y := style.order(args[i], args[i+1], args[i+2])
+    month, mok := m.Int()
+    day, dok := d.Int()
+    year, yok := y.Int()
+    if !mok || !dok || !yok {
+      return nil, fmt.Errorf("expected a date, got %s %s %s", args[i].Raw, args[i+1].Raw, args[i+2].Raw)
+    }
+
+    t := time.Date(year, time.Month(month), day, 0, 0, 0, 0, time.UTC)
+    if t.Month() != time.Month(month) || t.Day() != day {
+      return nil, fmt.Errorf("invalid date %s %s %s", args[i].Raw, args[i+1].Raw, args[i+2].Raw)
+    }
+
+    out = append(out, t)
+  }
+
+  return out, nil
+}
+
+// Returns the day holding t as midnight UTC, for comparison against dates
+// returned by sexpDates.
+func sexpDay(t time.Time) time.Time {
+  y, m, d := t.Date()
+  return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
+
+// (diary-anniversary MONTH DAY &optional YEAR): every year on MONTH DAY,
+// after YEAR if given. February 29th falls on March 1st in common years.
+func diaryAnniversary(args []SexpArg, style DiaryDateStyle) (func(time.Time) bool, error) {
+  if err := sexpArity(args, 2, 3); err != nil {
+    return nil, err
+  }
+
+  year := SexpArg{Ints: []int{0}}
+  if len(args) > 2 && !args[2].Nil && args[2].Str == "" {
+    year = args[2]
+  }
+
+  m, d, y := style.order(args[0], args[1], year)
+  if style == DIARY_DATE_STYLE_ISO && len(args) == 2 {
+    // iso style without a year reads MONTH DAY
+    m, d, y = args[0], args[1], year
+  }
+
+  month, mok := m.Int()
+  day, dok := d.Int()
+  since, yok := y.Int()
+  if !mok || !dok || !yok || month < 1 || month > 12 || day < 1 || day > 31 {
+    return nil, fmt.Errorf("expected a date")
+  }
+
+  return func(t time.Time) bool {
+    ty, tm, td := t.Date()
+    wm, wd := time.Month(month), day
+    if wm == time.February && wd == 29 && time.Date(ty, 2, 29, 0, 0, 0, 0, time.UTC).Day() != 29 {
+      wm, wd = time.March, 1
+    }
+
+    return tm == wm && td == wd && ty > since
+  }, nil
+}
+
+// (diary-block M1 D1 Y1 M2 D2 Y2): every day from the first date through the
+// second.
+func diaryBlock(args []SexpArg, style DiaryDateStyle) (func(time.Time) bool, error) {
+  if err := sexpArity(args, 6, 6); err != nil {
+    return nil, err
+  }
+
+  dates, err := sexpDates(args[:6], style)
+  if err != nil {
+    return nil, err
+  }
+
+  return func(t time.Time) bool {
+    day := sexpDay(t)
+    return !day.Before(dates[0]) && !day.After(dates[1])
+  }, nil
+}
+
+// (diary-cyclic N MONTH DAY YEAR): every N days, starting on the date.
+func diaryCyclic(args []SexpArg, style DiaryDateStyle) (func(time.Time) bool, error) {
+  if err := sexpArity(args, 4, 4); err != nil {
+    return nil, err
+  }
+
+  n, ok := args[0].Int()
+  if !ok || n < 1 {
+    return nil, fmt.Errorf("expected a positive number of days, got %s", args[0].Raw)
+  }
+
+  dates, err := sexpDates(args[1:4], style)
+  if err != nil {
+    return nil, err
+  }
+
+  return func(t time.Time) bool {
+    days := daysSince(dates[0], sexpDay(t))
+    return days >= 0 && days%n == 0
+  }, nil
+}
+
+// (diary-date MONTH DAY YEAR): each of MONTH, DAY and YEAR may be an
+// integer, a quoted list of integers, or t to match any value.
+func diaryDate(args []SexpArg, style DiaryDateStyle) (func(time.Time) bool, error) {
+  if err := sexpArity(args, 3, 3); err != nil {
+    return nil, err
+  }
+
+  m, d, y := style.order(args[0], args[1], args[2])
+  for _, a := range []SexpArg{m, d, y} {
+    if !a.True && len(a.Ints) == 0 {
+      return nil, fmt.Errorf("expected an integer, list or t, got %s", a.Raw)
+    }
+  }
+
+  return func(t time.Time) bool {
+    ty, tm, td := t.Date()
+    return m.Matches(int(tm)) && d.Matches(td) && y.Matches(ty)
+  }, nil
+}
+
+// (diary-float MONTH DAYNAME N &optional DAY): the Nth DAYNAME (0 for
+// Sunday) of MONTH, or the Nth from the end of the month when N is negative.
+// When DAY is given, the Nth DAYNAME on or after DAY, or on or before it for
+// a negative N. MONTH and DAYNAME may be lists, and MONTH may be t.
+func diaryFloat(args []SexpArg, style DiaryDateStyle) (func(time.Time) bool, error) {
+  if err := sexpArity(args, 3, 4); err != nil {
+    return nil, err
+  }
+
+  month, dayname := args[0], args[1]
+  if !month.True && len(month.Ints) == 0 {
+    return nil, fmt.Errorf("expected a month, list or t, got %s", month.Raw)
+  }
+
+  if len(dayname.Ints) == 0 {
+    return nil, fmt.Errorf("expected a day of the week, got %s", dayname.Raw)
+  }
+
+  n, ok := args[2].Int()
+  if !ok || n == 0 {
+    return nil, fmt.Errorf("expected a non-zero occurrence, got %s", args[2].Raw)
+  }
+
+  day := 0
+  if len(args) > 3 && len(args[3].Ints) > 0 {
+    if day, ok = args[3].Int(); !ok || day < 1 || day > 31 {
+      return nil, fmt.Errorf("expected a day of the month, got %s", args[3].Raw)
+    }
+  }
+
+  return func(t time.Time) bool {
+    ty, tm, td := t.Date()
+    wd := t.Weekday()
+    if !month.Matches(int(tm)) || !dayname.Matches(int(wd)) {
+      return false
+    }
+
+    return nthWeekday(ty, tm, wd, n, day) == td
+  }, nil
+}
+
+// Returns the day of the month of the nth weekday wd in the month, counted
+// from day (or the first of the month) for a positive n, or back from day
+// (or the last of the month) for a negative n. Returns 0 when the month holds
+// no such day.
+func nthWeekday(y int, m time.Month, wd time.Weekday, n, day int) int {
+  last := time.Date(y, m+1, 0, 0, 0, 0, 0, time.UTC).Day()
+  if n > 0 {
+    if day == 0 {
+      day = 1
+    }
+
+    first := time.Date(y, m, day, 0, 0, 0, 0, time.UTC)
+    out := day + (int(wd)-int(first.Weekday())+7)%7 + (n-1)*7
+    if out > last {
+      return 0
+    }
+
+    return out
+  }
+
+  if day == 0 || day > last {
+    day = last
+  }
+
+  from := time.Date(y, m, day, 0, 0, 0, 0, time.UTC)
+  out := day - (int(from.Weekday())-int(wd)+7)%7 + (n+1)*7
+  if out < 1 {
+    return 0
+  }
+
+  return out
+}
+
+func daysSince(a, b time.Time) int {
+  return int(b.Sub(a).Hours()/24)
+}
+
+// SexpTimestamp is a timestamp whose dates are given by a diary sexp, with an
+// optional time or time range, E.G.:
+//
+//     <%%(diary-float t 4 2)>
+//     <%%(diary-float t 4 2) 10:00-11:30>
+//
+// Sexp timestamps are always active.
+type SexpTimestamp struct {
+  Sexp     *Sexp
+  // The time of day of each occurrence, and of the end of each occurrence
+  // when the timestamp holds a time range, as offsets from midnight.
+  Start    time.Duration
+  End      time.Duration
+  DateOnly bool
+}
+
+// Creates a date only timestamp occurring on the dates given by s.
+func NewSexpTimestamp(s *Sexp) *SexpTimestamp {
+  return &SexpTimestamp{Sexp: s, DateOnly: true}
+}
+
+func (st *SexpTimestamp) Kind() TimestampKind {
+  return TIMESTAMP_KIND_SEXP
+}
+
+// Returns true if the timestamp has an occurrence starting within the window.
+func (st *SexpTimestamp) InWindow(start, end time.Time) bool {
+  for range st.Occurrences(start, end) {
+    return true
+  }
+
+  return false
+}
+
+// Occurrences returns each occurrence of the timestamp starting within
+// [start, end), in order. Days are taken in the location of start.
+func (st *SexpTimestamp) Occurrences(start, end time.Time) iter.Seq[*Timestamp] {
+  return func(yield func(*Timestamp) bool) {
+    y, m, d := start.Date()
+    for day := time.Date(y, m, d, 0, 0, 0, 0, start.Location()); day.Before(end); day = day.AddDate(0, 0, 1) {
+      if !st.Sexp.Matches(day) {
+        continue
+      }
+
+      occ := st.on(day)
+      if occ.Start.Before(start) {
+        continue
+      }
+
+      if !occ.Start.Before(end) || !yield(occ) {
+        return
+      }
+    }
+  }
+}
+
+// Returns the occurrence of the timestamp on the given day.
+func (st *SexpTimestamp) on(day time.Time) *Timestamp {
+  if st.DateOnly {
+    return NewTimestamp(day, WithDateOnly())
+  }
+
+  opts := make([]NewTimestampOpt, 0)
+  if st.End > 0 {
+    opts = append(opts, WithEnd(atOffset(day, st.End)))
+  }
+
+  return NewTimestamp(atOffset(day, st.Start), opts...)
+}
+
+func atOffset(day time.Time, d time.Duration) time.Time {
+  y, m, dd := day.Date()
+  h := int(d/time.Hour)
+  min := int(d%time.Hour/time.Minute)
+  return time.Date(y, m, dd, h, min, 0, 0, day.Location())
+}
+
+func (st *SexpTimestamp) Time() (int, int, int) {
+  if st.DateOnly {
+    return 0, 0, 0
+  }
+
+  return int(st.Start/time.Hour), int(st.Start%time.Hour/time.Minute), 0
+}
+
+func (st *SexpTimestamp) EndTime() (int, int, int) {
+  if st.DateOnly || st.End == 0 {
+    return 0, 0, 0
+  }
+
+  return int(st.End/time.Hour), int(st.End%time.Hour/time.Minute), 0
+}
+
+func (st *SexpTimestamp) String() string {
+  out := "<%%" + st.Sexp.Raw
+  if !st.DateOnly {
+    out += fmt.Sprintf(" %02d:%02d", int(st.Start/time.Hour), int(st.Start%time.Hour/time.Minute))
+    if st.End > 0 {
+      out += fmt.Sprintf("-%02d:%02d", int(st.End/time.Hour), int(st.End%time.Hour/time.Minute))
+    }
+  }
+
+  return out + ">"
+}
+
+func (st *SexpTimestamp) Strings() []string {
+  return []string{st.String()}
+}
+
+// DiarySexp is a line of a section starting with a diary sexp, E.G.:
+//
+//     %%(diary-anniversary 10 31 1948) Arthur's birthday
+//
+// The agenda shows Text, or the heading holding the line when Text is empty,
+// on each day the sexp matches.
+type DiarySexp struct {
+  Sexp *Sexp
+  Text string
+}
+
+func (ds DiarySexp) Kind() ElementKind {
+  return ELEMENT_DIARY_SEXP
+}
+
+func (ds DiarySexp) IsGreaterElement() bool {
+  return false
+}
+
+func (ds *DiarySexp) String() string {
+  return strings.TrimSpace("%%" + ds.Sexp.Raw + " " + ds.Text)
+}
+
+func (ds *DiarySexp) Strings() []string {
+  return []string{ds.String()}
+}
+
+// ParseDiarySexp parses a diary sexp line such as
+// "%%(diary-cyclic 14 1 3 2050) Payday".
+func ParseDiarySexp(line string, style DiaryDateStyle) (*DiarySexp, error) {
+  rest, ok := strings.CutPrefix(line, "%%")
+  if !ok {
+    return nil, NewInvalidDiarySexpError(line, "diary sexp lines must start with %%")
+  }
+
+  end := sexpEnd(rest)
+  if end < 0 {
+    return nil, NewInvalidDiarySexpError(line, "unbalanced parentheses")
+  }
+
+  s, err := ParseSexp(rest[:end], style)
+  if err != nil {
+    return nil, err
+  }
+
+  return &DiarySexp{Sexp: s, Text: strings.TrimSpace(rest[end:])}, nil
+}
+
+// Returns the length of the parenthesized expression s starts with, or -1 if
+// its parentheses are not balanced.
+func sexpEnd(s string) int {
+  depth := 0
+  inString := false
+  for i := 0; i < len(s); i++ {
+    switch c := s[i]; {
+    case inString && c == '\\':
+      i++
+    case c == '"':
+      inString = !inString
+    case inString:
+    case c == '(':
+      depth++
+    case c == ')':
+      depth--
+      if depth == 0 {
+        return i+1
+      }
+    }
+
+    if depth == 0 {
+      return -1
+    }
+  }
+
+  return -1
+}
+
+type UnknownDiarySexpError struct {
+  Func string
+}
+
+func (udse UnknownDiarySexpError) Error() string {
+  return fmt.Sprintf("Unknown diary sexp function %q, see RegisterDiarySexp", udse.Func)
+}
+
+func NewUnknownDiarySexpError(fn string) *UnknownDiarySexpError {
+  return &UnknownDiarySexpError{Func: fn}
+}
+
+type InvalidDiarySexpError struct {
+  Sexp   string
+  Reason string
+}
+
+func (idse InvalidDiarySexpError) Error() string {
+  return fmt.Sprintf("Invalid diary sexp %s: %s", idse.Sexp, idse.Reason)
+}
+
+func NewInvalidDiarySexpError(sexp, reason string) *InvalidDiarySexpError {
+  return &InvalidDiarySexpError{Sexp: sexp, Reason: reason}
+}
@@ -0,0 +1,113 @@
+package org
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestSexpTimestamp(t *testing.T) {
+  in := "<%%(diary-float t 4 2) 10:00-11:00>"
+  got, err := ParseTimestamp(in)
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  st, ok := got.(*SexpTimestamp)
+  if !ok {
+    t.Fatalf("ParseTimestamp(%q) = %T, want *SexpTimestamp", in, got)
+  }
+
+  if st.String() != in || st.Kind() != TIMESTAMP_KIND_SEXP {
+    t.Errorf("String() = %q, Kind() = %s", st.String(), st.Kind())
+  }
+
+  if h, m, _ := st.EndTime(); h != 11 || m != 0 {
+    t.Errorf("EndTime() = %d:%02d, want 11:00", h, m)
+  }
+
+  // the second thursday of each month
+  start := time.Date(2050, 1, 1, 0, 0, 0, 0, time.UTC)
+  want := []string{"2050-01-13 10:00", "2050-02-10 10:00", "2050-03-10 10:00"}
+  i := 0
+  for occ := range st.Occurrences(start, start.AddDate(0, 3, 0)) {
+    if i >= len(want) || occ.Start.Format("2006-01-02 15:04") != want[i] || occ.End.Hour() != 11 {
+      t.Errorf("occurrence %d = %s", i, occ)
+    }
+    i++
+  }
+
+  if i != len(want) {
+    t.Errorf("got %d occurrences, want %d", i, len(want))
+  }
+
+  if st.InWindow(start.AddDate(0, 0, 13), start.AddDate(0, 1, 0)) {
+    t.Errorf("InWindow() should be false between occurrences")
+  }
+}
+
+func TestDiarySexpFunctions(t *testing.T) {
+  day := func(y int, m time.Month, d int) time.Time {
+    return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+  }
+
+  tests := []struct {
+    sexp  string
+    style DiaryDateStyle
+    day   time.Time
+    want  bool
+  }{
+    {"(diary-anniversary 10 31 1948)", "", day(2050, 10, 31), true},
+    {"(diary-anniversary 10 31 1948)", "", day(1948, 10, 31), false},
+    {"(diary-anniversary 2 29 2048)", "", day(2050, 3, 1), true},
+    {"(diary-anniversary 2 29 2048)", "", day(2052, 2, 29), true},
+    {"(diary-anniversary 2 29 2048)", "", day(2052, 3, 1), false},
+    {"(diary-cyclic 14 1 3 2050)", "", day(2050, 1, 31), true},
+    {"(diary-cyclic 14 1 3 2050)", "", day(2050, 1, 10), false},
+    {"(diary-cyclic 14 1 3 2050)", "", day(2049, 12, 20), false},
+    {"(diary-block 3 1 2050 5 1 2050)", DIARY_DATE_STYLE_EUROPEAN, day(2050, 1, 5), true},
+    {"(diary-block 3 1 2050 5 1 2050)", DIARY_DATE_STYLE_EUROPEAN, day(2050, 1, 6), false},
+    {"(diary-block 2050 1 3 2050 1 5)", DIARY_DATE_STYLE_ISO, day(2050, 1, 3), true},
+    {"(diary-date t 15 '(2050 2051))", "", day(2051, 6, 15), true},
+    {"(diary-date t 15 '(2050 2051))", "", day(2052, 6, 15), false},
+    {"(diary-float t 5 -1)", "", day(2050, 1, 28), true},
+    {"(diary-float t 5 -1)", "", day(2050, 1, 21), false},
+    {"(diary-float '(1 7) 1 1 \"bold\")", "", day(2050, 1, 3), true},
+    {"(diary-float t 1 1 10)", "", day(2050, 1, 10), true},
+    {"(diary-float t 1 -1 9)", "", day(2050, 1, 3), true},
+  }
+
+  for _, tt := range tests {
+    s, err := ParseSexp(tt.sexp, tt.style)
+    if err != nil {
+      t.Errorf("ParseSexp(%q): %v", tt.sexp, err)
+      continue
+    }
+
+    if got := s.Matches(tt.day); got != tt.want {
+      t.Errorf("%s on %s = %v, want %v", tt.sexp, tt.day.Format(time.DateOnly), got, tt.want)
+    }
+  }
+
+  _, err := ParseTimestamp("<%%(diary-lunar-phases 1)>")
+  var unknown *UnknownDiarySexpError
+  if !errors.As(err, &unknown) || unknown.Func != "diary-lunar-phases" {
+    t.Errorf("unknown function error = %v", err)
+  }
+
+  for _, s := range []string{"(diary-cyclic 0 1 3 2050)", "(diary-block 1 3 2050)", "(diary-date 2 30 2050", "(diary-float t 4 0)"} {
+    var invalid *InvalidDiarySexpError
+    if _, err := ParseSexp(s, ""); !errors.As(err, &invalid) {
+      t.Errorf("ParseSexp(%q) error = %v, want an InvalidDiarySexpError", s, err)
+    }
+  }
+
+  ds, err := ParseDiarySexp("%%(diary-anniversary 10 31 1948) Arthur's birthday", "")
+  if err != nil || ds.Text != "Arthur's birthday" || ds.Sexp.Func != "diary-anniversary" {
+    t.Fatalf("ParseDiarySexp() = %v, %v", ds, err)
+  }
+
+  if ds.String() != "%%(diary-anniversary 10 31 1948) Arthur's birthday" {
+    t.Errorf("String() = %q", ds.String())
+  }
+}
@@ -0,0 +1,62 @@
+package org
+
+import "strings"
+
+// StartupSettings holds the options set with the #+STARTUP keyword which
+// affect how the document's data is modified, as opposed to how it is
+// displayed. Visibility and display options are ignored.
+type StartupSettings struct {
+  // Controls what is recorded when a heading enters a done state, set by the
+  // logdone, lognotedone and nologdone options.
+  LogDone TodoLogKind
+  // Controls what is recorded when a repeating task is marked done and
+  // shifted, set by the logrepeat, lognoterepeat and nologrepeat options.
+  // Org defaults to recording the time.
+  LogRepeat TodoLogKind
+}
+
+// Returns startup settings holding org's defaults.
+func NewStartupSettings() *StartupSettings {
+  return &StartupSettings{
+    LogDone: TODO_LOG_NONE,
+    LogRepeat: TODO_LOG_TIME,
+  }
+}
+
+// Add parses the value of a #+STARTUP keyword, applying each option it
+// recognizes. Unknown options are ignored, as org does. Multiple keywords are
+// combined by calling Add for each of them, with later options taking
+// precedence.
+func (ss *StartupSettings) Add(value string) *StartupSettings {
+  for _, opt := range strings.Fields(value) {
+    switch opt {
+    case "logdone":
+      ss.LogDone = TODO_LOG_TIME
+    case "lognotedone":
+      ss.LogDone = TODO_LOG_NOTE
+    case "nologdone":
+      ss.LogDone = TODO_LOG_NONE
+    case "logrepeat":
+      ss.LogRepeat = TODO_LOG_TIME
+    case "lognoterepeat":
+      ss.LogRepeat = TODO_LOG_NOTE
+    case "nologrepeat":
+      ss.LogRepeat = TODO_LOG_NONE
+    }
+  }
+
+  return ss
+}
+
+// TodoLogKind describes what is recorded for a todo state change.
+type TodoLogKind int
+
+const (
+  // nothing beyond the state change itself is recorded
+  TODO_LOG_NONE TodoLogKind = iota
+  // a timestamp is recorded, written as `!` in keyword definitions
+  TODO_LOG_TIME
+  // a timestamp and a note are recorded, written as `@` in keyword
+  // definitions
+  TODO_LOG_NOTE
+)
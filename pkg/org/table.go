@@ -0,0 +1,69 @@
+package org
+
+import (
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// matches cells org-table treats as numbers when deciding alignment
+var tableNumberRegexp = regexp.MustCompile(`^[<>]?[-+^.0-9]*[0-9][-+^.0-9eEdDx()%:]*$`)
+
+// Renders rows as an aligned org table. A nil row is rendered as a
+// horizontal rule. As with org-table-align, columns in which most non-empty
+// cells are numbers are right aligned.
+func alignTable(rows [][]string) []string {
+  cols := 0
+  for _, r := range rows {
+    cols = max(cols, len(r))
+  }
+
+  widths := make([]int, cols)
+  numeric := make([]int, cols)
+  filled := make([]int, cols)
+  for _, r := range rows {
+    for i, c := range r {
+      widths[i] = max(widths[i], utf8.RuneCountInString(c))
+      if c == "" {
+        continue
+      }
+
+      filled[i]++
+      if tableNumberRegexp.MatchString(c) {
+        numeric[i]++
+      }
+    }
+  }
+
+  out := make([]string, 0, len(rows))
+  for _, r := range rows {
+    if r == nil {
+      cells := make([]string, cols)
+      for i, w := range widths {
+        cells[i] = strings.Repeat("-", w+2)
+      }
+
+      out = append(out, "|"+strings.Join(cells, "+")+"|")
+      continue
+    }
+
+    cells := make([]string, cols)
+    for i := range widths {
+      c := ""
+      if i < len(r) {
+        c = r[i]
+      }
+
+      pad := strings.Repeat(" ", widths[i]-utf8.RuneCountInString(c))
+      if filled[i] > 0 && numeric[i]*2 > filled[i] {
+        cells[i] = " " + pad + c + " "
+      } else {
+        cells[i] = " " + c + pad + " "
+      }
+    }
+
+    out = append(out, "|"+strings.Join(cells, "|")+"|")
+  }
+
+  return out
+}
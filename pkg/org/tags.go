@@ -0,0 +1,521 @@
+package org
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/lcyvin/gorgeous/internal/util"
+)
+
+// TagInheritOpts mirrors the org-use-tag-inheritance and
+// org-tags-exclude-from-inheritance variables, controlling which tags set on
+// parent headings and by FILETAGS apply to the headings beneath them.
+type TagInheritOpts struct {
+  // When true, every tag is inherited save for those listed in NoInherit.
+  // This is the org default.
+  InheritAll bool
+  // When InheritAll is false, only the tags listed here are inherited.
+  Inherit []string
+  // Tags which are never inherited, regardless of the other settings.
+  NoInherit []string
+}
+
+// DefaultTagInheritOpts matches org's default of inheriting all tags.
+var DefaultTagInheritOpts TagInheritOpts = TagInheritOpts{
+  InheritAll: true,
+}
+
+// Returns true if tag is passed down to child headings under these options.
+func (tio TagInheritOpts) Inherits(tag string) bool {
+  if util.In(tag, tio.NoInherit) {
+    return false
+  }
+
+  return tio.InheritAll || util.In(tag, tio.Inherit)
+}
+
+// EffectiveTag is a single tag applying to a node, along with whether it was
+// set on the node's own heading or inherited from a parent or FILETAGS.
+type EffectiveTag struct {
+  Tag       string
+  Inherited bool
+}
+
+// Returns the names of the passed tags, preserving their order.
+func EffectiveTagNames(tags []EffectiveTag) []string {
+  out := make([]string, 0, len(tags))
+  for _, t := range tags {
+    out = append(out, t.Tag)
+  }
+
+  return out
+}
+
+// EffectiveTags returns every tag applying to the node: FILETAGS, followed by
+// the tags of each parent heading from the top level down, followed by the
+// node's own tags. Inherited tags are filtered by opts. Each tag appears once,
+// at the position of its first occurrence, and a tag set on the node's own
+// heading is always reported as local even if it is also inherited.
+func (n *Node) EffectiveTags(opts TagInheritOpts) []EffectiveTag {
+  out := make([]EffectiveTag, 0)
+  idx := make(map[string]int, 0)
+
+  for _, tag := range n.inheritedTags(opts) {
+    idx[tag] = len(out)
+    out = append(out, EffectiveTag{Tag: tag, Inherited: true})
+  }
+
+  for _, tag := range n.ownTags() {
+    if i, ok := idx[tag]; ok {
+      out[i].Inherited = false
+      continue
+    }
+
+    idx[tag] = len(out)
+    out = append(out, EffectiveTag{Tag: tag, Inherited: false})
+  }
+
+  return out
+}
+
+func (n *Node) ownTags() []string {
+  if n.Heading == nil {
+    return make([]string, 0)
+  }
+
+  return n.Heading.Tags
+}
+
+func (n *Node) inheritedTags(opts TagInheritOpts) []string {
+  candidates := make([]string, 0)
+  // the zero-th node holds no heading, and thus nothing to tag
+  if n.Heading == nil {
+    return candidates
+  }
+
+  if bs := n.bufferSettings(); bs != nil {
+    candidates = append(candidates, bs.FileTags...)
+  }
+
+  ancestors := make([][]string, 0)
+  for p := n.Parent(); p != nil; p = p.Parent() {
+    ancestors = append([][]string{p.ownTags()}, ancestors...)
+  }
+
+  for _, tags := range ancestors {
+    candidates = append(candidates, tags...)
+  }
+
+  out := make([]string, 0)
+  seen := make(map[string]struct{}, 0)
+  for _, tag := range candidates {
+    if _, ok := seen[tag]; ok || !opts.Inherits(tag) {
+      continue
+    }
+
+    seen[tag] = struct{}{}
+    out = append(out, tag)
+  }
+
+  return out
+}
+
+// TagRegistry holds the tags defined by one or more #+TAGS keywords, including
+// any fast-select keys, mutually exclusive groups, and group tags. Group tags
+// form a hierarchy where a query for the group tag also matches any of its
+// members, E.G., given:
+//
+//     #+TAGS: [ Project : p1 p2 {P@.+} ]
+//     #+TAGS: { @home(h) @work(w) }
+//
+// a match for `+Project` matches headings tagged p1, p2, or any tag matching
+// the regular expression P@.+, and a heading may only hold one of @home and
+// @work at a time.
+type TagRegistry struct {
+  // Every tag explicitly named in a definition, in order of appearance.
+  Tags    []*TagDefinition
+  // Groups in order of appearance. The same group tag may appear in multiple
+  // groups, in which case their members are combined.
+  Groups  []*TagGroup
+}
+
+// TagDefinition is a single tag from a #+TAGS keyword, E.G., `@home(h)`.
+type TagDefinition struct {
+  Name    string
+  // The fast-select key given in parentheses after the tag, if any.
+  FastKey string
+}
+
+// TagGroup is a bracketed or braced collection of tags within a #+TAGS keyword.
+type TagGroup struct {
+  // The group tag preceding the colon, E.G., "Project" in
+  // `[ Project : p1 p2 ]`. Empty for groups which only declare exclusivity.
+  Name      string
+  // True for groups enclosed in braces, where at most one member may be set
+  // on a heading at a time.
+  Exclusive bool
+  // Literal member tags.
+  Members   []string
+  // Members given as regular expressions, E.G., `{P@.+}`.
+  Patterns  []*regexp.Regexp
+}
+
+func NewTagRegistry() *TagRegistry {
+  return &TagRegistry{
+    Tags: make([]*TagDefinition, 0),
+    Groups: make([]*TagGroup, 0),
+  }
+}
+
+// Add parses the value of a #+TAGS keyword, adding its tags and groups to the
+// registry. Multiple keywords are combined by calling Add for each of them.
+// The registry is left unchanged when the value is invalid.
+func (tr *TagRegistry) Add(value string) (*TagRegistry, error) {
+  scratch := NewTagRegistry()
+  var group *TagGroup
+  closer := ""
+  seenColon := false
+
+  for _, tok := range tokenizeTags(value) {
+    switch tok {
+    case "{", "[":
+      if group != nil {
+        return nil, NewInvalidTagsDefinitionError(value, "nested group opened with "+tok)
+      }
+
+      group = &TagGroup{Exclusive: tok == "{"}
+      closer = map[string]string{"{": "}", "[": "]"}[tok]
+      seenColon = false
+      continue
+    case "}", "]":
+      if group == nil || tok != closer {
+        return nil, NewInvalidTagsDefinitionError(value, "unexpected "+tok)
+      }
+
+      scratch.Groups = append(scratch.Groups, group)
+      group = nil
+      continue
+    case ":":
+      if group == nil || seenColon || group.Name != "" || len(group.Members) != 1 {
+        return nil, NewInvalidTagsDefinitionError(value, "misplaced group separator")
+      }
+
+      group.Name = group.Members[0]
+      group.Members = group.Members[:0]
+      seenColon = true
+      continue
+    case `\n`:
+      continue
+    }
+
+    if isTagPattern(tok) {
+      if group == nil || !seenColon {
+        return nil, NewInvalidTagsDefinitionError(value, "regular expression "+tok+" outside of a group tag")
+      }
+
+      re, err := regexp.Compile(tok[1:len(tok)-1])
+      if err != nil {
+        return nil, NewInvalidTagsDefinitionError(value, err.Error())
+      }
+
+      group.Patterns = append(group.Patterns, re)
+      continue
+    }
+
+    def := parseTagDefinition(tok)
+    scratch.define(def)
+    if group != nil {
+      group.Members = append(group.Members, def.Name)
+    }
+  }
+
+  if group != nil {
+    return nil, NewInvalidTagsDefinitionError(value, "unterminated group")
+  }
+
+  for _, def := range scratch.Tags {
+    tr.define(def)
+  }
+  tr.Groups = append(tr.Groups, scratch.Groups...)
+
+  return tr, nil
+}
+
+func (tr *TagRegistry) define(def *TagDefinition) {
+  for _, t := range tr.Tags {
+    if t.Name == def.Name {
+      if t.FastKey == "" {
+        t.FastKey = def.FastKey
+      }
+      return
+    }
+  }
+
+  tr.Tags = append(tr.Tags, def)
+}
+
+// Returns the tag bound to the fast-select key k, or an empty string if no
+// tag uses the key.
+func (tr *TagRegistry) FastKeyTag(k string) string {
+  if tr == nil {
+    return ""
+  }
+
+  for _, t := range tr.Tags {
+    if t.FastKey == k {
+      return t.Name
+    }
+  }
+
+  return ""
+}
+
+// Returns true if tag is defined as a group tag.
+func (tr *TagRegistry) IsGroupTag(tag string) bool {
+  if tr == nil {
+    return false
+  }
+
+  for _, g := range tr.Groups {
+    if g.Name == tag {
+      return true
+    }
+  }
+
+  return false
+}
+
+// Expand returns the tag along with all literal members of the group it
+// names, recursively following nested group tags. Members defined by regular
+// expressions can not be enumerated, see Matches.
+func (tr *TagRegistry) Expand(tag string) []string {
+  out := []string{tag}
+  if tr == nil {
+    return out
+  }
+
+  seen := map[string]struct{}{tag: {}}
+
+  for i := 0; i < len(out); i++ {
+    for _, g := range tr.Groups {
+      if g.Name != out[i] {
+        continue
+      }
+
+      for _, m := range g.Members {
+        if _, ok := seen[m]; !ok {
+          seen[m] = struct{}{}
+          out = append(out, m)
+        }
+      }
+    }
+  }
+
+  return out
+}
+
+// Matches returns true if a heading tagged with tag satisfies a query for
+// query, either because they are equal or because tag is a member, literal or
+// by regular expression, of the group named by query or any of its subgroups.
+func (tr *TagRegistry) Matches(query, tag string) bool {
+  if tr == nil {
+    return query == tag
+  }
+
+  for _, name := range tr.Expand(query) {
+    if name == tag {
+      return true
+    }
+
+    for _, g := range tr.Groups {
+      if g.Name != name {
+        continue
+      }
+
+      for _, re := range g.Patterns {
+        if re.MatchString(tag) {
+          return true
+        }
+      }
+    }
+  }
+
+  return false
+}
+
+// Returns the tags which may not be set alongside tag, due to sharing a
+// mutually exclusive group with it.
+func (tr *TagRegistry) ExclusiveWith(tag string) []string {
+  out := make([]string, 0)
+  if tr == nil {
+    return out
+  }
+
+  for _, g := range tr.Groups {
+    if !g.Exclusive || !util.In(tag, g.Members) {
+      continue
+    }
+
+    for _, m := range g.Members {
+      if m != tag && !util.In(m, out) {
+        out = append(out, m)
+      }
+    }
+  }
+
+  return out
+}
+
+// Splits a #+TAGS value on whitespace, separating group delimiters which were
+// written against a tag name. A braced field is kept whole as a regular
+// expression only where one is allowed, following the colon of a group tag,
+// so that `{@work}` elsewhere is a single member exclusive group.
+func tokenizeTags(value string) []string {
+  out := make([]string, 0)
+  patterns := false
+  for _, field := range strings.Fields(value) {
+    if patterns && isTagPattern(field) {
+      out = append(out, field)
+      continue
+    }
+
+    start := len(out)
+
+    for len(field) > 1 && strings.ContainsAny(field[:1], "{[") {
+      out = append(out, field[:1])
+      field = field[1:]
+    }
+
+    trailing := make([]string, 0)
+    for len(field) > 1 && strings.ContainsAny(field[len(field)-1:], "}]") {
+      trailing = append([]string{field[len(field)-1:]}, trailing...)
+      field = field[:len(field)-1]
+    }
+
+    out = append(out, field)
+    out = append(out, trailing...)
+
+    for _, tok := range out[start:] {
+      switch tok {
+      case ":":
+        patterns = true
+      case "{", "[", "}", "]":
+        patterns = false
+      }
+    }
+  }
+
+  return out
+}
+
+func isTagPattern(tok string) bool {
+  return len(tok) > 2 && tok[0] == '{' && tok[len(tok)-1] == '}'
+}
+
+func parseTagDefinition(tok string) *TagDefinition {
+  def := &TagDefinition{Name: tok}
+  open := strings.LastIndex(tok, "(")
+  if open > 0 && strings.HasSuffix(tok, ")") {
+    def.Name = tok[:open]
+    def.FastKey = tok[open+1:len(tok)-1]
+  }
+
+  return def
+}
+
+// AddTag sets tag on the node's heading, removing any tags which share a
+// mutually exclusive group with it as defined by the document's tag registry.
+// Adding a tag which is already set is a no-op.
+func (n *Node) AddTag(tag string) error {
+  if n.Heading == nil {
+    return NilNodeHeadingError{}
+  }
+
+  excl := n.tagRegistry().ExclusiveWith(tag)
+  tags := make([]string, 0, len(n.Heading.Tags)+1)
+  for _, t := range n.Heading.Tags {
+    if t == tag || util.In(t, excl) {
+      continue
+    }
+
+    tags = append(tags, t)
+  }
+
+  n.Heading.Tags = append(tags, tag)
+  return nil
+}
+
+// RemoveTag removes tag from the node's heading if it is set.
+func (n *Node) RemoveTag(tag string) error {
+  if n.Heading == nil {
+    return NilNodeHeadingError{}
+  }
+
+  tags := make([]string, 0, len(n.Heading.Tags))
+  for _, t := range n.Heading.Tags {
+    if t != tag {
+      tags = append(tags, t)
+    }
+  }
+
+  n.Heading.Tags = tags
+  return nil
+}
+
+// SetTags replaces the tags on the node's heading, returning a
+// TagExclusionError without modifying the heading if two of the tags belong
+// to the same mutually exclusive group.
+func (n *Node) SetTags(tags []string) error {
+  if n.Heading == nil {
+    return NilNodeHeadingError{}
+  }
+
+  reg := n.tagRegistry()
+  for i, tag := range tags {
+    excl := reg.ExclusiveWith(tag)
+    for _, other := range tags[i+1:] {
+      if util.In(other, excl) {
+        return NewTagExclusionError(tag, other)
+      }
+    }
+  }
+
+  n.Heading.Tags = append(make([]string, 0, len(tags)), tags...)
+  return nil
+}
+
+func (n *Node) tagRegistry() *TagRegistry {
+  bs := n.bufferSettings()
+  if bs == nil {
+    return nil
+  }
+
+  return bs.Tags
+}
+
+type InvalidTagsDefinitionError struct {
+  Value  string
+  Reason string
+}
+
+func (itde InvalidTagsDefinitionError) Error() string {
+  return fmt.Sprintf("Invalid tags definition %q: %s", itde.Value, itde.Reason)
+}
+
+func NewInvalidTagsDefinitionError(v, r string) *InvalidTagsDefinitionError {
+  return &InvalidTagsDefinitionError{Value: v, Reason: r}
+}
+
+type TagExclusionError struct {
+  Tag   string
+  Other string
+}
+
+func (tee TagExclusionError) Error() string {
+  return fmt.Sprintf("Tags %s and %s belong to a mutually exclusive group", tee.Tag, tee.Other)
+}
+
+func NewTagExclusionError(tag, other string) *TagExclusionError {
+  return &TagExclusionError{Tag: tag, Other: other}
+}
@@ -0,0 +1,108 @@
+package org
+
+import "testing"
+
+func TestNodeEffectiveTags(t *testing.T) {
+  d := New()
+  d.BufferSettings.FileTags = []string{"file", "noinherit"}
+  d.AddHeading(1, "Parent", WithTags([]string{"work", "project"}))
+  d.AddHeading(2, "Child", WithTags([]string{"urgent", "work"}))
+
+  child := d.NodeTree.Subtree[0].Subtree[0].Node
+  opts := TagInheritOpts{InheritAll: true, NoInherit: []string{"noinherit", "project"}}
+
+  want := []EffectiveTag{
+    {"file", true},
+    {"work", false},
+    {"urgent", false},
+  }
+
+  for i := 0; i < 10; i++ {
+    got := child.EffectiveTags(opts)
+    if len(got) != len(want) {
+      t.Fatalf("EffectiveTags() = %v, want %v", got, want)
+    }
+
+    for j := range want {
+      if got[j] != want[j] {
+        t.Fatalf("EffectiveTags() = %v, want %v", got, want)
+      }
+    }
+  }
+
+  root := d.NodeTree.InheritTags(nil, nil, true)
+  if len(root) != 0 {
+    t.Errorf("InheritTags() on zero-th node = %v", root)
+  }
+}
+
+func TestTagRegistryGroups(t *testing.T) {
+  d := New()
+  reg := NewTagRegistry()
+  for _, def := range []string{"[ Project : p1 p2 {^P@.+} ]", "{ @home(h) @work(w) }", "[ p1 : sub1 ]"} {
+    if _, err := reg.Add(def); err != nil {
+      t.Fatalf("Add(%q) = %v", def, err)
+    }
+  }
+
+  d.BufferSettings.Tags = reg
+  d.AddHeading(1, "Task", WithTags([]string{"sub1"}))
+  d.AddHeading(1, "Other", WithTags([]string{"P@web"}))
+  task := d.NodeTree.Subtree[0].Node
+  other := d.NodeTree.Subtree[1].Node
+
+  m, err := ParseMatch("+Project-@home")
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  if !task.Matches(m) || !other.Matches(m) {
+    t.Errorf("+Project should match members of the Project group")
+  }
+
+  if reg.FastKeyTag("w") != "@work" {
+    t.Errorf("FastKeyTag(w) = %s", reg.FastKeyTag("w"))
+  }
+
+  task.AddTag("@home")
+  task.AddTag("@work")
+  if len(task.Heading.Tags) != 2 || task.Heading.Tags[1] != "@work" {
+    t.Errorf("AddTag should replace exclusive tags, got %v", task.Heading.Tags)
+  }
+
+  if task.Matches(m) == false {
+    t.Errorf("+Project-@home should match %v", task.Heading.Tags)
+  }
+
+  if err := task.SetTags([]string{"@home", "@work"}); err == nil {
+    t.Errorf("SetTags with exclusive tags should fail")
+  }
+
+  if _, err := NewTagRegistry().Add("{ @home"); err == nil {
+    t.Errorf("unterminated group should fail")
+  }
+}
+
+func TestTagRegistryAddIsAtomic(t *testing.T) {
+  reg := NewTagRegistry()
+  if _, err := reg.Add("{@work}"); err != nil {
+    t.Fatal(err)
+  }
+
+  if len(reg.Groups) != 1 || !reg.Groups[0].Exclusive || len(reg.Groups[0].Members) != 1 || reg.Groups[0].Members[0] != "@work" {
+    t.Errorf("{@work} should be a one member exclusive group, got %+v", reg.Groups)
+  }
+
+  if _, err := reg.Add("[ Project : p1 p2"); err == nil {
+    t.Fatalf("unterminated group should fail")
+  }
+
+  if len(reg.Tags) != 1 || len(reg.Groups) != 1 {
+    t.Errorf("failed Add changed the registry: %d tags, %d groups", len(reg.Tags), len(reg.Groups))
+  }
+
+  var none *TagRegistry
+  if none.FastKeyTag("w") != "" || none.IsGroupTag("Project") || len(none.Expand("Project")) != 1 {
+    t.Errorf("nil registry lookups should find nothing")
+  }
+}
@@ -2,6 +2,7 @@ package org
 
 import (
 	"fmt"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -11,7 +12,7 @@ import (
 // access basic scheduling information without the need to directly use the
 // time.Time values held by each Timestamp.
 //
-// For diary expressions (not yet implemented), the type
+// Diary sexp timestamps are held as a SexpTimestamp instead.
 //
 // In an org planning element, the timestamp object can represent a time range
 // in one of two ways:
@@ -87,15 +88,14 @@ func NewTimestampRange(start, end *Timestamp, opts... TimestampRangeOpt) (*Times
   return tr, nil
 }
 
+// Returns the range as org writes it, see TimestampRange.Format.
 func (tr *TimestampRange) String() string {
-  strs := tr.Strings()
-  out := strings.Join(strs, "--")
-
-  return out
+  return tr.Format()
 }
 
+// Returns the formatted start and end timestamps of the range.
 func (tr *TimestampRange) Strings() []string {
-  return append(tr.StartDate.Strings(), tr.EndDate.String())
+  return tr.formats(nil)
 }
 
 // Returns true if the timestamps held by TimestampRange represent a date/time
@@ -192,11 +192,14 @@ func WithEnd(e time.Time) NewTimestampOpt {
 func WithRepeat(r *Repeat) NewTimestampOpt {
   return func(t *Timestamp) {
     t.Repeat = r
-    rawCookieStr := "%s%d%s"
-    shiftStr := r.Kind.String()
-    amt := r.IntervalAmount
-    shiftInterval := r.Interval.String()
-    t.RawCookie = fmt.Sprintf(rawCookieStr, shiftStr, amt, shiftInterval)
+    t.RawCookie = r.String()
+  }
+}
+
+// Sets the warning or delay cookie of the timestamp, E.G., -3d.
+func WithDelay(d *Delay) NewTimestampOpt {
+  return func(t *Timestamp) {
+    t.Delay = d
   }
 }
 
@@ -219,25 +222,16 @@ type Timestamp struct {
   Active bool
   IsRange bool
   Repeat *Repeat
+  // Delay holds a warning or delay cookie such as -3d or --2d. On a DEADLINE
+  // it sets how early a warning is shown, on SCHEDULED how long the item is
+  // hidden for.
+  Delay *Delay
   RawCookie string
 }
 
+// Returns the timestamp as org writes it, see Timestamp.Format.
 func (t *Timestamp) String() string {
-  out := fmt.Sprintf("%d-%d-%d %s", t.Year(), t.Month(), t.Day(), t.Weekday())
-  if !t.DateOnly {
-    out += fmt.Sprintf(" %02d:%02d", t.Start.Hour(), t.Start.Minute())
-  }
-
-  if !t.DateOnly && !t.End.IsZero() {
-    out += fmt.Sprintf("-%02d:%02d", t.End.Hour(), t.End.Minute()) 
-  }
-
-  enclose := "<%s>"
-  if !t.Active {
-    enclose = "[%s]"
-  }
-
-  return fmt.Sprintf(enclose, out)
+  return t.Format()
 }
 
 func (t *Timestamp) Strings() []string {
@@ -385,12 +379,21 @@ type Repeat struct {
   // library has two modes, set by RelativeMonth.
   Interval RepeatIntervalKind
 
+  // For habits, the maximum interval written after a slash, E.G., the 3d in
+  // .+1d/3d. The habit is overdue once this much time has passed since it
+  // was last done. Zero when unset.
+  MaxIntervalAmount int
+  MaxInterval       RepeatIntervalKind
+
   // Sets the point at which an agenda item either appears in the agenda view.
   // Behaves different dependent on the kind of planning element it belongs to.
   //    - SCHEDULED: delays the appearance of the item in the agenda view by
   //      the duration set
   //    - DEADLINE: displays the warning ahead of the deadline by the duration
   //      amount. 
+  //
+  // Agenda generation uses the calendar-aware Timestamp.Delay, which holds
+  // the cookie as written.
   AgendaWindow time.Duration
 
   // Because of inconsistencies with month intervals, this is an internally
@@ -408,7 +411,96 @@ type Repeat struct {
 }
 
 func (r *Repeat) String() string {
-  return fmt.Sprintf("%s%d%s", r.Kind.String(), r.IntervalAmount, r.Interval.String())
+  out := fmt.Sprintf("%s%d%s", r.Kind.String(), r.IntervalAmount, r.Interval.String())
+  if r.MaxIntervalAmount > 0 {
+    out += fmt.Sprintf("/%d%s", r.MaxIntervalAmount, r.MaxInterval.String())
+  }
+
+  return out
+}
+
+// Delay is a warning or delay cookie, written after any repeat cookie in a
+// timestamp. On a DEADLINE, it sets how many days ahead of the deadline a
+// warning is shown, overriding org-deadline-warning-days. On SCHEDULED, it
+// hides the item from the agenda until the delay has passed.
+type Delay struct {
+  // DELAY_KIND_ALL ("-") applies to every repetition of a repeating
+  // timestamp, DELAY_KIND_FIRST ("--") only to the first.
+  Kind     DelayKind
+  Amount   int
+  Interval RepeatIntervalKind
+}
+
+// ParseDelay parses a warning or delay cookie such as "-3d" or "--2w".
+func ParseDelay(s string) (*Delay, error) {
+  d := &Delay{Kind: DELAY_KIND_ALL}
+  rest := s
+  switch {
+  case strings.HasPrefix(rest, string(DELAY_KIND_FIRST)):
+    d.Kind = DELAY_KIND_FIRST
+    rest = rest[2:]
+  case strings.HasPrefix(rest, string(DELAY_KIND_ALL)):
+    rest = rest[1:]
+  default:
+    return nil, NewInvalidCookieError(s)
+  }
+
+  if len(rest) < 2 {
+    return nil, NewInvalidCookieError(s)
+  }
+
+  amt, err := strconv.Atoi(rest[:len(rest)-1])
+  if err != nil || amt < 0 {
+    return nil, NewInvalidCookieError(s)
+  }
+
+  d.Amount = amt
+  d.Interval = RepeatIntervalKind(rest[len(rest)-1:])
+  switch d.Interval {
+  case REPEAT_INTERVAL_HOUR, REPEAT_INTERVAL_DAY, REPEAT_INTERVAL_WEEK, REPEAT_INTERVAL_MONTH, REPEAT_INTERVAL_YEAR:
+    return d, nil
+  }
+
+  return nil, NewInvalidCookieError(s)
+}
+
+func (d *Delay) String() string {
+  return fmt.Sprintf("%s%d%s", d.Kind.String(), d.Amount, d.Interval.String())
+}
+
+// Returns the number of whole days the delay spans when counted back from t,
+// accounting for the varying length of months and years.
+func (d *Delay) Days(t time.Time) int {
+  var from time.Time
+  switch d.Interval {
+  case REPEAT_INTERVAL_HOUR:
+    return d.Amount/24
+  case REPEAT_INTERVAL_DAY:
+    return d.Amount
+  case REPEAT_INTERVAL_WEEK:
+    return d.Amount*7
+  case REPEAT_INTERVAL_MONTH:
+    from = t.AddDate(0, -d.Amount, 0)
+  case REPEAT_INTERVAL_YEAR:
+    from = t.AddDate(-d.Amount, 0, 0)
+  default:
+    return 0
+  }
+
+  a := time.Date(from.Year(), from.Month(), from.Day(), 12, 0, 0, 0, time.UTC)
+  b := time.Date(t.Year(), t.Month(), t.Day(), 12, 0, 0, 0, time.UTC)
+  return int(b.Sub(a).Hours()/24)
+}
+
+type DelayKind string
+
+const (
+  DELAY_KIND_ALL   DelayKind = "-"
+  DELAY_KIND_FIRST DelayKind = "--"
+)
+
+func (dk DelayKind) String() string {
+  return string(dk)
 }
 
 type RepeatKind string
@@ -472,6 +564,18 @@ func NewNilStartTimeError() NilStartTimeError {
   return NilStartTimeError{}
 }
 
+type InvalidCookieError struct {
+  Cookie string
+}
+
+func (ice InvalidCookieError) Error() string {
+  return fmt.Sprintf("Invalid timestamp cookie: %s", ice.Cookie)
+}
+
+func NewInvalidCookieError(c string) *InvalidCookieError {
+  return &InvalidCookieError{Cookie: c}
+}
+
 type NilTimestampsError struct {}
 
 func (NilTimestampsError) Error() string {
@@ -0,0 +1,97 @@
+package org
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// DayNames holds the day names written into timestamps, indexed by
+// time.Weekday. Org writes whatever abbreviation the user's locale provides,
+// and ParseTimestamp accepts any of them.
+type DayNames [7]string
+
+var (
+  DAY_NAMES_EN DayNames = DayNames{"Sun", "Mon", "Tue", "Wed", "Thu", "Fri", "Sat"}
+  DAY_NAMES_DE DayNames = DayNames{"So", "Mo", "Di", "Mi", "Do", "Fr", "Sa"}
+  DAY_NAMES_FR DayNames = DayNames{"dim.", "lun.", "mar.", "mer.", "jeu.", "ven.", "sam."}
+  DAY_NAMES_ES DayNames = DayNames{"dom", "lun", "mar", "mié", "jue", "vie", "sáb"}
+)
+
+// TimestampFormatOpt configures the Format methods of Timestamp, RepeatStamp
+// and TimestampRange.
+type TimestampFormatOpt func(*timestampFormat)
+
+// Writes day names from names rather than DAY_NAMES_EN.
+func WithDayNames(names DayNames) TimestampFormatOpt {
+  return func(f *timestampFormat) {
+    f.days = names
+  }
+}
+
+type timestampFormat struct {
+  days DayNames
+}
+
+func newTimestampFormat(opts []TimestampFormatOpt) *timestampFormat {
+  f := &timestampFormat{days: DAY_NAMES_EN}
+  for _, opt := range opts {
+    opt(f)
+  }
+
+  return f
+}
+
+// Format returns the timestamp as org writes it, E.G.:
+//
+//     <2050-01-01 Sat 10:00-11:00 +1w -2d>
+//
+// The date and times are zero-padded, a time range is written only for
+// timestamps holding a time, and the repeater is written before the warning
+// or delay cookie.
+func (t *Timestamp) Format(opts... TimestampFormatOpt) string {
+  f := newTimestampFormat(opts)
+
+  var b strings.Builder
+  b.WriteString(t.Start.Format(time.DateOnly))
+  if name := f.days[t.Start.Weekday()]; name != "" {
+    b.WriteString(" " + name)
+  }
+
+  if !t.DateOnly {
+    fmt.Fprintf(&b, " %02d:%02d", t.Start.Hour(), t.Start.Minute())
+    if !t.End.IsZero() {
+      fmt.Fprintf(&b, "-%02d:%02d", t.End.Hour(), t.End.Minute())
+    }
+  }
+
+  if t.Repeat != nil {
+    b.WriteString(" " + t.Repeat.String())
+  }
+
+  if t.Delay != nil {
+    b.WriteString(" " + t.Delay.String())
+  }
+
+  if t.Active {
+    return "<" + b.String() + ">"
+  }
+
+  return "[" + b.String() + "]"
+}
+
+// Format returns the range as org writes it, E.G.:
+//
+//     <2050-01-01 Sat>--<2050-01-03 Mon>
+func (tr *TimestampRange) Format(opts... TimestampFormatOpt) string {
+  return strings.Join(tr.formats(opts), "--")
+}
+
+func (tr *TimestampRange) formats(opts []TimestampFormatOpt) []string {
+  out := []string{tr.StartDate.Format(opts...)}
+  if tr.EndDate != nil {
+    out = append(out, tr.EndDate.Format(opts...))
+  }
+
+  return out
+}
@@ -0,0 +1,52 @@
+package org
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTimestampFormat(t *testing.T) {
+  stamps := []string{
+    "<2050-01-01 Sat>",
+    "[2050-01-01 Sat 09:05]",
+    "<2050-01-01 Sat 10:00-11:00 +1w -2d>",
+    "<2050-03-09 Wed ++1m --3d>",
+    "<2050-01-01 Sat .+1d/3d>",
+    "<2050-01-01 Sat 10:00>--<2050-01-03 Mon 12:00>",
+    "[2050-12-31 Sat]--[2051-01-01 Sun]",
+  }
+
+  for _, s := range stamps {
+    got, err := ParseTimestamp(s, WithParseLocation(time.UTC))
+    if err != nil {
+      t.Errorf("ParseTimestamp(%q): %v", s, err)
+      continue
+    }
+
+    if got.String() != s {
+      t.Errorf("ParseTimestamp(%q).String() = %q", s, got.String())
+    }
+  }
+
+  ts := NewTimestamp(time.Date(2050, 1, 1, 8, 0, 0, 0, time.UTC), WithEnd(time.Date(2050, 1, 1, 9, 30, 0, 0, time.UTC)))
+  if got, want := ts.Format(WithDayNames(DAY_NAMES_DE)), "<2050-01-01 Sa 08:00-09:30>"; got != want {
+    t.Errorf("Format(DAY_NAMES_DE) = %q, want %q", got, want)
+  }
+
+  fr := ts.Format(WithDayNames(DAY_NAMES_FR))
+  back, err := ParseTimestamp(fr, WithParseLocation(time.UTC))
+  if err != nil || back.String() != ts.String() {
+    t.Errorf("ParseTimestamp(%q) = %v, %v, want %s", fr, back, err, ts)
+  }
+
+  repeat, _ := ParseRepeat("+2d")
+  rs := NewRepeatStamp(time.Date(2050, 1, 1, 0, 0, 0, 0, time.UTC), DefaultRepeatConfig, WithDateOnly(), WithInactive(), WithRepeat(repeat))
+  if got, want := rs.String(), "[2050-01-01 Sat +2d]"; got != want {
+    t.Errorf("RepeatStamp.String() = %q, want %q", got, want)
+  }
+
+  tr, _ := NewTimestampRange(NewTimestamp(ts.Start, WithDateOnly()), NewTimestamp(ts.Start.AddDate(0, 0, 2), WithDateOnly()))
+  if got := tr.Strings(); len(got) != 2 || got[0] != "<2050-01-01 Sat>" || got[1] != "<2050-01-03 Mon>" {
+    t.Errorf("TimestampRange.Strings() = %q", got)
+  }
+}
@@ -0,0 +1,454 @@
+package org
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TimestampParseOpt configures ParseTimestamp.
+type TimestampParseOpt func(*timestampParser)
+
+// Interprets parsed dates and times in loc. Defaults to time.Local.
+func WithParseLocation(loc *time.Location) TimestampParseOpt {
+  return func(p *timestampParser) {
+    p.loc = loc
+  }
+}
+
+// Reads the dates in diary sexps in the given style. Defaults to
+// DIARY_DATE_STYLE_AMERICAN.
+func WithParseDateStyle(style DiaryDateStyle) TimestampParseOpt {
+  return func(p *timestampParser) {
+    p.style = style
+  }
+}
+
+type timestampParser struct {
+  src   string
+  pos   int
+  loc   *time.Location
+  style DiaryDateStyle
+}
+
+// ParseTimestamp parses an org timestamp, returning a *Timestamp for a single
+// timestamp, a *TimestampRange for a date range, or a *SexpTimestamp for a
+// diary sexp. All of org's forms are accepted:
+//
+//     <2050-01-01 Sat>                       active, date only
+//     [2050-01-01 Sat 10:00]                 inactive, with a time
+//     <2050-01-01 Sat 10:00-11:30>           time range
+//     <2050-01-01 Sat>--<2050-01-03 Mon>     date range
+//     <2050-01-01 Sat 10:00 +1w -2d>         repeater and warning cookies
+//     <2050-01-01 Sat .+1d/3d>               habit repeater with a maximum
+//     <%%(diary-float t 4 2) 10:00>          diary sexp
+//
+// The day name is optional, and may be in any language; it is not checked
+// against the date. Errors are returned as *TimestampParseError, holding the
+// position of the offending input.
+func ParseTimestamp(s string, opts... TimestampParseOpt) (TimestampRangeOrSexp, error) {
+  p := &timestampParser{src: s, loc: time.Local, style: DIARY_DATE_STYLE_AMERICAN}
+  for _, opt := range opts {
+    opt(p)
+  }
+
+  p.skipSpace()
+  if strings.HasPrefix(p.src[p.pos:], "<%%(") {
+    st, err := p.sexpTimestamp()
+    if err != nil {
+      return nil, err
+    }
+
+    if err := p.end(); err != nil {
+      return nil, err
+    }
+    return st, nil
+  }
+
+  start, err := p.timestamp()
+  if err != nil {
+    return nil, err
+  }
+
+  if !strings.HasPrefix(p.src[p.pos:], "--") {
+    if err := p.end(); err != nil {
+      return nil, err
+    }
+    return start, nil
+  }
+
+  p.pos += 2
+  endPos := p.pos
+  end, err := p.timestamp()
+  if err != nil {
+    return nil, err
+  }
+
+  if err := p.end(); err != nil {
+    return nil, err
+  }
+
+  switch {
+  case end.Active != start.Active:
+    return nil, p.errorAt(endPos, "date range mixes active and inactive timestamps")
+  case end.Start.Before(start.Start):
+    return nil, p.errorAt(endPos, "date range ends before it starts")
+  }
+
+  return NewTimestampRange(start, end)
+}
+
+func (p *timestampParser) end() error {
+  p.skipSpace()
+  if p.pos < len(p.src) {
+    return p.errorAt(p.pos, fmt.Sprintf("unexpected %q after timestamp", p.src[p.pos:]))
+  }
+
+  return nil
+}
+
+// Parses a single bracketed timestamp starting at the current position.
+func (p *timestampParser) timestamp() (*Timestamp, error) {
+  var closing byte
+  switch p.peek() {
+  case '<':
+    closing = '>'
+  case '[':
+    closing = ']'
+  default:
+    return nil, p.errorAt(p.pos, "expected < or [")
+  }
+  p.pos++
+
+  date, err := p.date()
+  if err != nil {
+    return nil, err
+  }
+
+  opts := make([]NewTimestampOpt, 0)
+  if closing == ']' {
+    opts = append(opts, WithInactive())
+  }
+
+  start := date
+  hasTime := false
+  p.skipSpace()
+  if p.isDayName() {
+    for p.isDayName() {
+      p.pos++
+    }
+    p.skipSpace()
+  }
+
+  if isDigit(p.peek()) {
+    h, m, err := p.clock()
+    if err != nil {
+      return nil, err
+    }
+
+    hasTime = true
+    start = time.Date(date.Year(), date.Month(), date.Day(), h, m, 0, 0, p.loc)
+    if p.peek() == '-' && p.pos+1 < len(p.src) && isDigit(p.src[p.pos+1]) {
+      p.pos++
+      endPos := p.pos
+      eh, em, err := p.clock()
+      if err != nil {
+        return nil, err
+      }
+
+      end := time.Date(date.Year(), date.Month(), date.Day(), eh, em, 0, 0, p.loc)
+      if end.Before(start) {
+        return nil, p.errorAt(endPos, "time range ends before it starts")
+      }
+
+      opts = append(opts, WithEnd(end))
+    }
+  }
+
+  if !hasTime {
+    opts = append(opts, WithDateOnly())
+  }
+
+  var repeat *Repeat
+  var delay *Delay
+  for {
+    p.skipSpace()
+    if p.peek() == closing {
+      p.pos++
+      break
+    }
+
+    cookiePos := p.pos
+    cookie := p.word(closing)
+    switch {
+    case cookie == "":
+      if p.pos >= len(p.src) {
+        return nil, p.errorAt(p.pos, fmt.Sprintf("missing closing %q", closing))
+      }
+      return nil, p.errorAt(p.pos, fmt.Sprintf("unexpected %q", p.src[p.pos]))
+    case strings.HasPrefix(cookie, "-"):
+      if delay != nil {
+        return nil, p.errorAt(cookiePos, "timestamp holds more than one warning or delay cookie")
+      }
+
+      if delay, err = ParseDelay(cookie); err != nil {
+        return nil, p.errorAt(cookiePos, fmt.Sprintf("invalid warning or delay cookie %q", cookie))
+      }
+    case strings.HasPrefix(cookie, "+"), strings.HasPrefix(cookie, ".+"):
+      if repeat != nil {
+        return nil, p.errorAt(cookiePos, "timestamp holds more than one repeater")
+      }
+
+      if repeat, err = ParseRepeat(cookie); err != nil {
+        return nil, p.errorAt(cookiePos, fmt.Sprintf("invalid repeater %q", cookie))
+      }
+    default:
+      return nil, p.errorAt(cookiePos, fmt.Sprintf("unexpected %q", cookie))
+    }
+  }
+
+  if repeat != nil {
+    opts = append(opts, WithRepeat(repeat))
+  }
+
+  if delay != nil {
+    opts = append(opts, WithDelay(delay))
+  }
+
+  return NewTimestamp(start, opts...), nil
+}
+
+// Parses a <%%(sexp)> timestamp with an optional time or time range.
+func (p *timestampParser) sexpTimestamp() (*SexpTimestamp, error) {
+  p.pos += 3
+  end := sexpEnd(p.src[p.pos:])
+  if end < 0 {
+    return nil, p.errorAt(p.pos, "unbalanced parentheses in diary sexp")
+  }
+
+  sexp, err := ParseSexp(p.src[p.pos:p.pos+end], p.style)
+  if err != nil {
+    tpe := p.errorAt(p.pos, err.Error())
+    tpe.Err = err
+    return nil, tpe
+  }
+  p.pos += end
+
+  st := NewSexpTimestamp(sexp)
+  p.skipSpace()
+  if isDigit(p.peek()) {
+    h, m, err := p.clock()
+    if err != nil {
+      return nil, err
+    }
+
+    st.DateOnly = false
+    st.Start = time.Duration(h)*time.Hour + time.Duration(m)*time.Minute
+    if p.peek() == '-' {
+      p.pos++
+      endPos := p.pos
+      eh, em, err := p.clock()
+      if err != nil {
+        return nil, err
+      }
+
+      st.End = time.Duration(eh)*time.Hour + time.Duration(em)*time.Minute
+      if st.End < st.Start {
+        return nil, p.errorAt(endPos, "time range ends before it starts")
+      }
+    }
+  }
+
+  p.skipSpace()
+  if p.peek() != '>' {
+    if p.pos >= len(p.src) {
+      return nil, p.errorAt(p.pos, "missing closing '>'")
+    }
+    return nil, p.errorAt(p.pos, fmt.Sprintf("unexpected %q in sexp timestamp", p.src[p.pos]))
+  }
+  p.pos++
+
+  return st, nil
+}
+
+// Parses a YYYY-MM-DD date.
+func (p *timestampParser) date() (time.Time, error) {
+  startPos := p.pos
+  if p.pos+10 > len(p.src) {
+    return time.Time{}, p.errorAt(p.pos, "expected a date of the form YYYY-MM-DD")
+  }
+
+  raw := p.src[p.pos:p.pos+10]
+  for i := 0; i < len(raw); i++ {
+    ok := isDigit(raw[i])
+    if i == 4 || i == 7 {
+      ok = raw[i] == '-'
+    }
+
+    if !ok {
+      return time.Time{}, p.errorAt(p.pos+i, "expected a date of the form YYYY-MM-DD")
+    }
+  }
+
+  y, _ := strconv.Atoi(raw[:4])
+  m, _ := strconv.Atoi(raw[5:7])
+  d, _ := strconv.Atoi(raw[8:])
+  if m < 1 || m > 12 {
+    return time.Time{}, p.errorAt(startPos+5, fmt.Sprintf("month %02d is out of range", m))
+  }
+
+  t := time.Date(y, time.Month(m), d, 0, 0, 0, 0, p.loc)
+  if d < 1 || t.Month() != time.Month(m) {
+    return time.Time{}, p.errorAt(startPos+8, fmt.Sprintf("day %02d is out of range for %04d-%02d", d, y, m))
+  }
+
+  p.pos += 10
+  return t, nil
+}
+
+// Parses a H:MM or HH:MM time of day.
+func (p *timestampParser) clock() (int, int, error) {
+  startPos := p.pos
+  digits := 0
+  for isDigit(p.peek()) && digits < 2 {
+    p.pos++
+    digits++
+  }
+
+  if digits == 0 || p.peek() != ':' || p.pos+3 > len(p.src) || !isDigit(p.src[p.pos+1]) || !isDigit(p.src[p.pos+2]) {
+    return 0, 0, p.errorAt(startPos, "expected a time of the form HH:MM")
+  }
+
+  h, _ := strconv.Atoi(p.src[startPos:p.pos])
+  m, _ := strconv.Atoi(p.src[p.pos+1:p.pos+3])
+  if h > 24 || m > 59 || h == 24 && m > 0 {
+    return 0, 0, p.errorAt(startPos, fmt.Sprintf("time %s is out of range", p.src[startPos:p.pos+3]))
+  }
+
+  p.pos += 3
+  return h, m, nil
+}
+
+// Returns true if the current character may be part of a day name: anything
+// other than digits, whitespace, signs, and the closing brackets, as org
+// allows localized names.
+func (p *timestampParser) isDayName() bool {
+  c := p.peek()
+  if c == '.' {
+    // the start of a .+ repeater rather than an abbreviation
+    return p.pos+1 < len(p.src) && p.src[p.pos+1] != '+'
+  }
+
+  return c != 0 && !isDigit(c) && strings.IndexByte(" \t+-]>\n", c) < 0
+}
+
+// Reads up to the next space or closing bracket.
+func (p *timestampParser) word(closing byte) string {
+  start := p.pos
+  for p.pos < len(p.src) && p.src[p.pos] != ' ' && p.src[p.pos] != closing {
+    p.pos++
+  }
+
+  return p.src[start:p.pos]
+}
+
+func (p *timestampParser) peek() byte {
+  if p.pos >= len(p.src) {
+    return 0
+  }
+
+  return p.src[p.pos]
+}
+
+func (p *timestampParser) skipSpace() {
+  for p.pos < len(p.src) && (p.src[p.pos] == ' ' || p.src[p.pos] == '\t') {
+    p.pos++
+  }
+}
+
+func (p *timestampParser) errorAt(pos int, reason string) *TimestampParseError {
+  return NewTimestampParseError(p.src, pos, reason)
+}
+
+func isDigit(c byte) bool {
+  return c >= '0' && c <= '9'
+}
+
+// ParseRepeat parses a repeater cookie such as "+1w", "++2d", ".+1m", or a
+// habit repeater with a maximum interval such as ".+1d/3d".
+func ParseRepeat(s string) (*Repeat, error) {
+  r := &Repeat{}
+  rest := s
+  for _, k := range []RepeatKind{REPEAT_KIND_SHIFT_FUTURE_FIXED, REPEAT_KIND_SHIFT_FUTURE_RELATIVE, REPEAT_KIND_SHIFT} {
+    if strings.HasPrefix(rest, k.String()) {
+      r.Kind = k
+      rest = rest[len(k):]
+      break
+    }
+  }
+
+  if r.Kind == REPEAT_KIND_UNKNOWN {
+    return nil, NewInvalidCookieError(s)
+  }
+
+  interval, max, hasMax := strings.Cut(rest, "/")
+  amt, kind, ok := parseRepeatInterval(interval)
+  if !ok {
+    return nil, NewInvalidCookieError(s)
+  }
+  r.IntervalAmount = amt
+  r.Interval = kind
+
+  if hasMax {
+    amt, kind, ok := parseRepeatInterval(max)
+    if !ok {
+      return nil, NewInvalidCookieError(s)
+    }
+    r.MaxIntervalAmount = amt
+    r.MaxInterval = kind
+  }
+
+  return r, nil
+}
+
+func parseRepeatInterval(s string) (int, RepeatIntervalKind, bool) {
+  if len(s) < 2 {
+    return 0, REPEAT_INTERVAL_UNKNOWN, false
+  }
+
+  amt, err := strconv.Atoi(s[:len(s)-1])
+  if err != nil || amt < 0 || !isDigit(s[0]) {
+    return 0, REPEAT_INTERVAL_UNKNOWN, false
+  }
+
+  kind := RepeatIntervalKind(s[len(s)-1:])
+  switch kind {
+  case REPEAT_INTERVAL_HOUR, REPEAT_INTERVAL_DAY, REPEAT_INTERVAL_WEEK, REPEAT_INTERVAL_MONTH, REPEAT_INTERVAL_YEAR:
+    return amt, kind, true
+  }
+
+  return 0, REPEAT_INTERVAL_UNKNOWN, false
+}
+
+// TimestampParseError reports invalid timestamp input. Column is the
+// zero-based byte offset of the offending input. Err holds the underlying
+// error, if any, E.G., an UnknownDiarySexpError.
+type TimestampParseError struct {
+  Input  string
+  Column int
+  Reason string
+  Err    error
+}
+
+func (tpe TimestampParseError) Error() string {
+  return fmt.Sprintf("Invalid timestamp %q at column %d: %s", tpe.Input, tpe.Column, tpe.Reason)
+}
+
+func (tpe TimestampParseError) Unwrap() error {
+  return tpe.Err
+}
+
+func NewTimestampParseError(input string, col int, reason string) *TimestampParseError {
+  return &TimestampParseError{Input: input, Column: col, Reason: reason}
+}
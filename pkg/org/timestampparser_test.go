@@ -0,0 +1,111 @@
+package org
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestParseTimestamp(t *testing.T) {
+  at := func(y int, m time.Month, d, h, min int) time.Time {
+    return time.Date(y, m, d, h, min, 0, 0, time.UTC)
+  }
+
+  tests := []struct {
+    in       string
+    start    time.Time
+    end      time.Time
+    active   bool
+    dateOnly bool
+    repeat   string
+    delay    string
+  }{
+    {"<2050-01-01 Sat>", at(2050, 1, 1, 0, 0), time.Time{}, true, true, "", ""},
+    {"[2050-01-01 Sat 10:00]", at(2050, 1, 1, 10, 0), time.Time{}, false, false, "", ""},
+    {"<2050-01-01 9:05-11:30>", at(2050, 1, 1, 9, 5), at(2050, 1, 1, 11, 30), true, false, "", ""},
+    {"<2050-01-01 Sa. 10:00 +1w -2d>", at(2050, 1, 1, 10, 0), time.Time{}, true, false, "+1w", "-2d"},
+    {"<2050-01-01 sáb ++1m --3d>", at(2050, 1, 1, 0, 0), time.Time{}, true, true, "++1m", "--3d"},
+    {"<2050-01-01 .+1d/3d>", at(2050, 1, 1, 0, 0), time.Time{}, true, true, ".+1d/3d", ""},
+    {"<2050-01-01 Sat 10:00 +2h>", at(2050, 1, 1, 10, 0), time.Time{}, true, false, "+2h", ""},
+  }
+
+  for _, tt := range tests {
+    got, err := ParseTimestamp(tt.in, WithParseLocation(time.UTC))
+    if err != nil {
+      t.Errorf("ParseTimestamp(%q): %v", tt.in, err)
+      continue
+    }
+
+    ts, ok := got.(*Timestamp)
+    if !ok {
+      t.Errorf("ParseTimestamp(%q) = %T, want *Timestamp", tt.in, got)
+      continue
+    }
+
+    if !ts.Start.Equal(tt.start) || !tt.end.IsZero() && !ts.End.Equal(tt.end) {
+      t.Errorf("ParseTimestamp(%q) = %v-%v, want %v-%v", tt.in, ts.Start, ts.End, tt.start, tt.end)
+    }
+
+    if ts.Active != tt.active || ts.DateOnly != tt.dateOnly {
+      t.Errorf("ParseTimestamp(%q) active %v date only %v", tt.in, ts.Active, ts.DateOnly)
+    }
+
+    repeat := ""
+    if ts.Repeat != nil {
+      repeat = ts.Repeat.String()
+    }
+
+    delay := ""
+    if ts.Delay != nil {
+      delay = ts.Delay.String()
+    }
+
+    if repeat != tt.repeat || delay != tt.delay {
+      t.Errorf("ParseTimestamp(%q) cookies %q %q, want %q %q", tt.in, repeat, delay, tt.repeat, tt.delay)
+    }
+  }
+
+  got, err := ParseTimestamp("[2050-01-01 Sat 22:00]--[2050-01-03 Mon 01:00]", WithParseLocation(time.UTC))
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  tr, ok := got.(*TimestampRange)
+  if !ok {
+    t.Fatalf("date range parsed as %T", got)
+  }
+
+  if !tr.StartDate.Start.Equal(at(2050, 1, 1, 22, 0)) || !tr.EndDate.Start.Equal(at(2050, 1, 3, 1, 0)) || tr.StartDate.Active {
+    t.Errorf("date range = %v--%v", tr.StartDate.Start, tr.EndDate.Start)
+  }
+
+  errs := []struct {
+    in     string
+    column int
+  }{
+    {"2050-01-01 Sat", 0},
+    {"<2050-13-01 Sat>", 6},
+    {"<2050-02-30>", 9},
+    {"<2050-01-01 Sat 25:00>", 16},
+    {"<2050-01-01 Sat 10:00-09:00>", 22},
+    {"<2050-01-01 Sat", 15},
+    {"<2050-01-01 Sat +1w +2d>", 20},
+    {"<2050-01-01 Sat +1q>", 16},
+    {"<2050-01-01 Sat>--[2050-01-02 Sun]", 18},
+    {"<2050-01-02 Sun>--<2050-01-01 Sat>", 18},
+    {"<2050-01-01 Sat> trailing", 17},
+  }
+
+  for _, tt := range errs {
+    _, err := ParseTimestamp(tt.in, WithParseLocation(time.UTC))
+    var tpe *TimestampParseError
+    if !errors.As(err, &tpe) {
+      t.Errorf("ParseTimestamp(%q) error = %v, want a TimestampParseError", tt.in, err)
+      continue
+    }
+
+    if tpe.Column != tt.column {
+      t.Errorf("ParseTimestamp(%q) error at column %d, want %d: %v", tt.in, tpe.Column, tt.column, err)
+    }
+  }
+}
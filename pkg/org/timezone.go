@@ -0,0 +1,182 @@
+package org
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// TIMEZONE_PROPERTY names the property giving the time zone a heading's
+// timestamps are written in, E.G., `:TIMEZONE: Europe/Berlin`. It is always
+// inherited, so a document wide zone may be set with
+// `#+PROPERTY: TIMEZONE Europe/Berlin`.
+const TIMEZONE_PROPERTY = "TIMEZONE"
+
+// TimeZone returns the time zone of the node's timestamps and whether one is
+// set. Org timestamps are floating local times, so without a TIMEZONE
+// property they are read in whatever location the caller chooses. An error
+// is returned if the zone is not a valid IANA zone name.
+func (n *Node) TimeZone() (*time.Location, bool, error) {
+  v, ok := n.InheritedProperty(TIMEZONE_PROPERTY)
+  v = strings.TrimSpace(v)
+  if !ok || v == "" {
+    return nil, false, nil
+  }
+
+  loc, err := time.LoadLocation(v)
+  if err != nil {
+    return nil, true, NewInvalidTimeZoneError(n, v, err)
+  }
+
+  return loc, true, nil
+}
+
+// SetTimeZone sets the node's TIMEZONE property.
+func (n *Node) SetTimeZone(loc *time.Location) *Node {
+  return n.SetProperty(TIMEZONE_PROPERTY, loc.String())
+}
+
+// Localize returns a copy of the timestamp holding the same wall clock date
+// and times, placed in loc. Use it to attach a zone to a floating timestamp
+// before converting it with In.
+func (t *Timestamp) Localize(loc *time.Location) *Timestamp {
+  nt := *t
+  nt.Start = localize(t.Start, loc)
+  nt.End = localize(t.End, loc)
+
+  return &nt
+}
+
+// In returns a copy of the timestamp converted to the same instants in loc.
+// Date only timestamps name a day rather than an instant, so they keep their
+// date and are only localized.
+func (t *Timestamp) In(loc *time.Location) *Timestamp {
+  if t.DateOnly {
+    return t.Localize(loc)
+  }
+
+  nt := *t
+  nt.Start = t.Start.In(loc)
+  if !t.End.IsZero() {
+    nt.End = t.End.In(loc)
+  }
+
+  return &nt
+}
+
+// Localize returns a copy of the repeatstamp holding the same wall clock
+// times, placed in loc. Repetitions are computed in loc, so a repeater keeps
+// its time of day across daylight saving transitions in that zone.
+func (rs *RepeatStamp) Localize(loc *time.Location) *RepeatStamp {
+  nrs := *rs
+  nrs.Timestamp = *rs.Timestamp.Localize(loc)
+  nrs.RepeatConfig.Location = loc
+
+  return &nrs
+}
+
+// In returns a copy of the repeatstamp converted to loc, see Timestamp.In.
+// Note that repetitions of the returned stamp are computed in loc.
+func (rs *RepeatStamp) In(loc *time.Location) *RepeatStamp {
+  nrs := *rs
+  nrs.Timestamp = *rs.Timestamp.In(loc)
+  nrs.RepeatConfig.Location = loc
+
+  return &nrs
+}
+
+// Localize returns a copy of the range with both ends localized to loc.
+func (tr *TimestampRange) Localize(loc *time.Location) *TimestampRange {
+  ntr := *tr
+  ntr.StartDate = tr.StartDate.Localize(loc)
+  if tr.EndDate != nil {
+    ntr.EndDate = tr.EndDate.Localize(loc)
+  }
+
+  return &ntr
+}
+
+// In returns a copy of the range with both ends converted to loc.
+func (tr *TimestampRange) In(loc *time.Location) *TimestampRange {
+  ntr := *tr
+  ntr.StartDate = tr.StartDate.In(loc)
+  if tr.EndDate != nil {
+    ntr.EndDate = tr.EndDate.In(loc)
+  }
+
+  return &ntr
+}
+
+// LocalizeTimestamp localizes any kind of timestamp to loc. Sexp timestamps
+// hold no dates of their own and are returned as-is.
+func LocalizeTimestamp(tros TimestampRangeOrSexp, loc *time.Location) TimestampRangeOrSexp {
+  switch ts := tros.(type) {
+  case *Timestamp:
+    return ts.Localize(loc)
+  case *RepeatStamp:
+    return ts.Localize(loc)
+  case *TimestampRange:
+    return ts.Localize(loc)
+  }
+
+  return tros
+}
+
+// ConvertTimestamp converts any kind of timestamp to loc. Sexp timestamps are
+// returned as-is.
+func ConvertTimestamp(tros TimestampRangeOrSexp, loc *time.Location) TimestampRangeOrSexp {
+  switch ts := tros.(type) {
+  case *Timestamp:
+    return ts.In(loc)
+  case *RepeatStamp:
+    return ts.In(loc)
+  case *TimestampRange:
+    return ts.In(loc)
+  }
+
+  return tros
+}
+
+// ZonedTimestamp returns the timestamp localized to the node's TIMEZONE, or
+// as-is when the node sets none.
+func (n *Node) ZonedTimestamp(tros TimestampRangeOrSexp) (TimestampRangeOrSexp, error) {
+  loc, ok, err := n.TimeZone()
+  if !ok || err != nil {
+    return tros, err
+  }
+
+  return LocalizeTimestamp(tros, loc), nil
+}
+
+func localize(t time.Time, loc *time.Location) time.Time {
+  if t.IsZero() {
+    return t
+  }
+
+  y, m, d := t.Date()
+  h, min, s := t.Clock()
+  return time.Date(y, m, d, h, min, s, t.Nanosecond(), loc)
+}
+
+type InvalidTimeZoneError struct {
+  Node *Node
+  Zone string
+  Err  error
+}
+
+func (itze InvalidTimeZoneError) Error() string {
+  heading := ""
+  if itze.Node != nil && itze.Node.Heading != nil {
+    heading = itze.Node.Heading.Text
+  }
+
+  return fmt.Sprintf("Invalid %s %q on heading %q: %v", TIMEZONE_PROPERTY, itze.Zone, heading, itze.Err)
+}
+
+func (itze InvalidTimeZoneError) Unwrap() error {
+  return itze.Err
+}
+
+func NewInvalidTimeZoneError(n *Node, zone string, err error) *InvalidTimeZoneError {
+  return &InvalidTimeZoneError{Node: n, Zone: zone, Err: err}
+}
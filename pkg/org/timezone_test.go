@@ -0,0 +1,67 @@
+package org
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestTimeZone(t *testing.T) {
+  ny, err := time.LoadLocation("America/New_York")
+  if err != nil {
+    t.Skip(err)
+  }
+
+  d := New()
+  d.BufferSettings.Properties = []*Property{{Key: TIMEZONE_PROPERTY, Value: "Europe/Berlin"}}
+  d.AddHeading(1, "Berlin")
+  d.AddHeading(1, "New York")
+  berlin := d.NodeTree.Subtree[0].Node
+  nyc := d.NodeTree.Subtree[1].Node
+  nyc.SetTimeZone(ny)
+
+  if loc, ok, err := berlin.TimeZone(); !ok || err != nil || loc.String() != "Europe/Berlin" {
+    t.Errorf("document TimeZone() = %v, %v, %v", loc, ok, err)
+  }
+
+  if loc, ok, err := nyc.TimeZone(); !ok || err != nil || loc.String() != ny.String() {
+    t.Errorf("heading TimeZone() = %v, %v, %v", loc, ok, err)
+  }
+
+  berlin.SetProperty(TIMEZONE_PROPERTY, "Mars/Olympus")
+  var invalid *InvalidTimeZoneError
+  if _, _, err := berlin.TimeZone(); !errors.As(err, &invalid) || invalid.Zone != "Mars/Olympus" {
+    t.Errorf("invalid TimeZone() error = %v", err)
+  }
+
+  // a floating 09:00 meeting in New York is 14:00 UTC in winter
+  floating, _ := ParseTimestamp("<2050-03-07 Mon 09:00-10:00 +1w>", WithParseLocation(time.UTC))
+  zoned, err := nyc.ZonedTimestamp(floating)
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  utc := ConvertTimestamp(zoned, time.UTC).(*Timestamp)
+  if utc.Start.Hour() != 14 || utc.End.Hour() != 15 || utc.Repeat == nil {
+    t.Errorf("converted timestamp = %s", utc)
+  }
+
+  day := NewTimestamp(time.Date(2050, 3, 7, 0, 0, 0, 0, ny), WithDateOnly())
+  if got := day.In(time.UTC).String(); got != "<2050-03-07 Mon>" {
+    t.Errorf("date only In() = %s, want its date kept", got)
+  }
+
+  // the repeater keeps 09:00 local time across the start of daylight saving
+  // time on 2050-03-13, moving to 13:00 UTC
+  cfg := DefaultRepeatConfig
+  cfg.Location = ny
+  rs := NewRepeatStampFromTimestamp(utc, cfg)
+  next := rs.Shiftn(1)
+  if got := next.Start.In(ny).Format("2006-01-02 15:04"); got != "2050-03-14 09:00" {
+    t.Errorf("Shiftn(1) = %s in New York, want 2050-03-14 09:00", got)
+  }
+
+  if next.Start.UTC().Hour() != 13 || next.End.UTC().Hour() != 14 {
+    t.Errorf("Shiftn(1) = %v, want 13:00 UTC", next.Start.UTC())
+  }
+}
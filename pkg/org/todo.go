@@ -2,6 +2,7 @@ package org
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/lcyvin/gorgeous/internal/util"
 )
@@ -54,6 +55,10 @@ type TodoSequence struct {
   // FastAccessMap refers to any fast access keys defined for a keyword within
   // a todo keyword sequence definition (E.G., TODO(t))
   FastAccessMap   map[string]string
+
+  // LogMap refers to any logging flags defined for a keyword within a todo
+  // keyword sequence definition (E.G., WAIT(w@/!)), keyed by keyword.
+  LogMap          map[string]*TodoKeywordLogging
   
   // Kind refers to the sequence kind being defined. The valid kinds are:
   // - TODO_SEQUENCE_STATE
@@ -65,6 +70,147 @@ type TodoSequence struct {
   Kind            TodoSequenceKind
 }
 
+// TodoKeywordLogging holds the logging flags set for a single keyword. In a
+// definition such as `WAIT(w@/!)`, the flag before the slash applies when
+// entering the state and the flag after it when leaving the state, where "!"
+// records a timestamp and "@" records a timestamp and a note.
+type TodoKeywordLogging struct {
+  Enter TodoLogKind
+  Leave TodoLogKind
+}
+
+// ParseTodoSequence parses the value of a #+TODO (or #+SEQ_TODO, #+TYP_TODO)
+// keyword into a sequence of the given kind, E.G.:
+//
+//     TODO(t) WAIT(w@/!) | DONE(d!) CANCELED(c@)
+//
+// If no "|" is present, the final keyword is the only done keyword.
+func ParseTodoSequence(kind TodoSequenceKind, value string) (*TodoSequence, error) {
+  seq := &TodoSequence{
+    ProcessKeywords: make([]string, 0),
+    DoneKeywords: make([]string, 0),
+    FastAccessMap: make(map[string]string, 0),
+    LogMap: make(map[string]*TodoKeywordLogging, 0),
+    Kind: kind,
+  }
+
+  done := false
+  for _, tok := range strings.Fields(value) {
+    if tok == "|" {
+      if done {
+        return nil, NewInvalidTodoKeywordError(tok, "sequence contains more than one separator")
+      }
+
+      done = true
+      continue
+    }
+
+    kw, key, logging, err := parseTodoKeyword(tok)
+    if err != nil {
+      return nil, err
+    }
+
+    if seq.GetKeywordKind(kw) != TODO_KEYWORD_KIND_UNKNOWN {
+      return nil, NewTodoSequenceKeyCollisionError(kw)
+    }
+
+    if key != "" {
+      if _, ok := seq.FastAccessMap[key]; ok {
+        return nil, NewTodoFastAccessKeyCollisionError(key, seq.FastAccessMap[key], kw)
+      }
+
+      seq.FastAccessMap[key] = kw
+    }
+
+    if logging != nil {
+      seq.LogMap[kw] = logging
+    }
+
+    if done {
+      seq.DoneKeywords = append(seq.DoneKeywords, kw)
+      continue
+    }
+
+    seq.ProcessKeywords = append(seq.ProcessKeywords, kw)
+  }
+
+  if !done && len(seq.ProcessKeywords) > 0 {
+    last := len(seq.ProcessKeywords)-1
+    seq.DoneKeywords = append(seq.DoneKeywords, seq.ProcessKeywords[last])
+    seq.ProcessKeywords = seq.ProcessKeywords[:last]
+  }
+
+  if len(seq.keywords()) == 0 {
+    return nil, NewInvalidTodoKeywordError(value, "sequence defines no keywords")
+  }
+
+  return seq, nil
+}
+
+// Splits a keyword definition like WAIT(w@/!) into its keyword, fast access
+// key, and logging flags.
+func parseTodoKeyword(tok string) (string, string, *TodoKeywordLogging, error) {
+  open := strings.Index(tok, "(")
+  if open < 0 {
+    return tok, "", nil, nil
+  }
+
+  if open == 0 || !strings.HasSuffix(tok, ")") {
+    return "", "", nil, NewInvalidTodoKeywordError(tok, "malformed keyword options")
+  }
+
+  kw := tok[:open]
+  spec := tok[open+1:len(tok)-1]
+  key := ""
+  if spec != "" && !strings.ContainsAny(spec[:1], "!@/") {
+    key = spec[:1]
+    spec = spec[1:]
+  }
+
+  var logging *TodoKeywordLogging
+  enter, leave, hasLeave := strings.Cut(spec, "/")
+  if len(enter) > 1 || len(leave) > 1 {
+    return "", "", nil, NewInvalidTodoKeywordError(tok, "malformed logging flags")
+  }
+
+  if enter != "" || hasLeave {
+    logging = &TodoKeywordLogging{}
+    var ok bool
+    if logging.Enter, ok = todoLogFlag(enter); !ok {
+      return "", "", nil, NewInvalidTodoKeywordError(tok, "unknown logging flag "+enter)
+    }
+
+    if logging.Leave, ok = todoLogFlag(leave); !ok {
+      return "", "", nil, NewInvalidTodoKeywordError(tok, "unknown logging flag "+leave)
+    }
+  }
+
+  return kw, key, logging, nil
+}
+
+func todoLogFlag(f string) (TodoLogKind, bool) {
+  switch f {
+  case "":
+    return TODO_LOG_NONE, true
+  case "!":
+    return TODO_LOG_TIME, true
+  case "@":
+    return TODO_LOG_NOTE, true
+  }
+
+  return TODO_LOG_NONE, false
+}
+
+// Returns the logging flags defined for keyword k, or a zero value if none
+// are defined.
+func (ts *TodoSequence) GetLogging(k string) TodoKeywordLogging {
+  if l, ok := ts.LogMap[k]; ok && l != nil {
+    return *l
+  }
+
+  return TodoKeywordLogging{}
+}
+
 // Returns the string value of the keyword referenced by the fast access key,
 // and the TodoKeywordKind of the keyword referenced.
 func (ts *TodoSequence) GetAccessKeyword(k string) (string, TodoKeywordKind) {
@@ -105,7 +251,53 @@ func (ts *TodoSequence) GetFastAccessKey(k string) string {
 }
 
 func (ts *TodoSequence) keywords() []string {
-  return append(ts.ProcessKeywords, ts.DoneKeywords...)
+  out := make([]string, 0, len(ts.ProcessKeywords)+len(ts.DoneKeywords))
+  out = append(out, ts.ProcessKeywords...)
+  return append(out, ts.DoneKeywords...)
+}
+
+// Returns the keyword following k in the sequence, or an empty string if k
+// is the final keyword. If k is not part of the sequence, the first keyword
+// is returned.
+func (ts *TodoSequence) Next(k string) string {
+  kws := ts.keywords()
+  for i, v := range kws {
+    if v == k {
+      if i+1 < len(kws) {
+        return kws[i+1]
+      }
+
+      return ""
+    }
+  }
+
+  if len(kws) == 0 {
+    return ""
+  }
+
+  return kws[0]
+}
+
+// Returns the keyword preceding k in the sequence, or an empty string if k
+// is the first keyword. If k is not part of the sequence, the final keyword
+// is returned.
+func (ts *TodoSequence) Prev(k string) string {
+  kws := ts.keywords()
+  for i, v := range kws {
+    if v == k {
+      if i > 0 {
+        return kws[i-1]
+      }
+
+      return ""
+    }
+  }
+
+  if len(kws) == 0 {
+    return ""
+  }
+
+  return kws[len(kws)-1]
 }
 
 // Todo keywords can be defined as a sequence of either states, represented
@@ -150,11 +342,8 @@ func (ts *TodoSettings) fAdd(seq *TodoSequence) (*TodoSettings, error) {
 
   for _, s := range ts.Sequences {
     if nok, c := ts.fMapIntersects(s.FastAccessMap, seq.FastAccessMap); nok {
-      return nil, NewTodoFastAccessKeyCollisionError(
-        seq.GetFastAccessKey(c),
-        c,
-        seq.FastAccessMap[s.GetFastAccessKey(c)],
-        )
+      key := s.GetFastAccessKey(c)
+      return nil, NewTodoFastAccessKeyCollisionError(key, c, seq.FastAccessMap[key])
     }
   }
 
@@ -162,17 +351,19 @@ func (ts *TodoSettings) fAdd(seq *TodoSequence) (*TodoSettings, error) {
     return nil, NewTodoSequenceKeyCollisionError(collision)
   }
 
+  nts := &TodoSettings{
+    TypeSequences: ts.TypeSequences,
+    StateSequences: ts.StateSequences,
+    Sequences: append(ts.Sequences, seq),
+  }
+
   if seq.Kind == TODO_SEQUENCE_STATE {
-    return &TodoSettings{
-      StateSequences: append(ts.StateSequences, seq),
-      Sequences: append(ts.Sequences, seq),
-    }, nil
+    nts.StateSequences = append(nts.StateSequences, seq)
+    return nts, nil
   }
 
-  return &TodoSettings{
-    TypeSequences: append(ts.TypeSequences, seq),
-    Sequences: append(ts.Sequences, seq),
-  }, nil
+  nts.TypeSequences = append(nts.TypeSequences, seq)
+  return nts, nil
 }
 
 func (ts *TodoSettings) fMapIntersects(left, right map[string]string) (bool, string) {
@@ -187,7 +378,7 @@ func (ts *TodoSettings) fMapIntersects(left, right map[string]string) (bool, str
 
 func (ts *TodoSettings) fIntersectsAny(left *TodoSequence, right []*TodoSequence) (bool, string) {
   for _, v := range right {
-    if ok, collision := ts.fIntersects(left, v); !ok {
+    if ok, collision := ts.fIntersects(left, v); ok {
       return true, collision
     }
   }
@@ -223,17 +414,77 @@ func (ts *TodoSettings) GetFastAccessKey(k string) string {
   return "" 
 }
 
-// Adds a todo sequence to the 
+// Adds a todo sequence to the settings, returning an error without modifying
+// the settings if any of its keywords or fast access keys are already in use.
 func (ts *TodoSettings) Add(seq *TodoSequence) (*TodoSettings, error) {
   nts, err := ts.fAdd(seq)
   if err != nil {
     return nts, err
   }
 
-  ts = nts
+  *ts = *nts
   return ts, err
 }
 
+// Returns the sequence defining keyword k, or nil if no sequence defines it.
+func (ts *TodoSettings) SequenceFor(k string) *TodoSequence {
+  for _, seq := range ts.Sequences {
+    if seq.GetKeywordKind(k) != TODO_KEYWORD_KIND_UNKNOWN {
+      return seq
+    }
+  }
+
+  return nil
+}
+
+// Parses and adds the value of a #+TODO style keyword, see ParseTodoSequence.
+func (ts *TodoSettings) AddDefinition(kind TodoSequenceKind, value string) (*TodoSettings, error) {
+  seq, err := ParseTodoSequence(kind, value)
+  if err != nil {
+    return nil, err
+  }
+
+  return ts.Add(seq)
+}
+
+// Returns what should be logged for a change from one keyword to another, as
+// requested by the keywords' logging flags. The entered state's flag takes
+// precedence over the flag for leaving the previous state.
+func (ts *TodoSettings) TransitionLogging(from, to string) TodoLogKind {
+  if seq := ts.SequenceFor(to); seq != nil {
+    if l := seq.GetLogging(to).Enter; l != TODO_LOG_NONE {
+      return l
+    }
+  }
+
+  if seq := ts.SequenceFor(from); seq != nil {
+    return seq.GetLogging(from).Leave
+  }
+
+  return TODO_LOG_NONE
+}
+
+// Returns the TodoKeywordKind of k within whichever sequence defines it.
+func (ts *TodoSettings) GetKeywordKind(k string) TodoKeywordKind {
+  if seq := ts.SequenceFor(k); seq != nil {
+    return seq.GetKeywordKind(k)
+  }
+
+  return TODO_KEYWORD_KIND_UNKNOWN
+}
+
+// Returns the keyword bound to the fast access key k in any sequence, along
+// with its kind.
+func (ts *TodoSettings) GetAccessKeyword(k string) (string, TodoKeywordKind) {
+  for _, seq := range ts.Sequences {
+    if kw, kind := seq.GetAccessKeyword(k); kw != "" {
+      return kw, kind
+    }
+  }
+
+  return "", TODO_KEYWORD_KIND_UNKNOWN
+}
+
 type TodoSequenceKind int
 
 const (
@@ -266,6 +517,19 @@ func NewTodoSequenceKeyCollisionError(k string) *TodoSequenceKeyCollisionError {
   return e
 }
 
+type InvalidTodoKeywordError struct {
+  Keyword string
+  Reason string
+}
+
+func (itke InvalidTodoKeywordError) Error() string {
+  return fmt.Sprintf("Invalid todo keyword definition %s: %s", itke.Keyword, itke.Reason)
+}
+
+func NewInvalidTodoKeywordError(k, r string) *InvalidTodoKeywordError {
+  return &InvalidTodoKeywordError{Keyword: k, Reason: r}
+}
+
 type TodoSequenceKindInvalidError struct {}
 
 func (TodoSequenceKindInvalidError) Error() string {
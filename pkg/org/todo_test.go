@@ -0,0 +1,213 @@
+package org
+
+import (
+	"testing"
+	"time"
+)
+
+func testingTodoDocument(t *testing.T) (*Document, *Heading) {
+  d := New()
+  _, err := d.BufferSettings.TodoSettings.Add(&TodoSequence{
+    ProcessKeywords: []string{"WAIT", "STARTED"},
+    DoneKeywords: []string{"FINISHED", "CANCELLED"},
+    FastAccessMap: map[string]string{"w": "WAIT", "f": "FINISHED"},
+    Kind: TODO_SEQUENCE_STATE,
+  })
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  d.AddHeading(1, "Task")
+  return d, d.NodeTree.Subtree[0].Node.Heading
+}
+
+func TestHeadingCycleTodo(t *testing.T) {
+  _, h := testingTodoDocument(t)
+
+  want := []string{"TODO", "DONE", "", "TODO"}
+  for _, w := range want {
+    if _, err := h.CycleTodo(TODO_CYCLE_NEXT); err != nil {
+      t.Fatal(err)
+    }
+
+    if h.TodoKeyword != w {
+      t.Errorf("CycleTodo(next) = %q, want %q", h.TodoKeyword, w)
+    }
+  }
+
+  h.SetTodo("STARTED")
+  h.CycleTodo(TODO_CYCLE_PREV)
+  if h.TodoKeyword != "WAIT" {
+    t.Errorf("CycleTodo(prev) = %q, want WAIT", h.TodoKeyword)
+  }
+
+  if _, err := h.SetTodo("NOPE"); err == nil {
+    t.Errorf("SetTodo with an undefined keyword should fail")
+  }
+}
+
+func TestHeadingSetTodoLogDone(t *testing.T) {
+  d, h := testingTodoDocument(t)
+  d.BufferSettings.Startup = (&StartupSettings{}).Add("overview lognotedone")
+  at := time.Date(2050, 1, 1, 10, 0, 0, 0, time.UTC)
+
+  h.SetTodoByKey("w")
+  tc, err := h.SetTodoByKey("f", WithChangeTime(at), WithChangeNote("all done"))
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  closed := h.GetPlanning(PLANNING_CLOSED)
+  if !tc.Closed || closed == nil || closed.TimestampRangeOrSexp.(*Timestamp).Start != at {
+    t.Fatalf("SetTodo(FINISHED) did not record CLOSED")
+  }
+
+  entries := h.Node.LogEntries()
+  if len(entries) != 1 || entries[0].EntryKind != LOG_ENTRY_CLOSING_NOTE || entries[0].Note[0] != "all done" {
+    t.Errorf("SetTodo(FINISHED) log entries = %v", entries)
+  }
+
+  h.SetTodo("WAIT")
+  if h.GetPlanning(PLANNING_CLOSED) != nil {
+    t.Errorf("leaving a done state should remove CLOSED")
+  }
+}
+
+func TestHeadingRepeatOnDone(t *testing.T) {
+  loc := time.UTC
+  base := time.Date(2050, 1, 1, 9, 0, 0, 0, loc)
+  now := time.Date(2050, 3, 10, 12, 0, 0, 0, loc)
+
+  var tests = []struct {
+    kind RepeatKind
+    amt int
+    interval RepeatIntervalKind
+    want time.Time
+  }{
+    {REPEAT_KIND_SHIFT, 1, REPEAT_INTERVAL_WEEK, time.Date(2050, 1, 8, 9, 0, 0, 0, loc)},
+    {REPEAT_KIND_SHIFT_FUTURE_FIXED, 1, REPEAT_INTERVAL_MONTH, time.Date(2050, 4, 1, 9, 0, 0, 0, loc)},
+    {REPEAT_KIND_SHIFT_FUTURE_RELATIVE, 2, REPEAT_INTERVAL_DAY, time.Date(2050, 3, 12, 9, 0, 0, 0, loc)},
+  }
+
+  for _, test := range tests {
+    _, h := testingTodoDocument(t)
+    h.SetTodo("TODO")
+    h.SetPlanning(&Planning{
+      PlanningKind: PLANNING_SCHEDULED,
+      TimestampRangeOrSexp: NewTimestamp(base, WithRepeat(&Repeat{
+        Kind: test.kind,
+        IntervalAmount: test.amt,
+        Interval: test.interval,
+      })),
+    })
+
+    tc, err := h.SetTodo("DONE", WithChangeTime(now))
+    if err != nil {
+      t.Fatal(err)
+    }
+
+    got := h.GetPlanning(PLANNING_SCHEDULED).TimestampRangeOrSexp.(*Timestamp).Start
+    if !got.Equal(test.want) {
+      t.Errorf("%s%d%s shifted to %v, want %v", test.kind, test.amt, test.interval, got, test.want)
+    }
+
+    if !tc.Repeated || h.TodoKeyword != "TODO" || h.GetPlanning(PLANNING_CLOSED) != nil {
+      t.Errorf("repeating task was not reset: %+v", tc)
+    }
+
+    if _, ok := h.Node.Property("LAST_REPEAT"); !ok {
+      t.Errorf("LAST_REPEAT was not recorded")
+    }
+
+    entries := h.Node.LogEntries()
+    if len(entries) != 1 || entries[0].State != "DONE" || entries[0].From != "TODO" {
+      t.Errorf("repeat log entries = %v", entries)
+    }
+  }
+}
+
+func TestHeadingKeywordLogging(t *testing.T) {
+  d := New()
+  d.BufferSettings.TodoSettings = &TodoSettings{}
+  _, err := d.BufferSettings.TodoSettings.AddDefinition(TODO_SEQUENCE_STATE, "TODO(t) WAIT(w@/!) | DONE(d!) CANCELED(c@)")
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  d.AddHeading(1, "Task")
+  n := d.NodeTree.Subtree[0].Node
+  n.SetProperty("LOG_INTO_DRAWER", "NOTES")
+  h := n.Heading
+
+  h.SetTodoByKey("t")
+  h.SetTodoByKey("w", WithChangeNote("waiting on review"))
+  h.SetTodo("TODO")
+  h.SetTodo("DONE")
+
+  entries := n.LogEntries()
+  want := []struct{ state, from string; note bool }{
+    {"DONE", "TODO", false},
+    {"TODO", "WAIT", false},
+    {"WAIT", "TODO", true},
+  }
+
+  if len(entries) != len(want) || n.Logbook(false) != nil {
+    t.Fatalf("LogEntries() = %v", entries)
+  }
+
+  for i, w := range want {
+    e := entries[i]
+    if e.State != w.state || e.From != w.from || (len(e.Note) > 0) != w.note {
+      t.Errorf("entry %d = %+v, want %+v", i, e, w)
+    }
+  }
+
+  if _, err := ParseTodoSequence(TODO_SEQUENCE_STATE, "TODO(t?) DONE"); err == nil {
+    t.Errorf("ParseTodoSequence should reject unknown logging flags")
+  }
+}
+
+func TestHeadingTodoDependencies(t *testing.T) {
+  d := New()
+  d.BufferSettings.TodoDependencies = TODO_DEPENDENCIES_REFUSE
+  d.AddHeading(1, "Project")
+  d.AddHeading(2, "First")
+  d.AddHeading(2, "Second")
+  d.AddHeading(1, "Other")
+
+  project := d.NodeTree.Subtree[0].Node
+  first := project.Tree.Subtree[0].Node
+  second := project.Tree.Subtree[1].Node
+  other := d.NodeTree.Subtree[1].Node
+
+  project.SetProperty("ORDERED", "t")
+  first.SetProperty("ID", "first-id")
+  other.SetProperty("BLOCKER", "ids(first-id)")
+  for _, n := range []*Node{project, first, second, other} {
+    n.Heading.SetTodo("TODO")
+  }
+
+  for _, n := range []*Node{project, second, other} {
+    _, err := n.Heading.SetTodo("DONE")
+    if _, ok := err.(*TodoBlockedError); !ok {
+      t.Errorf("SetTodo(DONE) on %s = %v, want TodoBlockedError", n.Heading.Text, err)
+    }
+
+    if n.Heading.TodoKeyword != "TODO" {
+      t.Errorf("refused transition changed %s to %s", n.Heading.Text, n.Heading.TodoKeyword)
+    }
+  }
+
+  tc, err := second.Heading.SetTodo("DONE", WithDependencyPolicy(TODO_DEPENDENCIES_WARN))
+  if err != nil || len(tc.Warnings) != 1 {
+    t.Errorf("warned transition = %v, %v", tc, err)
+  }
+
+  if _, err := first.Heading.SetTodo("DONE"); err != nil {
+    t.Errorf("SetTodo(DONE) on unblocked node = %v", err)
+  }
+
+  if project.IsBlocked() || other.IsBlocked() {
+    t.Errorf("nodes remain blocked after dependencies were completed")
+  }
+}
@@ -0,0 +1,494 @@
+package org
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// TodoChange describes a todo state transition performed on a heading, and is
+// returned by the state-changing methods on Heading so callers can inspect
+// what was recorded.
+type TodoChange struct {
+  From  string
+  To    string
+  // The time the change is recorded at. Defaults to the current time.
+  Time  time.Time
+  // A note supplied by the caller, recorded when the settings in effect
+  // request a note for the transition.
+  Note  string
+  // True if a CLOSED planning element was added by the change.
+  Closed bool
+  // True if entering the done state shifted the heading's repeating
+  // timestamps, in which case the heading's keyword was reset to Reset.
+  Repeated bool
+  Reset string
+  // Non-fatal problems encountered during the change, such as a
+  // TodoBlockedError under TODO_DEPENDENCIES_WARN.
+  Warnings []error
+  // Overrides the document's dependency policy when set, see
+  // WithDependencyPolicy.
+  policy *TodoDependencyPolicy
+}
+
+type TodoChangeOpt func(*TodoChange)
+
+// Records the state change as having happened at t rather than the current
+// time.
+func WithChangeTime(t time.Time) TodoChangeOpt {
+  return func(tc *TodoChange) {
+    tc.Time = t
+  }
+}
+
+// Supplies the note recorded for transitions configured to take one. The
+// note is ignored for transitions which do not.
+func WithChangeNote(note string) TodoChangeOpt {
+  return func(tc *TodoChange) {
+    tc.Note = note
+  }
+}
+
+// Overrides BufferSettings.TodoDependencies for a single change, E.G., to
+// force a blocked task done with TODO_DEPENDENCIES_IGNORE.
+func WithDependencyPolicy(p TodoDependencyPolicy) TodoChangeOpt {
+  return func(tc *TodoChange) {
+    tc.policy = &p
+  }
+}
+
+type TodoCycleDirection int
+
+const (
+  TODO_CYCLE_NEXT TodoCycleDirection = iota
+  TODO_CYCLE_PREV
+)
+
+// SetTodo changes the heading's todo keyword to k, which must be defined by
+// one of the document's todo sequences. An empty keyword removes the todo
+// state from the heading.
+//
+// Entering a done state from a non-done state adds a CLOSED planning element
+// holding an inactive timestamp of the change. With `#+STARTUP: logdone` a
+// state change entry is also added to the node's LOGBOOK drawer, and with
+// `#+STARTUP: lognotedone` a closing note holding the note passed with
+// WithChangeNote is added instead. Leaving a done state for a non-done state
+// removes the CLOSED planning element.
+func (h *Heading) SetTodo(k string, opts... TodoChangeOpt) (*TodoChange, error) {
+  ts := h.todoSettings()
+  if ts == nil {
+    return nil, NewNilTodoSettingsError()
+  }
+
+  if k != "" && ts.SequenceFor(k) == nil {
+    return nil, NewUnknownTodoKeywordError(k)
+  }
+
+  tc := &TodoChange{
+    From: h.TodoKeyword,
+    To: k,
+    Time: time.Now(),
+  }
+
+  for _, opt := range opts {
+    opt(tc)
+  }
+
+  if tc.From == tc.To {
+    return tc, nil
+  }
+
+  wasDone := ts.GetKeywordKind(tc.From) == TODO_KEYWORD_KIND_DONE
+  isDone := ts.GetKeywordKind(tc.To) == TODO_KEYWORD_KIND_DONE
+
+  if isDone && !wasDone && h.Node != nil {
+    if err := h.checkDependencies(tc); err != nil {
+      return nil, err
+    }
+  }
+
+  kwLog := ts.TransitionLogging(tc.From, tc.To)
+  h.TodoKeyword = tc.To
+
+  if isDone && !wasDone && h.IsRepeating() {
+    h.repeat(tc, ts, kwLog)
+    return tc, nil
+  }
+
+  if isDone && !wasDone {
+    h.SetPlanning(&Planning{
+      PlanningKind: PLANNING_CLOSED,
+      TimestampRangeOrSexp: NewTimestamp(tc.Time, WithInactive()),
+    })
+    tc.Closed = true
+
+    if kwLog == TODO_LOG_NONE {
+      h.logDone(tc)
+    }
+  }
+
+  if wasDone && !isDone {
+    h.RemovePlanning(PLANNING_CLOSED)
+  }
+
+  h.logState(tc, kwLog)
+
+  return tc, nil
+}
+
+// CycleTodo moves the heading's todo keyword to the next or previous keyword
+// within the sequence defining its current keyword. Cycling past either end
+// of the sequence removes the keyword, and cycling from no keyword enters the
+// first (or, cycling backwards, the last) keyword of the first sequence.
+func (h *Heading) CycleTodo(dir TodoCycleDirection, opts... TodoChangeOpt) (*TodoChange, error) {
+  ts := h.todoSettings()
+  if ts == nil {
+    return nil, NewNilTodoSettingsError()
+  }
+
+  seq := ts.SequenceFor(h.TodoKeyword)
+  if seq == nil {
+    if len(ts.Sequences) == 0 {
+      return nil, NewNilTodoSettingsError()
+    }
+
+    seq = ts.Sequences[0]
+  }
+
+  next := seq.Next(h.TodoKeyword)
+  if dir == TODO_CYCLE_PREV {
+    next = seq.Prev(h.TodoKeyword)
+  }
+
+  return h.SetTodo(next, opts...)
+}
+
+// SetTodoByKey sets the keyword bound to the fast access key k, as defined
+// with a keyword like `TODO(t)`. A key of " " removes the keyword, as it does
+// in org's fast selection interface.
+func (h *Heading) SetTodoByKey(k string, opts... TodoChangeOpt) (*TodoChange, error) {
+  if k == " " {
+    return h.SetTodo("", opts...)
+  }
+
+  ts := h.todoSettings()
+  if ts == nil {
+    return nil, NewNilTodoSettingsError()
+  }
+
+  kw, _ := ts.GetAccessKeyword(k)
+  if kw == "" {
+    return nil, NewUnknownTodoFastAccessKeyError(k)
+  }
+
+  return h.SetTodo(kw, opts...)
+}
+
+// Returns true if the heading's todo keyword is a done keyword in the
+// document's todo settings.
+func (h *Heading) IsDone() bool {
+  ts := h.todoSettings()
+  if ts == nil || h.TodoKeyword == "" {
+    return false
+  }
+
+  return ts.GetKeywordKind(h.TodoKeyword) == TODO_KEYWORD_KIND_DONE
+}
+
+// Returns true if any of the heading's planning timestamps holds a repeat
+// cookie.
+func (h *Heading) IsRepeating() bool {
+  for _, p := range h.Planning {
+    if p.PlanningKind != PLANNING_CLOSED && isRepeating(p.TimestampRangeOrSexp) {
+      return true
+    }
+  }
+
+  return false
+}
+
+// Returns the planning element of the given kind held by the heading, or nil.
+func (h *Heading) GetPlanning(kind PlanningKind) *Planning {
+  for _, p := range h.Planning {
+    if p.PlanningKind == kind {
+      return p
+    }
+  }
+
+  return nil
+}
+
+// Sets the planning element, replacing any existing element of the same kind.
+func (h *Heading) SetPlanning(p *Planning) *Heading {
+  for i, v := range h.Planning {
+    if v.PlanningKind == p.PlanningKind {
+      h.Planning[i] = p
+      return h
+    }
+  }
+
+  h.Planning = append(h.Planning, p)
+  return h
+}
+
+// Removes any planning element of the given kind from the heading.
+func (h *Heading) RemovePlanning(kind PlanningKind) *Heading {
+  out := make([]*Planning, 0, len(h.Planning))
+  for _, p := range h.Planning {
+    if p.PlanningKind != kind {
+      out = append(out, p)
+    }
+  }
+
+  h.Planning = out
+  return h
+}
+
+func (h *Heading) repeat(tc *TodoChange, ts *TodoSettings, kwLog TodoLogKind) {
+  for _, p := range h.Planning {
+    if p.PlanningKind == PLANNING_CLOSED {
+      continue
+    }
+
+    if shifted, ok := shiftRepeating(p.TimestampRangeOrSexp, tc.Time); ok {
+      p.TimestampRangeOrSexp = shifted
+    }
+  }
+
+  tc.Repeated = true
+  tc.Reset = ts.SequenceFor(tc.To).Next("")
+  if h.Node != nil {
+    if v, ok := h.Node.InheritedProperty("REPEAT_TO_STATE"); ok && ts.SequenceFor(v) != nil {
+      tc.Reset = v
+    }
+  }
+
+  h.TodoKeyword = tc.Reset
+
+  if h.Node == nil {
+    return
+  }
+
+  stamp := NewTimestamp(tc.Time, WithInactive())
+  h.Node.SetProperty("LAST_REPEAT", stamp.String())
+
+  entry := &LogEntry{
+    EntryKind: LOG_ENTRY_STATE,
+    State: tc.To,
+    From: tc.From,
+    Time: stamp,
+  }
+
+  logKind := h.startup().LogRepeat
+  if kwLog != TODO_LOG_NONE {
+    logKind = kwLog
+  }
+
+  switch logKind {
+  case TODO_LOG_NOTE:
+    entry.Note = noteLines(tc.Note)
+    fallthrough
+  case TODO_LOG_TIME:
+    h.Node.addLogEntry(entry)
+  }
+}
+
+func isRepeating(tros TimestampRangeOrSexp) bool {
+  switch v := tros.(type) {
+  case *Timestamp:
+    return v.Repeat != nil
+  case *RepeatStamp:
+    return v.Repeat != nil
+  case *TimestampRange:
+    return v.StartDate != nil && v.StartDate.Repeat != nil
+  }
+
+  return false
+}
+
+// Shifts a repeating timestamp, or timestamp range, by its repeat cookie as
+// org does when the owning task is marked done at now. Returns false if the
+// timestamp does not repeat or could not be shifted.
+func shiftRepeating(tros TimestampRangeOrSexp, now time.Time) (TimestampRangeOrSexp, bool) {
+  switch v := tros.(type) {
+  case *RepeatStamp:
+    if v.Repeat == nil {
+      return tros, false
+    }
+
+    if shifted := v.Shift(now); shifted != nil {
+      return shifted, true
+    }
+  case *Timestamp:
+    if v.Repeat == nil {
+      return tros, false
+    }
+
+    cfg := DefaultRepeatConfig
+    cfg.Location = v.Start.Location()
+    if shifted := NewRepeatStampFromTimestamp(v, cfg).Shift(now); shifted != nil {
+      ts := shifted.Timestamp
+      return &ts, true
+    }
+  case *TimestampRange:
+    if v.StartDate == nil || v.StartDate.Repeat == nil {
+      return tros, false
+    }
+
+    shifted, ok := shiftRepeating(v.StartDate, now)
+    if !ok {
+      return tros, false
+    }
+
+    start := shifted.(*Timestamp)
+    delta := start.Start.Sub(v.StartDate.Start)
+    ntr := *v
+    ntr.StartDate = start
+    if v.EndDate != nil {
+      end := *v.EndDate
+      end.Start = end.Start.Add(delta)
+      if !end.End.IsZero() {
+        end.End = end.End.Add(delta)
+      }
+      ntr.EndDate = &end
+    }
+
+    return &ntr, true
+  }
+
+  return tros, false
+}
+
+func (h *Heading) logState(tc *TodoChange, kind TodoLogKind) {
+  if h.Node == nil || kind == TODO_LOG_NONE {
+    return
+  }
+
+  entry := &LogEntry{
+    EntryKind: LOG_ENTRY_STATE,
+    State: tc.To,
+    From: tc.From,
+    Time: NewTimestamp(tc.Time, WithInactive()),
+  }
+
+  if kind == TODO_LOG_NOTE {
+    entry.Note = noteLines(tc.Note)
+  }
+
+  h.Node.addLogEntry(entry)
+}
+
+func (h *Heading) logDone(tc *TodoChange) {
+  if h.Node == nil {
+    return
+  }
+
+  switch h.startup().LogDone {
+  case TODO_LOG_TIME:
+    h.Node.addLogEntry(&LogEntry{
+      EntryKind: LOG_ENTRY_STATE,
+      State: tc.To,
+      From: tc.From,
+      Time: NewTimestamp(tc.Time, WithInactive()),
+    })
+  case TODO_LOG_NOTE:
+    h.Node.addLogEntry(&LogEntry{
+      EntryKind: LOG_ENTRY_CLOSING_NOTE,
+      Time: NewTimestamp(tc.Time, WithInactive()),
+      Note: noteLines(tc.Note),
+    })
+  }
+}
+
+func (h *Heading) checkDependencies(tc *TodoChange) error {
+  policy := TODO_DEPENDENCIES_IGNORE
+  if bs := h.Node.bufferSettings(); bs != nil {
+    policy = bs.TodoDependencies
+  }
+
+  if tc.policy != nil {
+    policy = *tc.policy
+  }
+
+  if policy == TODO_DEPENDENCIES_IGNORE {
+    return nil
+  }
+
+  blockers := h.Node.Blockers()
+  if len(blockers) == 0 {
+    return nil
+  }
+
+  err := NewTodoBlockedError(h.Node, tc.To, blockers)
+  if policy == TODO_DEPENDENCIES_REFUSE {
+    return err
+  }
+
+  tc.Warnings = append(tc.Warnings, err)
+  return nil
+}
+
+func (h *Heading) todoSettings() *TodoSettings {
+  if h.Node == nil {
+    return nil
+  }
+
+  bs := h.Node.bufferSettings()
+  if bs == nil {
+    return nil
+  }
+
+  return bs.TodoSettings
+}
+
+func (h *Heading) startup() *StartupSettings {
+  if h.Node != nil {
+    if bs := h.Node.bufferSettings(); bs != nil && bs.Startup != nil {
+      return bs.Startup
+    }
+  }
+
+  return NewStartupSettings()
+}
+
+func noteLines(note string) []string {
+  if strings.TrimSpace(note) == "" {
+    return nil
+  }
+
+  return strings.Split(strings.TrimRight(note, "\n"), "\n")
+}
+
+type NilTodoSettingsError struct {}
+
+func (NilTodoSettingsError) Error() string {
+  return "Heading does not belong to a document defining todo sequences"
+}
+
+func NewNilTodoSettingsError() *NilTodoSettingsError {
+  return &NilTodoSettingsError{}
+}
+
+type UnknownTodoKeywordError struct {
+  Keyword string
+}
+
+func (utke UnknownTodoKeywordError) Error() string {
+  return fmt.Sprintf("Todo keyword %s is not defined by any todo sequence", utke.Keyword)
+}
+
+func NewUnknownTodoKeywordError(k string) *UnknownTodoKeywordError {
+  return &UnknownTodoKeywordError{Keyword: k}
+}
+
+type UnknownTodoFastAccessKeyError struct {
+  Key string
+}
+
+func (utfake UnknownTodoFastAccessKeyError) Error() string {
+  return fmt.Sprintf("Fast access key %s is not bound to any todo keyword", utfake.Key)
+}
+
+func NewUnknownTodoFastAccessKeyError(k string) *UnknownTodoFastAccessKeyError {
+  return &UnknownTodoFastAccessKeyError{Key: k}
+}